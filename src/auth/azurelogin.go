@@ -1,24 +1,150 @@
+// Package auth builds the Azure credentials used by every command from the
+// credentials section of the selected profile. Nothing here touches the
+// process environment; each strategy is configured explicitly.
 package auth
 
 import (
 	"fmt"
 	"os"
+	"sort"
 
-	"github.com/spf13/viper"
+	"gowithazure/src/config"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 )
 
-// SetCreds presumes you have an Azure Service Principal account setup
-// and you've been provided the credentials with the appropriate permissions
-// set within Azure AD. You can comment out the call to auth.SetEnvCreds in
-// main.go if you simply wish to use the az login cli default creds to test.
-func SetEnvCreds() {
-	os.Setenv("AZURE_TENANT_ID", viper.GetString("app.AZURE_TENANT_ID"))
-	os.Setenv("AZURE_CLIENT_ID", viper.GetString("app.AZURE_CLIENT_ID"))
-	os.Setenv("AZURE_CLIENT_SECRET", viper.GetString("app.AZURE_CLIENT_SECRET"))
-	fmt.Println("Setting environment variables")
-
-	// // Additional print statements to verify the environment variables
-	// fmt.Println("AZURE_TENANT_ID:", os.Getenv("AZURE_TENANT_ID"))
-	// fmt.Println("AZURE_CLIENT_ID:", os.Getenv("AZURE_CLIENT_ID"))
-	// fmt.Println("AZURE_CLIENT_SECRET:", os.Getenv("AZURE_CLIENT_SECRET"))
+// Provider builds a credential from a profile's credentials section.
+type Provider func(creds config.Credentials) (azcore.TokenCredential, error)
+
+// providers maps each credentials.source to the Provider that handles it.
+var providers = map[string]Provider{
+	"":                   defaultCredential,
+	"default":            defaultCredential,
+	"client-secret":      clientSecretCredential,
+	"service-principal":  clientSecretCredential,
+	"client-certificate": clientCertificateCredential,
+	"workload-identity":  workloadIdentityCredential,
+	"managed-identity":   managedIdentityCredential,
+	"azure-cli":          azureCLICredential,
+}
+
+func init() {
+	// chained builds its links through NewCredential, so it is added here to
+	// avoid an initialization cycle.
+	providers["chained"] = chainedCredential
+}
+
+// Register adds or replaces the Provider for a credentials source. required
+// lists the credentials fields config validation insists on for it.
+func Register(source string, provider Provider, required ...string) {
+	providers[source] = provider
+	config.RegisterCredentialSource(source, required...)
+}
+
+// Sources returns the credential sources that have a Provider, in sorted order.
+func Sources() []string {
+	sources := make([]string, 0, len(providers))
+	for source := range providers {
+		if source != "" {
+			sources = append(sources, source)
+		}
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+// NewCredential returns the azcore.TokenCredential described by creds.
+func NewCredential(creds config.Credentials) (azcore.TokenCredential, error) {
+	provider, ok := providers[creds.Source]
+	if !ok {
+		return nil, fmt.Errorf("unknown credential source %q, expected one of %v", creds.Source, Sources())
+	}
+
+	credential, err := provider(creds)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s credential: %w", sourceName(creds.Source), err)
+	}
+	return credential, nil
+}
+
+// defaultCredential uses the default Azure credential chain: environment,
+// workload identity, managed identity and finally az login.
+func defaultCredential(creds config.Credentials) (azcore.TokenCredential, error) {
+	return azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{TenantID: creds.TenantID})
+}
+
+// clientSecretCredential presumes you have an Azure Service Principal account
+// setup and you've been provided the credentials with the appropriate
+// permissions set within Azure AD.
+func clientSecretCredential(creds config.Credentials) (azcore.TokenCredential, error) {
+	return azidentity.NewClientSecretCredential(creds.TenantID, creds.ClientID, creds.ClientSecret, nil)
+}
+
+// clientCertificateCredential authenticates a service principal with a PEM or
+// PKCS#12 certificate file holding the certificate and its private key.
+func clientCertificateCredential(creds config.Credentials) (azcore.TokenCredential, error) {
+	data, err := os.ReadFile(creds.CertificateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var password []byte
+	if creds.CertificatePassword != "" {
+		password = []byte(creds.CertificatePassword)
+	}
+	certs, key, err := azidentity.ParseCertificates(data, password)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", creds.CertificateFile, err)
+	}
+
+	return azidentity.NewClientCertificateCredential(creds.TenantID, creds.ClientID, certs, key, nil)
+}
+
+// workloadIdentityCredential exchanges a federated token file, such as the
+// Kubernetes service account token, for an Azure AD token. Unset fields fall
+// back to the variables set by the workload identity webhook.
+func workloadIdentityCredential(creds config.Credentials) (azcore.TokenCredential, error) {
+	return azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{
+		TenantID:      creds.TenantID,
+		ClientID:      creds.ClientID,
+		TokenFilePath: creds.TokenFile,
+	})
+}
+
+// managedIdentityCredential uses the system-assigned identity of the host, or
+// the user-assigned identity with clientId when one is given.
+func managedIdentityCredential(creds config.Credentials) (azcore.TokenCredential, error) {
+	var options azidentity.ManagedIdentityCredentialOptions
+	if creds.ClientID != "" {
+		options.ID = azidentity.ClientID(creds.ClientID)
+	}
+	return azidentity.NewManagedIdentityCredential(&options)
+}
+
+// azureCLICredential uses the account signed in with az login.
+func azureCLICredential(creds config.Credentials) (azcore.TokenCredential, error) {
+	return azidentity.NewAzureCLICredential(&azidentity.AzureCLICredentialOptions{TenantID: creds.TenantID})
+}
+
+// chainedCredential tries each credential of the chain in order until one
+// returns a token.
+func chainedCredential(creds config.Credentials) (azcore.TokenCredential, error) {
+	sources := make([]azcore.TokenCredential, 0, len(creds.Chain))
+	for i, link := range creds.Chain {
+		credential, err := NewCredential(link)
+		if err != nil {
+			return nil, fmt.Errorf("chain[%d]: %w", i, err)
+		}
+		sources = append(sources, credential)
+	}
+	return azidentity.NewChainedTokenCredential(sources, nil)
+}
+
+// sourceName names a credentials source in error messages.
+func sourceName(source string) string {
+	if source == "" {
+		return "default"
+	}
+	return source
 }
@@ -0,0 +1,245 @@
+// Package checkpoint records the progress of long scans in a local file so a
+// rerun with --resume picks up where the previous run stopped. Progress is
+// kept per account and container as the continuation marker of the next page
+// to list, the same marker the Azure listing APIs hand out, together with
+// whatever the scan has computed up to those markers.
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SaveInterval is how often a checkpoint writes its file at most while
+// pages are being recorded.
+const SaveInterval = 10 * time.Second
+
+// Checkpoint is the progress of one scan.
+type Checkpoint struct {
+	// Settings are the flags that shape the scan's output. A checkpoint is
+	// only resumed by a run with the same settings.
+	Settings map[string]string `json:"settings"`
+	// Offset is the length of the output file covered by the progress below;
+	// anything after it was written by records that will be listed again.
+	Offset   int64               `json:"offset,omitempty"`
+	Accounts map[string]*Account `json:"accounts"`
+	// State is the result of the scan so far, see Track.
+	State json.RawMessage `json:"state,omitempty"`
+
+	path  string
+	mu    sync.Mutex
+	saved time.Time
+	state any
+}
+
+// Account is the progress of one storage account.
+type Account struct {
+	// Marker is where the container listing of the account continues.
+	Marker string `json:"marker,omitempty"`
+	Done   bool   `json:"done,omitempty"`
+	// Containers are the containers that have been started.
+	Containers map[string]*Container `json:"containers,omitempty"`
+}
+
+// Container is the progress of one container.
+type Container struct {
+	// Marker is where the listing of the container continues.
+	Marker string `json:"marker,omitempty"`
+	Done   bool   `json:"done,omitempty"`
+}
+
+// New returns an empty checkpoint that will be saved to path.
+func New(path string, settings map[string]string) *Checkpoint {
+	return &Checkpoint{Settings: settings, Accounts: make(map[string]*Account), path: path}
+}
+
+// Load reads the checkpoint at path and checks that it was written by a run
+// with the same settings.
+func Load(path string, settings map[string]string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no checkpoint to resume from at %s", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := New(path, nil)
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("reading checkpoint %s: %w", path, err)
+	}
+	if !maps.Equal(c.Settings, settings) {
+		return nil, fmt.Errorf("checkpoint %s was written with different settings %v, expected %v", path, c.Settings, settings)
+	}
+	if c.Accounts == nil {
+		c.Accounts = make(map[string]*Account)
+	}
+	return c, nil
+}
+
+// Path returns the file the checkpoint is saved to.
+func (c *Checkpoint) Path() string {
+	return c.path
+}
+
+// DefaultPath returns where the checkpoint of a scan called name is kept when
+// no file is given: in the user's cache directory.
+func DefaultPath(name string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "gowithazure")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".checkpoint"), nil
+}
+
+// Track makes state, a pointer, part of the checkpoint: it is filled from the
+// checkpoint that was loaded, if any, and saved with every page recorded. It
+// must only be changed by the commit functions passed to ContainerPage and
+// BlobPage, so what is saved always matches the markers.
+func (c *Checkpoint) Track(state any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.State) > 0 {
+		if err := json.Unmarshal(c.State, state); err != nil {
+			return fmt.Errorf("reading checkpoint %s: %w", c.path, err)
+		}
+	}
+	c.state = state
+	return nil
+}
+
+// Account returns where the container listing of an account continues.
+func (c *Checkpoint) Account(account string) (marker string, done bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if progress := c.Accounts[account]; progress != nil {
+		return progress.Marker, progress.Done
+	}
+	return "", false
+}
+
+// Container returns where the blob listing of a container continues.
+func (c *Checkpoint) Container(account, name string) (marker string, done bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if progress := c.Accounts[account].container(name); progress != nil {
+		return progress.Marker, progress.Done
+	}
+	return "", false
+}
+
+func (a *Account) container(name string) *Container {
+	if a == nil {
+		return nil
+	}
+	return a.Containers[name]
+}
+
+// ContainerPage runs commit and records that the container listing of an
+// account continues from marker, or is done when marker is "". Containers
+// past marker may have been finished by an earlier run, so the progress of
+// containers is only dropped once the account is done.
+func (c *Checkpoint) ContainerPage(account, marker string, commit func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := commit(); err != nil {
+		return err
+	}
+	progress := c.Accounts[account]
+	if progress == nil || marker == "" {
+		progress = &Account{}
+		c.Accounts[account] = progress
+	}
+	progress.Marker, progress.Done = marker, marker == ""
+	return c.saveEvery()
+}
+
+// BlobPage runs commit and records that the blob listing of a container
+// continues from marker, or is done when marker is "".
+func (c *Checkpoint) BlobPage(account, name, marker string, commit func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := commit(); err != nil {
+		return err
+	}
+	progress := c.Accounts[account]
+	if progress == nil {
+		progress = &Account{}
+		c.Accounts[account] = progress
+	}
+	if progress.Containers == nil {
+		progress.Containers = make(map[string]*Container)
+	}
+	progress.Containers[name] = &Container{Marker: marker, Done: marker == ""}
+	return c.saveEvery()
+}
+
+// saveEvery saves the file when SaveInterval has passed since it was last
+// saved.
+func (c *Checkpoint) saveEvery() error {
+	if time.Since(c.saved) < SaveInterval {
+		return nil
+	}
+	return c.save()
+}
+
+// Save writes the checkpoint file.
+func (c *Checkpoint) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.save()
+}
+
+// save writes the file through a temporary file, so an interrupted save
+// leaves the previous checkpoint intact.
+func (c *Checkpoint) save() error {
+	if c.state != nil {
+		state, err := json.Marshal(c.state)
+		if err != nil {
+			return err
+		}
+		c.State = state
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return err
+	}
+
+	c.saved = time.Now()
+	return nil
+}
+
+// Remove deletes the checkpoint file once the scan has completed.
+func (c *Checkpoint) Remove() error {
+	err := os.Remove(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,267 @@
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"gowithazure/src/config"
+	"gowithazure/src/scanner"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.checkpoint")
+	settings := map[string]string{"format": "csv"}
+
+	c := New(path, settings)
+	state := map[string]int{"blobs": 0}
+	if err := c.Track(&state); err != nil {
+		t.Fatal(err)
+	}
+	commit := func() error { state["blobs"] += 2; return nil }
+	if err := c.ContainerPage("https://a/", "c2", commit); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.BlobPage("https://a/", "c2", "b2", commit); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.BlobPage("https://a/", "c1", "", commit); err != nil {
+		t.Fatal(err)
+	}
+	c.Offset = 42
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path, settings)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	var loadedState map[string]int
+	if err := loaded.Track(&loadedState); err != nil {
+		t.Fatal(err)
+	}
+	if loadedState["blobs"] != 6 || loaded.Offset != 42 || loaded.Path() != path {
+		t.Errorf("loaded state %v, offset %d and path %s, want 6 blobs, 42 and %s", loadedState, loaded.Offset, loaded.Path(), path)
+	}
+	tests := []struct {
+		account, container, marker string
+		done                       bool
+	}{
+		{account: "https://a/", marker: "c2"},
+		{account: "https://a/", container: "c2", marker: "b2"},
+		{account: "https://a/", container: "c1", done: true},
+		{account: "https://a/", container: "c3"},
+		{account: "https://b/"},
+		{account: "https://b/", container: "c1"},
+	}
+	for _, test := range tests {
+		var marker string
+		var done bool
+		if test.container == "" {
+			marker, done = loaded.Account(test.account)
+		} else {
+			marker, done = loaded.Container(test.account, test.container)
+		}
+		if marker != test.marker || done != test.done {
+			t.Errorf("%s %s: marker %q, done %t, want %q, %t", test.account, test.container, marker, done, test.marker, test.done)
+		}
+	}
+
+	// The containers of an account are only forgotten once it is done.
+	if err := loaded.ContainerPage("https://a/", "", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, done := loaded.Account("https://a/"); !done {
+		t.Error("account not done after its last page")
+	}
+	if marker, done := loaded.Container("https://a/", "c2"); marker != "" || done {
+		t.Errorf("container progress kept after the account is done: %q, %t", marker, done)
+	}
+
+	if _, err := Load(path, map[string]string{"format": "parquet"}); err == nil || !strings.Contains(err.Error(), "different settings") {
+		t.Errorf("Load with other settings: %v, want a settings mismatch", err)
+	}
+	if err := loaded.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path, settings); err == nil || !strings.Contains(err.Error(), "no checkpoint") {
+		t.Errorf("Load after Remove: %v, want no checkpoint", err)
+	}
+	if err := loaded.Remove(); err != nil {
+		t.Errorf("removing a removed checkpoint: %v", err)
+	}
+}
+
+func TestCommitErrorKeepsThePreviousMarker(t *testing.T) {
+	c := New(filepath.Join(t.TempDir(), "scan.checkpoint"), nil)
+	if err := c.BlobPage("https://a/", "c1", "b2", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	failed := errors.New("disk full")
+	if err := c.BlobPage("https://a/", "c1", "b4", func() error { return failed }); !errors.Is(err, failed) {
+		t.Fatalf("BlobPage: %v, want the commit error", err)
+	}
+	if marker, _ := c.Container("https://a/", "c1"); marker != "b2" {
+		t.Errorf("marker %q after a failed commit, want b2", marker)
+	}
+}
+
+// pagedAccount is a storage account of containers c0 to c4 holding blobs b0
+// to b4 each, listed two at a time. The marker of a page is the name of its
+// first item.
+func pagedAccount(t *testing.T) *httptest.Server {
+	const items, pageSize = 5, 2
+	page := func(prefix, marker string) (names []string, nextMarker string) {
+		start := 0
+		if marker != "" {
+			var err error
+			if start, err = strconv.Atoi(strings.TrimPrefix(marker, prefix)); err != nil {
+				t.Errorf("unexpected marker %q", marker)
+			}
+		}
+		for i := start; i < min(start+pageSize, items); i++ {
+			names = append(names, fmt.Sprintf("%s%d", prefix, i))
+		}
+		if start+pageSize < items {
+			nextMarker = fmt.Sprintf("%s%d", prefix, start+pageSize)
+		}
+		return names, nextMarker
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("comp") != "list" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><EnumerationResults>`)
+		if query.Get("restype") != "container" {
+			names, next := page("c", query.Get("marker"))
+			fmt.Fprint(w, `<Containers>`)
+			for _, name := range names {
+				fmt.Fprintf(w, `<Container><Name>%s</Name><Properties><Etag>e</Etag></Properties></Container>`, name)
+			}
+			fmt.Fprintf(w, `</Containers><NextMarker>%s</NextMarker></EnumerationResults>`, next)
+			return
+		}
+		names, next := page("b", query.Get("marker"))
+		fmt.Fprint(w, `<Blobs>`)
+		for _, name := range names {
+			fmt.Fprintf(w, `<Blob><Name>%s</Name><Properties><Etag>e</Etag><Content-Length>1</Content-Length></Properties></Blob>`, name)
+		}
+		fmt.Fprintf(w, `</Blobs><NextMarker>%s</NextMarker></EnumerationResults>`, next)
+	}))
+}
+
+func TestResume(t *testing.T) {
+	server := pagedAccount(t)
+	defer server.Close()
+	account := config.Account{URL: server.URL + "/devstoreaccount1"}
+	path := filepath.Join(t.TempDir(), "scan.checkpoint")
+
+	// run scans the account from progress and returns the blobs it listed.
+	// The blobs of a page are committed to the tracked state with the page,
+	// so the state holds every blob exactly once however often the scan is
+	// interrupted; fail interrupts it on a blob.
+	run := func(progress *Checkpoint, fail string) ([]string, []string, error) {
+		var committed []string
+		if err := progress.Track(&committed); err != nil {
+			t.Fatal(err)
+		}
+		scan := scanner.New(2, func(account config.Account) (*azblob.Client, error) {
+			return azblob.NewClientWithNoCredential(account.URL, nil)
+		})
+		scan.ListContainers = &azblob.ListContainersOptions{MaxResults: to.Ptr[int32](2)}
+		scan.ListBlobs = &azblob.ListBlobsFlatOptions{MaxResults: to.Ptr[int32](2)}
+		scan.Progress = progress
+
+		var mu sync.Mutex
+		var listed []string
+		pending := make(map[string][]string)
+		err := scan.Scan(context.Background(), []config.Account{account}, scanner.Callbacks{
+			Blob: func(_ context.Context, _ *scanner.Account, containerName string, item *container.BlobItem) error {
+				name := containerName + "/" + *item.Name
+				mu.Lock()
+				defer mu.Unlock()
+				listed = append(listed, name)
+				if name == fail {
+					return errors.New("interrupted")
+				}
+				pending[containerName] = append(pending[containerName], name)
+				return nil
+			},
+			BlobPage: func(_ context.Context, _ *scanner.Account, containerName, _ string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				committed = append(committed, pending[containerName]...)
+				delete(pending, containerName)
+				return nil
+			},
+		})
+		slices.Sort(listed)
+		slices.Sort(committed)
+		return listed, committed, err
+	}
+
+	// The first run stops in the second page of containers, in the second
+	// page of blobs of c2.
+	interrupted := New(path, nil)
+	listed, _, err := run(interrupted, "c2/b3")
+	if err == nil {
+		t.Fatal("the interrupted scan succeeded")
+	}
+	if len(listed) != 24 {
+		t.Errorf("the first run listed %d blobs, want all but c2/b4", len(listed))
+	}
+	if err := interrupted.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	progress, err := Load(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marker, done := progress.Account(account.String()); marker != "c2" || done {
+		t.Errorf("account marker %q, done %t, want the page of c2", marker, done)
+	}
+	if marker, done := progress.Container(account.String(), "c2"); marker != "b2" || done {
+		t.Errorf("c2 marker %q, done %t, want the page of b2", marker, done)
+	}
+
+	// The resumed run lists the failed page of c2 and what follows only: c3
+	// and c4 were finished, and the pages before the markers are not listed
+	// again.
+	listed, committed, err := run(progress, "")
+	if err != nil {
+		t.Fatalf("resuming: %v", err)
+	}
+	if want := []string{"c2/b2", "c2/b3", "c2/b4"}; !slices.Equal(listed, want) {
+		t.Errorf("the resumed run listed %v, want %v", listed, want)
+	}
+	var all []string
+	for c := range 5 {
+		for b := range 5 {
+			all = append(all, fmt.Sprintf("c%d/b%d", c, b))
+		}
+	}
+	if !slices.Equal(committed, all) {
+		t.Errorf("committed %v, want every blob once", committed)
+	}
+	if _, done := progress.Account(account.String()); !done {
+		t.Error("the account is not done after the resumed run")
+	}
+}
@@ -0,0 +1,85 @@
+package cleanup
+
+import (
+	"encoding/json"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gowithazure/src/config"
+)
+
+// Entry is one line of the audit log: the outcome of deleting one container,
+// or the attempt to delete it that precedes that outcome.
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Profile  string    `json:"profile"`
+	User     string    `json:"user"`
+	PlanHash string    `json:"planHash,omitempty"`
+	Outcome
+}
+
+// Audit appends entries to the audit log, one JSON object per line. Each
+// entry is synced to disk before the next deletion is reported.
+type Audit struct {
+	mu       sync.Mutex
+	file     *os.File
+	profile  string
+	user     string
+	planHash string
+}
+
+// DefaultAuditPath is where the audit log is kept when no file is given:
+// cleanup-audit.jsonl in config.DataDir, shared by every profile.
+func DefaultAuditPath() (string, error) {
+	dir, err := config.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cleanup-audit.jsonl"), nil
+}
+
+// OpenAudit opens the audit log at path for appending, creating it if
+// needed. Entries record the profile, the local user and the hash of the
+// plan carried out, if any.
+func OpenAudit(path, profile, planHash string) (*Audit, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	name := os.Getenv("USER")
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	return &Audit{file: file, profile: profile, user: name, planHash: planHash}, nil
+}
+
+// Record writes the outcome of one deletion, or the attempt to delete.
+func (a *Audit) Record(outcome Outcome) error {
+	data, err := json.Marshal(Entry{
+		Time:     time.Now().UTC(),
+		Profile:  a.profile,
+		User:     a.user,
+		PlanHash: a.planHash,
+		Outcome:  outcome,
+	})
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+// Close closes the audit log.
+func (a *Audit) Close() error {
+	return a.file.Close()
+}
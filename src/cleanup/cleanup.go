@@ -0,0 +1,350 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gowithazure/src/config"
+	"gowithazure/src/evaluation"
+	"gowithazure/src/scanner"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/lease"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+)
+
+// Rules are the rules that select the containers to delete:
+//
+//	stale     -in and -out containers not modified for Options.OlderThan
+//	orphaned  the stale ones whose -out or -in counterpart does not exist
+//	empty     containers holding no blobs, not modified for Options.OlderThan
+var Rules = []string{"stale", "orphaned", "empty"}
+
+// The statuses of an Outcome. Attempting is reported just before a container
+// is deleted, and followed by its final status.
+const (
+	Attempting = "attempting"
+	Deleted    = "deleted"
+	Skipped    = "skipped"
+	Failed     = "failed"
+)
+
+// Outcome is what happened to one container of a plan.
+type Outcome struct {
+	Target
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Options select the containers of a plan, either by Rule or from Listed.
+type Options struct {
+	Rule      string
+	OlderThan time.Duration
+	// Listed holds, for each account by its position, the names of the
+	// containers to delete. Listed containers are taken whatever their age.
+	Listed []map[string]bool
+}
+
+// Select scans the storage accounts and returns the containers selected by
+// options, with their blobs counted. Containers that must be kept after all
+// have Skip set: those that are leased, under a legal hold or an
+// immutability policy, whose blobs could not all be listed, and listed
+// containers that do not exist. Orphans of an account whose listing failed
+// are skipped too, as their counterpart may exist unseen.
+func Select(ctx context.Context, scan *scanner.Scanner, accounts []config.Account, options Options) ([]Target, error) {
+	type key struct {
+		account   int
+		container string
+	}
+	var (
+		mu      sync.Mutex
+		targets = make(map[key]*Target)
+		names   = make([]map[string]bool, len(accounts))
+	)
+	for i := range names {
+		names[i] = make(map[string]bool)
+	}
+
+	listing := *scan
+	if options.Rule == "empty" {
+		// One blob is enough to tell a container is not empty.
+		listing.ListBlobs = &azblob.ListBlobsFlatOptions{MaxResults: to.Ptr(int32(1))}
+	}
+
+	now := time.Now()
+	err := listing.Scan(ctx, accounts, scanner.Callbacks{
+		Container: func(_ context.Context, account *scanner.Account, item *service.ContainerItem) error {
+			mu.Lock()
+			defer mu.Unlock()
+			name := *item.Name
+			names[account.Index][name] = true
+
+			var lastModified time.Time
+			if item.Properties != nil && item.Properties.LastModified != nil {
+				lastModified = *item.Properties.LastModified
+			}
+			age := now.Sub(lastModified)
+			old := !lastModified.IsZero() && age > options.OlderThan
+
+			var reason string
+			switch {
+			case options.Listed != nil:
+				if options.Listed[account.Index][name] {
+					reason = "listed"
+				}
+			case options.Rule == "empty":
+				if old {
+					reason = "empty"
+				}
+			default:
+				if direction := evaluation.Direction(name); direction != "" && old {
+					reason = "stale -" + direction
+				}
+			}
+			if reason == "" {
+				return scanner.SkipContainer
+			}
+
+			target := &Target{
+				Account:      account.URL,
+				Name:         name,
+				LastModified: lastModified,
+				Reason:       reason,
+				Skip:         held(item.Properties),
+			}
+			if !lastModified.IsZero() {
+				target.AgeDays = int(age / (24 * time.Hour))
+			}
+			targets[key{account.Index, name}] = target
+			return nil
+		},
+		Blob: func(_ context.Context, account *scanner.Account, containerName string, item *container.BlobItem) error {
+			mu.Lock()
+			defer mu.Unlock()
+			target := targets[key{account.Index, containerName}]
+			target.Blobs++
+			if item.Properties != nil && item.Properties.ContentLength != nil {
+				target.Bytes += *item.Properties.ContentLength
+			}
+			if options.Rule == "empty" {
+				target.Skip = "not empty"
+				return scanner.SkipContainer
+			}
+			return nil
+		},
+		ContainerDone: func(account *scanner.Account, containerName string, err error) {
+			if err == nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if target := targets[key{account.Index, containerName}]; target != nil && target.Skip == "" {
+				target.Skip = "could not list its blobs: " + config.Redact(err.Error())
+			}
+		},
+	})
+
+	var selected []*Target
+	for k, target := range targets {
+		if options.Rule == "orphaned" {
+			counterpart := evaluation.Counterpart(target.Name)
+			if names[k.account][counterpart] {
+				continue
+			}
+			target.Reason += ", no " + counterpart
+			if target.Skip == "" && scanner.Message(err, k.account) != "" {
+				target.Skip = "the account could not be listed completely, " + counterpart + " may exist"
+			}
+		}
+		if options.Rule == "empty" && target.Skip == "not empty" {
+			continue
+		}
+		selected = append(selected, target)
+	}
+	for i, listed := range options.Listed {
+		for name := range listed {
+			if !names[i][name] {
+				skip := "not found"
+				if scanner.Message(err, i) != "" {
+					skip = "not found, the account could not be listed completely"
+				}
+				selected = append(selected, &Target{Account: accounts[i].String(), Name: name, Reason: "listed", Skip: skip})
+			}
+		}
+	}
+
+	index := make(map[string]int, len(accounts))
+	for i, account := range accounts {
+		index[account.String()] = i
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		if a, b := index[selected[i].Account], index[selected[j].Account]; a != b {
+			return a < b
+		}
+		return selected[i].Name < selected[j].Name
+	})
+	result := make([]Target, len(selected))
+	for i, target := range selected {
+		result[i] = *target
+	}
+	return result, err
+}
+
+// Delete deletes the containers of the plan that are not skipped, as many at
+// once as scan.Workers allows, and calls fn with the outcome of every
+// container of the plan, never concurrently. fn is also called with an
+// Attempting outcome right before each deletion is sent, so a deletion that
+// never reports back is still on record. An error from fn, such as a failure
+// to record the outcome, stops the deletions; one for an Attempting outcome
+// leaves that container alone. Each container is checked again first: it is
+// skipped when it was modified since the plan, has since been leased or put
+// under a hold, or was planned empty and no longer is. The deletion itself is
+// conditional on the container not being modified in between.
+func Delete(ctx context.Context, scan *scanner.Scanner, accounts []config.Account, targets []Target, fn func(Outcome) error) error {
+	byURL := make(map[string]int, len(accounts))
+	for i, account := range accounts {
+		byURL[account.String()] = i
+	}
+	clients := make([]*azblob.Client, len(accounts))
+	connectErrs := make([]error, len(accounts))
+	for i, account := range accounts {
+		clients[i], connectErrs[i] = scan.Connect(account)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu        sync.Mutex
+		reportErr error
+	)
+	report := func(outcome Outcome) error {
+		mu.Lock()
+		defer mu.Unlock()
+		err := fn(outcome)
+		if err != nil && reportErr == nil {
+			reportErr = err
+			cancel()
+		}
+		return err
+	}
+
+	workers := scan.Workers
+	if workers <= 0 {
+		workers = scan.Concurrency
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				outcome := Outcome{Target: targets[i]}
+				account, ok := byURL[outcome.Account]
+				switch {
+				case outcome.Skip != "":
+					outcome.Status = Skipped
+				case !ok:
+					outcome.Status, outcome.Error = Failed, "the storage account is not selected"
+				case connectErrs[account] != nil:
+					outcome.Status, outcome.Error = Failed, config.Redact(connectErrs[account].Error())
+				default:
+					attempting := func() error {
+						return report(Outcome{Target: outcome.Target, Status: Attempting})
+					}
+					if !deleteContainer(ctx, clients[account], &outcome, attempting) {
+						continue
+					}
+				}
+				report(outcome)
+			}
+		}()
+	}
+	for i := range targets {
+		if ctx.Err() != nil {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	if reportErr != nil {
+		return reportErr
+	}
+	return ctx.Err()
+}
+
+// deleteContainer checks a container against its plan and deletes it,
+// calling attempting right before the deletion is sent. It returns false,
+// leaving the container alone, when attempting fails.
+func deleteContainer(ctx context.Context, client *azblob.Client, outcome *Outcome, attempting func() error) bool {
+	containerClient := client.ServiceClient().NewContainerClient(outcome.Name)
+	props, err := containerClient.GetProperties(ctx, nil)
+	if err != nil {
+		outcome.Status, outcome.Error = Failed, config.Redact(err.Error())
+		return true
+	}
+	if skip := held(&service.ContainerProperties{
+		LeaseState:            props.LeaseState,
+		LeaseStatus:           props.LeaseStatus,
+		HasLegalHold:          props.HasLegalHold,
+		HasImmutabilityPolicy: props.HasImmutabilityPolicy,
+	}); skip != "" {
+		outcome.Status, outcome.Skip = Skipped, skip
+		return true
+	}
+	if props.LastModified != nil && !outcome.LastModified.IsZero() && !props.LastModified.Equal(outcome.LastModified) {
+		outcome.Status, outcome.Skip = Skipped, fmt.Sprintf("modified since the plan, at %s", props.LastModified.UTC().Format(time.RFC3339))
+		return true
+	}
+	if outcome.Blobs == 0 {
+		// Writing blobs does not change the container's Last-Modified.
+		page, err := containerClient.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{MaxResults: to.Ptr(int32(1))}).NextPage(ctx)
+		if err != nil {
+			outcome.Status, outcome.Error = Failed, config.Redact(err.Error())
+			return true
+		}
+		if page.Segment != nil && len(page.Segment.BlobItems) > 0 {
+			outcome.Status, outcome.Skip = Skipped, "no longer empty"
+			return true
+		}
+	}
+
+	options := &container.DeleteOptions{}
+	if !outcome.LastModified.IsZero() {
+		options.AccessConditions = &container.AccessConditions{
+			ModifiedAccessConditions: &container.ModifiedAccessConditions{IfUnmodifiedSince: &outcome.LastModified},
+		}
+	}
+	if err := attempting(); err != nil {
+		return false
+	}
+	if _, err := containerClient.Delete(ctx, options); err != nil {
+		outcome.Status, outcome.Error = Failed, config.Redact(err.Error())
+		return true
+	}
+	outcome.Status = Deleted
+	return true
+}
+
+// held says why a container must not be deleted, or returns "".
+func held(props *service.ContainerProperties) string {
+	if props == nil {
+		return ""
+	}
+	switch {
+	case props.LeaseStatus != nil && *props.LeaseStatus == lease.StatusTypeLocked,
+		props.LeaseState != nil && (*props.LeaseState == lease.StateTypeLeased || *props.LeaseState == lease.StateTypeBreaking):
+		return "leased"
+	case props.HasLegalHold != nil && *props.HasLegalHold:
+		return "legal hold"
+	case props.HasImmutabilityPolicy != nil && *props.HasImmutabilityPolicy:
+		return "immutability policy"
+	}
+	return ""
+}
@@ -0,0 +1,367 @@
+package cleanup
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gowithazure/src/config"
+	"gowithazure/src/scanner"
+	"gowithazure/src/storage"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+)
+
+// old is the last modification time of the containers left alone for long.
+var old = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// fakeContainer is a container of the fake storage account.
+type fakeContainer struct {
+	lastModified time.Time
+	blobs        int
+	leased       bool
+	legalHold    bool
+}
+
+// fakeAccount is a storage account answering container listings, container
+// properties, blob listings and container deletions.
+type fakeAccount struct {
+	t *testing.T
+
+	mu         sync.Mutex
+	containers map[string]*fakeContainer
+	deleted    []string
+	inFlight   int
+	maxFlight  int
+}
+
+func (f *fakeAccount) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	name := strings.TrimPrefix(r.URL.Path, "/devstoreaccount1/")
+	switch {
+	case r.URL.Path == "/devstoreaccount1" && query.Get("comp") == "list":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		names := make([]string, 0, len(f.containers))
+		for name := range f.containers {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Containers>`)
+		for _, name := range names {
+			c := f.containers[name]
+			fmt.Fprintf(w, `<Container><Name>%s</Name><Properties><Last-Modified>%s</Last-Modified><Etag>e</Etag>`+
+				`<LeaseStatus>%s</LeaseStatus><LeaseState>%s</LeaseState><HasImmutabilityPolicy>false</HasImmutabilityPolicy>`+
+				`<HasLegalHold>%t</HasLegalHold></Properties></Container>`,
+				name, c.lastModified.Format(http.TimeFormat), c.leaseStatus(), c.leaseState(), c.legalHold)
+		}
+		fmt.Fprint(w, `</Containers><NextMarker/></EnumerationResults>`)
+	case query.Get("restype") == "container" && query.Get("comp") == "list":
+		c := f.container(w, name)
+		if c == nil {
+			return
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Blobs>`)
+		for i := range c.blobs {
+			fmt.Fprintf(w, `<Blob><Name>b%d</Name><Properties><Last-Modified>%s</Last-Modified><Etag>0x1</Etag>`+
+				`<Content-Length>100</Content-Length><BlobType>BlockBlob</BlobType></Properties></Blob>`, i, old.Format(http.TimeFormat))
+		}
+		fmt.Fprint(w, `</Blobs><NextMarker/></EnumerationResults>`)
+	case r.Method == http.MethodGet && query.Get("restype") == "container":
+		c := f.container(w, name)
+		if c == nil {
+			return
+		}
+		w.Header().Set("Last-Modified", c.lastModified.Format(http.TimeFormat))
+		w.Header().Set("x-ms-lease-status", c.leaseStatus())
+		w.Header().Set("x-ms-lease-state", c.leaseState())
+		w.Header().Set("x-ms-has-legal-hold", fmt.Sprint(c.legalHold))
+		w.Header().Set("x-ms-has-immutability-policy", "false")
+	case r.Method == http.MethodDelete && query.Get("restype") == "container":
+		if c := f.container(w, name); c == nil {
+			return
+		}
+		if r.Header.Get("If-Unmodified-Since") == "" {
+			f.t.Errorf("deleting %s without If-Unmodified-Since", name)
+		}
+		f.mu.Lock()
+		f.inFlight++
+		f.maxFlight = max(f.maxFlight, f.inFlight)
+		f.mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		f.mu.Lock()
+		f.inFlight--
+		f.deleted = append(f.deleted, name)
+		delete(f.containers, name)
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// container returns the container name, or answers 404 and returns nil.
+func (f *fakeAccount) container(w http.ResponseWriter, name string) *fakeContainer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.containers[name]
+	if c == nil {
+		w.Header().Set("x-ms-error-code", "ContainerNotFound")
+		w.WriteHeader(http.StatusNotFound)
+	}
+	return c
+}
+
+func (c *fakeContainer) leaseStatus() string {
+	if c.leased {
+		return "locked"
+	}
+	return "unlocked"
+}
+
+func (c *fakeContainer) leaseState() string {
+	if c.leased {
+		return "leased"
+	}
+	return "available"
+}
+
+// newFakeAccount starts a fake storage account holding containers.
+func newFakeAccount(t *testing.T, containers map[string]*fakeContainer) (config.Account, *scanner.Scanner, *fakeAccount) {
+	fake := &fakeAccount{t: t, containers: containers}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	account := config.Account{URL: server.URL + "/devstoreaccount1", AccountKey: "c2VjcmV0a2V5"}
+	scan := scanner.New(2, func(account config.Account) (*azblob.Client, error) { return storage.NewClient(account, nil) })
+	return account, scan, fake
+}
+
+func TestSelect(t *testing.T) {
+	containers := func() map[string]*fakeContainer {
+		return map[string]*fakeContainer{
+			"job1-in":    {lastModified: old, blobs: 2},
+			"job1-out":   {lastModified: old, blobs: 1},
+			"job2-in":    {lastModified: old, blobs: 1},
+			"job3-out":   {lastModified: old, leased: true},
+			"job4-in":    {lastModified: time.Now().UTC()},
+			"empty-old":  {lastModified: old},
+			"empty-held": {lastModified: old, legalHold: true},
+			"empty-new":  {lastModified: time.Now().UTC()},
+			"full-old":   {lastModified: old, blobs: 3},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		options Options
+		// want maps the selected containers to their reason and skip.
+		want map[string]string
+	}{
+		{
+			name:    "stale",
+			options: Options{Rule: "stale", OlderThan: 7 * 24 * time.Hour},
+			want: map[string]string{
+				"job1-in":  "stale -in|",
+				"job1-out": "stale -out|",
+				"job2-in":  "stale -in|",
+				"job3-out": "stale -out|leased",
+			},
+		},
+		{
+			name:    "orphaned",
+			options: Options{Rule: "orphaned", OlderThan: 7 * 24 * time.Hour},
+			want: map[string]string{
+				"job2-in":  "stale -in, no job2-out|",
+				"job3-out": "stale -out, no job3-in|leased",
+			},
+		},
+		{
+			name:    "empty",
+			options: Options{Rule: "empty", OlderThan: 7 * 24 * time.Hour},
+			want: map[string]string{
+				"empty-old":  "empty|",
+				"empty-held": "empty|legal hold",
+				"job3-out":   "empty|leased",
+			},
+		},
+		{
+			name:    "listed",
+			options: Options{Listed: []map[string]bool{{"job4-in": true, "missing": true}}},
+			want: map[string]string{
+				"job4-in": "listed|",
+				"missing": "listed|not found",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			account, scan, _ := newFakeAccount(t, containers())
+			targets, err := Select(context.Background(), scan, []config.Account{account}, test.options)
+			if err != nil {
+				t.Fatalf("Select: %v", err)
+			}
+			got := make(map[string]string)
+			var names []string
+			for _, target := range targets {
+				got[target.Name] = target.Reason + "|" + target.Skip
+				names = append(names, target.Name)
+			}
+			if len(got) != len(test.want) {
+				t.Errorf("selected %v, want %v", got, test.want)
+			}
+			for name, want := range test.want {
+				if got[name] != want {
+					t.Errorf("%s: got %q, want %q", name, got[name], want)
+				}
+			}
+			if !slices.IsSorted(names) {
+				t.Errorf("targets %v are not sorted by name", names)
+			}
+		})
+	}
+}
+
+func TestSelectCountsBlobs(t *testing.T) {
+	account, scan, _ := newFakeAccount(t, map[string]*fakeContainer{"job1-in": {lastModified: old, blobs: 3}})
+	targets, err := Select(context.Background(), scan, []config.Account{account}, Options{Rule: "stale", OlderThan: time.Hour})
+	if err != nil {
+		t.Fatalf("Select: %v", err)
+	}
+	if len(targets) != 1 || targets[0].Blobs != 3 || targets[0].Bytes != 300 || !targets[0].LastModified.Equal(old) {
+		t.Errorf("got %+v, want job1-in with 3 blobs of 100 bytes", targets)
+	}
+}
+
+func TestPlanHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	plan := &Plan{Profile: "dev", Selection: "rule orphaned", Containers: []Target{{Account: "https://a.blob.core.windows.net/", Name: "job2-in"}}}
+	hash, err := plan.Save(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadPlan(path, hash)
+	if err != nil {
+		t.Fatalf("LoadPlan with the hash of Save: %v", err)
+	}
+	if len(loaded.Containers) != 1 || loaded.Containers[0].Name != "job2-in" {
+		t.Errorf("loaded %+v, want the saved plan", loaded)
+	}
+
+	if _, err := LoadPlan(path, strings.Repeat("0", len(hash))); err == nil {
+		t.Error("LoadPlan accepted a wrong hash")
+	}
+	data, _ := os.ReadFile(path)
+	if err := os.WriteFile(path, []byte(strings.Replace(string(data), "job2-in", "job9-in", 1)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPlan(path, hash); err == nil {
+		t.Error("LoadPlan accepted a plan edited since it was saved")
+	}
+}
+
+func TestDelete(t *testing.T) {
+	containers := map[string]*fakeContainer{
+		"modified": {lastModified: old.Add(time.Hour)},
+		"leased":   {lastModified: old, leased: true},
+		"refilled": {lastModified: old, blobs: 1},
+		"skipped":  {lastModified: old},
+	}
+	targets := []Target{
+		{Name: "modified", LastModified: old},
+		{Name: "leased", LastModified: old},
+		{Name: "refilled", LastModified: old},
+		{Name: "skipped", LastModified: old, Skip: "legal hold"},
+		{Name: "gone", LastModified: old},
+	}
+	var deletions []string
+	for i := range 6 {
+		name := fmt.Sprintf("empty%d", i)
+		containers[name] = &fakeContainer{lastModified: old}
+		targets = append(targets, Target{Name: name, LastModified: old})
+		deletions = append(deletions, name)
+	}
+	account, scan, fake := newFakeAccount(t, containers)
+	scan.Workers = 2
+	for i := range targets {
+		targets[i].Account = account.String()
+	}
+
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, err := OpenAudit(auditPath, "dev", "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Delete(context.Background(), scan, []config.Account{account}, targets, audit.Record); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	audit.Close()
+
+	slices.Sort(fake.deleted)
+	if !slices.Equal(fake.deleted, deletions) {
+		t.Errorf("deleted %v, want %v", fake.deleted, deletions)
+	}
+	if fake.maxFlight > 2 {
+		t.Errorf("%d deletions ran at once, want at most the 2 workers", fake.maxFlight)
+	}
+
+	// Every container has one final entry, and those deleted an attempting
+	// entry before it.
+	file, err := os.Open(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	entries := make(map[string][]string)
+	lines := bufio.NewScanner(file)
+	for lines.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(lines.Bytes(), &entry); err != nil {
+			t.Fatalf("audit line %q: %v", lines.Text(), err)
+		}
+		if entry.Profile != "dev" || entry.PlanHash != "abc" || entry.Time.IsZero() {
+			t.Errorf("audit entry %+v, want the profile, plan hash and time", entry)
+		}
+		entries[entry.Name] = append(entries[entry.Name], entry.Status)
+	}
+	want := map[string][]string{
+		"modified": {Skipped},
+		"leased":   {Skipped},
+		"refilled": {Skipped},
+		"skipped":  {Skipped},
+		"gone":     {Failed},
+	}
+	for _, name := range deletions {
+		want[name] = []string{Attempting, Deleted}
+	}
+	for name, statuses := range want {
+		if !slices.Equal(entries[name], statuses) {
+			t.Errorf("%s: audit statuses %v, want %v", name, entries[name], statuses)
+		}
+	}
+}
+
+func TestDeleteStopsWhenTheAttemptCannotBeRecorded(t *testing.T) {
+	account, scan, fake := newFakeAccount(t, map[string]*fakeContainer{"empty": {lastModified: old}})
+	scan.Workers = 1
+	err := Delete(context.Background(), scan, []config.Account{account}, []Target{{Account: account.String(), Name: "empty", LastModified: old}}, func(o Outcome) error {
+		if o.Status == Attempting {
+			return fmt.Errorf("disk full")
+		}
+		return nil
+	})
+	if err == nil || len(fake.deleted) != 0 {
+		t.Errorf("got %v and deleted %v, want the error and nothing deleted", err, fake.deleted)
+	}
+}
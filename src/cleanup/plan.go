@@ -0,0 +1,87 @@
+// Package cleanup deletes containers that are no longer needed, such as the
+// stale and orphaned -in and -out containers of the video pipeline or empty
+// containers, with safeguards: every deletion is planned first, containers
+// that are leased or held are left alone, and every outcome is written to an
+// audit log.
+package cleanup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Plan is the list of containers a cleanup deletes. Written to a file, it can
+// be reviewed and then carried out with its hash, so exactly what was
+// reviewed gets deleted.
+type Plan struct {
+	Created time.Time `json:"created"`
+	Profile string    `json:"profile"`
+	// Selection says how the containers were selected: a rule or a list.
+	Selection  string   `json:"selection"`
+	Containers []Target `json:"containers"`
+}
+
+// Target is one container of a plan.
+type Target struct {
+	Account      string    `json:"account"`
+	Name         string    `json:"name"`
+	LastModified time.Time `json:"lastModified"`
+	AgeDays      int       `json:"ageDays"`
+	Blobs        int64     `json:"blobs"`
+	Bytes        int64     `json:"bytes"`
+	// Reason says why the container was selected.
+	Reason string `json:"reason"`
+	// Skip, when set, says why the container is kept after all.
+	Skip string `json:"skip,omitempty"`
+}
+
+// Deletions returns the containers of the plan that are not skipped.
+func (p *Plan) Deletions() []Target {
+	var deletions []Target
+	for _, target := range p.Containers {
+		if target.Skip == "" {
+			deletions = append(deletions, target)
+		}
+	}
+	return deletions
+}
+
+// Save writes the plan to path and returns its hash.
+func (p *Plan) Save(path string) (string, error) {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", err
+	}
+	return Hash(data), nil
+}
+
+// LoadPlan reads the plan at path, which must have the hash given when it was
+// saved: a plan edited since it was reviewed is refused.
+func LoadPlan(path, hash string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if actual := Hash(data); actual != hash {
+		return nil, fmt.Errorf("plan %s has hash %s, not %s: it changed since it was written, or the hash is wrong", path, actual, hash)
+	}
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("reading plan %s: %w", path, err)
+	}
+	return &plan, nil
+}
+
+// Hash returns the SHA-256 of a plan file in hex.
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"gowithazure/src/utility"
+)
+
+// parseAge parses the value of an age flag: a number of days ("30d") or
+// weeks ("8w"), or a Go duration ("36h").
+func parseAge(flag, value string) (time.Duration, error) {
+	invalid := utility.New(utility.KindUsage, "invalid %s %q, expected a number of days or weeks such as 30d or 8w", flag, value)
+	switch unit := value[max(len(value)-1, 0):]; unit {
+	case "d", "w":
+		n, err := strconv.Atoi(strings.TrimSuffix(value, unit))
+		if err != nil || n < 0 {
+			return 0, invalid
+		}
+		age := time.Duration(n) * 24 * time.Hour
+		if unit == "w" {
+			age *= 7
+		}
+		return age, nil
+	default:
+		age, err := time.ParseDuration(value)
+		if err != nil || age < 0 {
+			return 0, invalid
+		}
+		return age, nil
+	}
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"gowithazure/src/evaluation"
+	"gowithazure/src/report"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// backlogOlderThan is how long a container must go unmodified to be in
+	// the backlog.
+	backlogOlderThan string
+	// backlogOrphans only lists the containers whose counterpart is missing.
+	backlogOrphans bool
+)
+
+var backlogCmd = &cobra.Command{
+	Use:   "backlog",
+	Short: "List the stale -in and -out video containers with their size and counterpart",
+	Long: `List every -in and -out container not modified for --older-than (7 days by default) in
+each storage account: the containers evaluate only counts. For each one it reports its age,
+the number and total size of its blobs, and whether its counterpart exists: the -out
+container of an input or the -in container of an output, whatever its age. An input without
+its output, or an output without its input, is orphaned; --orphans lists only those. When
+the containers of an account could not all be listed, a counterpart that was not seen may
+still exist: it is reported as unknown, and such containers are not counted as orphaned. A
+container whose blobs could not be listed does not make the others unknown.
+
+Use -o csv to export the list, for instance for a cleanup ticket.`,
+	Example: `  gowithazure backlog -p us-prod
+  gowithazure backlog -p us-prod --orphans -o csv > backlog.csv`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		_, err := parseAge("--older-than", backlogOlderThan)
+		return err
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selectedAccounts, err := storageAccounts()
+		if err != nil {
+			return err
+		}
+
+		olderThan, _ := parseAge("--older-than", backlogOlderThan)
+		backlog, scanErr := evaluation.Backlog(cmd.Context(), newScanner(), selectedAccounts, olderThan)
+		if backlogOrphans {
+			orphans := backlog[:0]
+			for _, c := range backlog {
+				if c.Orphaned() {
+					orphans = append(orphans, c)
+				}
+			}
+			backlog = orphans
+		}
+
+		var bytes int64
+		var orphanedIn, orphanedOut int
+		for _, c := range backlog {
+			bytes += c.Bytes
+			if c.Orphaned() && c.Direction == "in" {
+				orphanedIn++
+			} else if c.Orphaned() {
+				orphanedOut++
+			}
+		}
+
+		err = render(cmd.OutOrStdout(), backlog, func(w io.Writer) {
+			account := ""
+			for _, c := range backlog {
+				if c.Account != account {
+					account = c.Account
+					fmt.Fprintf(w, "Storage account: %s\n", account)
+				}
+				counterpart := "has " + c.Counterpart
+				switch {
+				case c.CounterpartUnknown:
+					counterpart = "unknown, " + c.Counterpart + " not seen"
+				case !c.CounterpartExists:
+					counterpart = "orphaned, no " + c.Counterpart
+				}
+				fmt.Fprintf(w, "  %-50s %5d days %10d blobs %12s  %s\n", c.Name, c.AgeDays, c.Blobs, report.Bytes(c.Bytes), counterpart)
+				if c.Error != "" {
+					fmt.Fprintf(w, "    incomplete: %s\n", c.Error)
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		summary := cmd.ErrOrStderr()
+		if output == "text" {
+			summary = cmd.OutOrStdout()
+		}
+		fmt.Fprintf(summary, "%d stale containers holding %s, %d inputs without output and %d outputs without input\n",
+			len(backlog), report.Bytes(bytes), orphanedIn, orphanedOut)
+
+		return scanErr
+	},
+}
+
+func init() {
+	flags := backlogCmd.Flags()
+	flags.StringVar(&backlogOlderThan, "older-than", "7d", "list containers not modified for this long, such as 7d or 2w")
+	flags.BoolVar(&backlogOrphans, "orphans", false, "only list containers whose -in or -out counterpart does not exist")
+	rootCmd.AddCommand(backlogCmd)
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"gowithazure/src/report"
+	"gowithazure/src/storage"
+	"gowithazure/src/utility"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// capacityOptions are the flags of the capacity command.
+	capacityOptions storage.CapacityOptions
+	// capacityIdle is how long hot data must go unused to be reported as idle.
+	capacityIdle string
+)
+
+var capacityCmd = &cobra.Command{
+	Use:   "capacity",
+	Short: "Break down the storage used per container, access tier, blob type and prefix",
+	Long: `Sum the size of every blob of each storage account per container, per access tier
+(Hot, Cool, Cold, Archive), per blob type and per prefix, and list the largest containers,
+prefixes and blobs. Hot blobs that were not accessed, or modified when the account
+doesn't track access, for --idle are reported as idle. Run it before tier to see where
+the storage spend goes.
+
+A prefix is the container name followed by the first --prefix-depth folders of the blob
+name, so with the default depth of 1 "videos/2024/01/a.mp4" counts towards "videos/2024/".`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if capacityOptions.Top < 0 || capacityOptions.Largest < 0 || capacityOptions.PrefixDepth < 0 {
+			return utility.New(utility.KindUsage, "--top, --largest and --prefix-depth cannot be negative")
+		}
+		var err error
+		capacityOptions.IdleFor, err = parseAge("--idle", capacityIdle)
+		return err
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selectedAccounts, err := storageAccounts()
+		if err != nil {
+			return err
+		}
+
+		results, scanErr := storage.Capacity(cmd.Context(), newScanner(), selectedAccounts, capacityOptions)
+
+		err = render(cmd.OutOrStdout(), results, func(w io.Writer) {
+			var totalBlobs, totalBytes int64
+			for _, result := range results {
+				fmt.Fprintf(w, "Storage account: %s\n", result.URL)
+				if result.Error != "" {
+					fmt.Fprintf(w, "  Error: %s\n", result.Error)
+				}
+				fmt.Fprintf(w, "  Total: %s in %d blobs\n", report.Bytes(result.Bytes), result.Blobs)
+				printSizes(w, "By access tier", result.ByTier, result.Bytes)
+				fmt.Fprintf(w, "  Hot data idle for %s: %s in %d blobs\n", capacityIdle, report.Bytes(result.IdleHot.Bytes), result.IdleHot.Blobs)
+				printSizes(w, "By blob type", result.ByBlobType, result.Bytes)
+
+				fmt.Fprintln(w, "  Largest containers:")
+				for _, container := range result.Containers {
+					fmt.Fprintf(w, "    %-40s %10s %5.1f%%  %d blobs\n", container.Name, report.Bytes(container.Bytes), percent(container.Bytes, result.Bytes), container.Blobs)
+					if container.Error != "" {
+						fmt.Fprintf(w, "      incomplete: %s\n", container.Error)
+					}
+				}
+				printSizes(w, "Largest prefixes", result.ByPrefix, result.Bytes)
+
+				if len(result.LargestBlobs) > 0 {
+					fmt.Fprintln(w, "  Largest blobs:")
+					for _, blob := range result.LargestBlobs {
+						fmt.Fprintf(w, "    %-60s %10s  %s\n", blob.Container+"/"+blob.Name, report.Bytes(blob.Bytes), blob.Tier)
+					}
+				}
+				totalBlobs += result.Blobs
+				totalBytes += result.Bytes
+			}
+			fmt.Fprintf(w, "Total: %s in %d blobs\n", report.Bytes(totalBytes), totalBlobs)
+		})
+		if err != nil {
+			return err
+		}
+
+		return scanErr
+	},
+}
+
+// printSizes writes one line per group with its share of total.
+func printSizes(w io.Writer, title string, sizes []storage.Size, total int64) {
+	fmt.Fprintf(w, "  %s:\n", title)
+	for _, size := range sizes {
+		key := size.Key
+		if key == "" {
+			key = "(none)"
+		}
+		fmt.Fprintf(w, "    %-40s %10s %5.1f%%  %d blobs\n", key, report.Bytes(size.Bytes), percent(size.Bytes, total), size.Blobs)
+	}
+}
+
+// percent returns part as a percentage of total.
+func percent(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(total)
+}
+
+func init() {
+	flags := capacityCmd.Flags()
+	flags.IntVar(&capacityOptions.Top, "top", 10, "number of largest containers and prefixes to list per account, 0 for all")
+	flags.IntVar(&capacityOptions.Largest, "largest", 10, "number of largest blobs to list per account")
+	flags.IntVar(&capacityOptions.PrefixDepth, "prefix-depth", 1, "number of folders of the blob name that make up its prefix")
+	flags.StringVar(&capacityIdle, "idle", "30d", "how long hot blobs must go without being accessed to be reported as idle")
+	flags.BoolVar(&capacityOptions.Versions, "versions", false, "include previous versions of blobs")
+	flags.BoolVar(&capacityOptions.Snapshots, "snapshots", false, "include blob snapshots")
+	rootCmd.AddCommand(capacityCmd)
+}
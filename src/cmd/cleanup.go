@@ -0,0 +1,326 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gowithazure/src/cleanup"
+	"gowithazure/src/config"
+	"gowithazure/src/report"
+	"gowithazure/src/utility"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// cleanupRule selects the containers to delete by rule.
+	cleanupRule string
+	// cleanupList is a file naming the containers to delete.
+	cleanupList string
+	// cleanupOlderThan is how long a container must go unmodified to be
+	// selected by a rule.
+	cleanupOlderThan string
+	// cleanupDryRun shows the plan without deleting anything.
+	cleanupDryRun bool
+	// cleanupPlan is the plan file to write, or to carry out with
+	// cleanupPlanHash.
+	cleanupPlan     string
+	cleanupPlanHash string
+	// cleanupAudit is the audit log.
+	cleanupAudit string
+)
+
+var cleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Delete stale, orphaned or empty containers from a reviewed plan",
+	Long: `Delete the containers selected by a --rule or named in a --list file, in three steps:
+
+1. Plan: the storage accounts are scanned and every selected container is shown with its
+   age, blobs and size. Containers that are leased, under a legal hold or an immutability
+   policy, or whose blobs could not all be listed, are kept and shown as skipped.
+2. Confirm: the plan is confirmed interactively, or written to a file with --plan, which
+   prints its hash. Review the file, then carry it out with --plan and --plan-hash: a plan
+   that changed since it was written is refused.
+3. Delete: each container is checked again and skipped if it was modified since the plan,
+   has been leased or held since, or was planned empty and is not anymore. The others are
+   deleted, --workers at a time.
+
+The rules are:
+
+- stale: -in and -out containers not modified for --older-than (7 days by default), the
+  containers listed by backlog;
+- orphaned: the stale containers whose counterpart does not exist, as backlog --orphans;
+- empty: containers holding no blobs, not modified for --older-than, as counted by empty.
+
+A --list file has one container per line: a container URL, or a container name when a single
+account is selected. Empty lines and lines starting with # are skipped. The CSV written by
+backlog -o csv is read as well. Listed containers are deleted whatever their age.
+
+Every outcome, deleted, skipped or failed, is appended to the audit log with the time, the
+profile, the local user and the plan hash: cleanup-audit.jsonl in $XDG_DATA_HOME/gowithazure
+unless --audit is given. An attempting entry is written before each deletion is sent, so a
+deletion cut short by a crash is still on record, and nothing is deleted when it cannot be
+written. With container soft delete enabled on the account, deleted
+containers can be restored with deleted restore while its retention lasts.`,
+	Example: `  gowithazure cleanup -p us-prod --rule orphaned --older-than 30d --dry-run
+  gowithazure cleanup -p us-prod --rule orphaned --older-than 30d --plan orphans.json
+  gowithazure cleanup -p us-prod --plan orphans.json --plan-hash 3f2a...
+  gowithazure backlog -p us-prod --orphans -o csv > orphans.csv
+  gowithazure cleanup -p us-prod --list orphans.csv`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if cleanupPlanHash != "" {
+			if cleanupPlan == "" {
+				return utility.New(utility.KindUsage, "--plan-hash needs the --plan it is the hash of")
+			}
+			if cleanupRule != "" || cleanupList != "" || cleanupDryRun {
+				return utility.New(utility.KindUsage, "--plan-hash carries out a plan, it cannot be combined with --rule, --list or --dry-run")
+			}
+			return nil
+		}
+		if (cleanupRule == "") == (cleanupList == "") {
+			return utility.New(utility.KindUsage, "pass either --rule or --list, or --plan with --plan-hash")
+		}
+		if cleanupRule != "" {
+			var err error
+			if cleanupRule, err = choose("--rule", cleanupRule, cleanup.Rules); err != nil {
+				return err
+			}
+		}
+		_, err := parseAge("--older-than", cleanupOlderThan)
+		return err
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selectedAccounts, err := storageAccounts()
+		if err != nil {
+			return err
+		}
+
+		if cleanupPlanHash != "" {
+			hash := strings.ToLower(cleanupPlanHash)
+			plan, err := cleanup.LoadPlan(cleanupPlan, hash)
+			if err != nil {
+				return utility.WithKind(utility.KindUsage, err)
+			}
+			if plan.Profile != profileName {
+				return utility.New(utility.KindUsage, "plan %s was made for profile %s, not %s", cleanupPlan, plan.Profile, profileName)
+			}
+			return deleteContainers(cmd, selectedAccounts, plan, hash)
+		}
+
+		options := cleanup.Options{Rule: cleanupRule}
+		options.OlderThan, _ = parseAge("--older-than", cleanupOlderThan)
+		selection := fmt.Sprintf("rule %s, older than %s", cleanupRule, cleanupOlderThan)
+		if cleanupList != "" {
+			if options.Listed, err = readCleanupList(cleanupList, selectedAccounts); err != nil {
+				return err
+			}
+			selection = "list " + cleanupList
+		}
+		targets, scanErr := cleanup.Select(cmd.Context(), newScanner(), selectedAccounts, options)
+		plan := &cleanup.Plan{Created: time.Now().UTC(), Profile: profileName, Selection: selection, Containers: targets}
+
+		err = render(cmd.OutOrStdout(), plan, func(w io.Writer) {
+			account := ""
+			for _, t := range plan.Containers {
+				if t.Account != account {
+					account = t.Account
+					fmt.Fprintf(w, "Storage account: %s\n", account)
+				}
+				fmt.Fprintf(w, "  %-50s %5d days %10d blobs %12s  %s\n", t.Name, t.AgeDays, t.Blobs, report.Bytes(t.Bytes), t.Reason)
+				if t.Skip != "" {
+					fmt.Fprintf(w, "    skipped: %s\n", t.Skip)
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		deletions := plan.Deletions()
+		var bytes int64
+		for _, t := range deletions {
+			bytes += t.Bytes
+		}
+		summary := cmd.ErrOrStderr()
+		if output == "text" {
+			summary = cmd.OutOrStdout()
+		}
+		fmt.Fprintf(summary, "%d containers to delete holding %s, %d skipped\n",
+			len(deletions), report.Bytes(bytes), len(plan.Containers)-len(deletions))
+
+		if cleanupPlan != "" {
+			hash, err := plan.Save(cleanupPlan)
+			if err != nil {
+				return utility.Wrap(err, "writing plan")
+			}
+			fmt.Fprintf(summary, "Plan written to %s with hash %s, carry it out with:\n  gowithazure cleanup -p %s --plan %s --plan-hash %s\n",
+				cleanupPlan, hash, profileName, cleanupPlan, hash)
+			return scanErr
+		}
+		if cleanupDryRun || len(deletions) == 0 {
+			return scanErr
+		}
+		if scanErr != nil {
+			fmt.Fprintln(summary, "Nothing deleted as the scan was incomplete; write the plan with --plan to review it and carry it out.")
+			return scanErr
+		}
+
+		confirmed, err := confirm(cmd, fmt.Sprintf("Delete %d containers holding %s in profile %s?", len(deletions), report.Bytes(bytes), profileName),
+			"write the plan with --plan and carry it out with --plan-hash to go ahead without it")
+		if err != nil || !confirmed {
+			return err
+		}
+		return deleteContainers(cmd, selectedAccounts, plan, "")
+	},
+}
+
+// deleteContainers carries out plan, writing every outcome to the output and
+// the audit log.
+func deleteContainers(cmd *cobra.Command, accounts []config.Account, plan *cleanup.Plan, planHash string) error {
+	path := cleanupAudit
+	if path == "" {
+		var err error
+		if path, err = cleanup.DefaultAuditPath(); err != nil {
+			return utility.Wrap(err, "locating the audit log")
+		}
+	}
+	audit, err := cleanup.OpenAudit(path, profileName, planHash)
+	if err != nil {
+		return utility.Wrap(err, "opening the audit log")
+	}
+	defer audit.Close()
+
+	stream, err := newStream(cmd.OutOrStdout(), func(w io.Writer, item any) {
+		o := item.(cleanup.Outcome)
+		switch o.Status {
+		case cleanup.Deleted:
+			fmt.Fprintf(w, "Deleted '%s' in %s (%d blobs, %s)\n", o.Name, o.Account, o.Blobs, report.Bytes(o.Bytes))
+		case cleanup.Skipped:
+			fmt.Fprintf(w, "Skipped '%s' in %s: %s\n", o.Name, o.Account, o.Skip)
+		default:
+			fmt.Fprintf(w, "Error deleting '%s' in %s: %s\n", o.Name, o.Account, o.Error)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	var deleted, skipped, failed, bytes int64
+	deleteErr := cleanup.Delete(cmd.Context(), newScanner(), accounts, plan.Containers, func(o cleanup.Outcome) error {
+		if err := audit.Record(o); err != nil {
+			return utility.Wrap(err, "writing the audit log")
+		}
+		switch o.Status {
+		case cleanup.Attempting:
+			// Only recorded, the outcome follows.
+			return nil
+		case cleanup.Deleted:
+			deleted++
+			bytes += o.Bytes
+		case cleanup.Skipped:
+			skipped++
+		default:
+			failed++
+		}
+		stream.Write(o)
+		return nil
+	})
+	if err := stream.Close(); err != nil {
+		return err
+	}
+
+	w := cmd.OutOrStdout()
+	if output != "text" {
+		w = cmd.ErrOrStderr()
+	}
+	fmt.Fprintf(w, "Deleted %d containers holding %s, %d skipped, %d failed, recorded in %s\n", deleted, report.Bytes(bytes), skipped, failed, path)
+	return deleteErr
+}
+
+// readCleanupList reads the containers named in a list file, for each
+// account by position: container URLs of the selected accounts, names when a
+// single account is selected, or the CSV written by backlog.
+func readCleanupList(file string, accounts []config.Account) ([]map[string]bool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, utility.WithKind(utility.KindUsage, err)
+	}
+	listed := make([]map[string]bool, len(accounts))
+	for i := range listed {
+		listed[i] = make(map[string]bool)
+	}
+	accountIndex := func(value string) int {
+		return slices.IndexFunc(accounts, func(a config.Account) bool {
+			return strings.TrimSuffix(a.String(), "/") == strings.TrimSuffix(value, "/")
+		})
+	}
+
+	if strings.HasPrefix(string(data), "account,") {
+		records, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+		if err != nil {
+			return nil, utility.New(utility.KindUsage, "%s: %v", file, err)
+		}
+		nameColumn := slices.Index(records[0], "name")
+		if nameColumn < 0 {
+			return nil, utility.New(utility.KindUsage, "%s: no name column", file)
+		}
+		for n, record := range records[1:] {
+			index := accountIndex(record[0])
+			if index < 0 {
+				return nil, utility.New(utility.KindUsage, "%s:%d: %s is not one of the selected accounts", file, n+2, record[0])
+			}
+			listed[index][record[nameColumn]] = true
+		}
+		return listed, nil
+	}
+
+	lines := bufio.NewScanner(strings.NewReader(string(data)))
+	for n := 1; lines.Scan(); n++ {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		index, name := 0, line
+		if strings.Contains(line, "://") {
+			base, _, _ := strings.Cut(line, "?")
+			base = strings.TrimSuffix(base, "/")
+			cut := strings.LastIndex(base, "/")
+			if index = accountIndex(base[:cut]); index < 0 {
+				return nil, utility.New(utility.KindUsage, "%s:%d: %s is not a container of the selected accounts", file, n, line)
+			}
+			if name, err = url.PathUnescape(base[cut+1:]); err != nil {
+				return nil, utility.New(utility.KindUsage, "%s:%d: %v", file, n, err)
+			}
+		} else if len(accounts) > 1 {
+			return nil, utility.New(utility.KindUsage, "%s:%d: container names need a single account, pass --account or use container URLs", file, n)
+		}
+		if name == "" || strings.Contains(name, "/") {
+			return nil, utility.New(utility.KindUsage, "%s:%d: expected a container, got %q", file, n, line)
+		}
+		listed[index][name] = true
+	}
+	if err := lines.Err(); err != nil {
+		return nil, utility.Wrap(err, "reading %s", file)
+	}
+	return listed, nil
+}
+
+func init() {
+	flags := cleanupCmd.Flags()
+	flags.StringVar(&cleanupRule, "rule", "", fmt.Sprintf("select the containers to delete by rule, one of %v", cleanup.Rules))
+	flags.StringVar(&cleanupList, "list", "", "file listing the containers to delete, one container URL or name per line, or backlog CSV")
+	flags.StringVar(&cleanupOlderThan, "older-than", "7d", "with --rule, select containers not modified for this long, such as 7d or 2w")
+	flags.BoolVar(&cleanupDryRun, "dry-run", false, "show the plan without deleting anything")
+	flags.StringVar(&cleanupPlan, "plan", "", "write the plan to this file instead of deleting, or with --plan-hash, the plan to carry out")
+	flags.StringVar(&cleanupPlanHash, "plan-hash", "", "carry out the --plan file, which must have this hash")
+	flags.StringVar(&cleanupAudit, "audit", "", "audit log to append to (default cleanup-audit.jsonl in $XDG_DATA_HOME/gowithazure)")
+	rootCmd.AddCommand(cleanupCmd)
+}
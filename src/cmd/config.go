@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"gowithazure/src/config"
+	"gowithazure/src/utility"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the profiles file",
+	// The config commands must run against a broken file, so they skip the
+	// loading and validation done for every other command.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return checkSharedFlags()
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the profiles file and report every problem found",
+	Long: `Check the profiles file and report every problem found, including the secret references
+of every profile that cannot be resolved. Other commands only resolve the references of the
+profile they use.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(configFile)
+		if err != nil {
+			return utility.WithKind(utility.KindConfig, err)
+		}
+		cfg.ResolveSecrets(cmd.Context())
+		if cfg.File == "" {
+			return utility.New(utility.KindConfig, "no profiles file found")
+		}
+
+		var problems []config.Problem
+		var validationErr *config.ValidationError
+		if err := cfg.Validate(); errors.As(err, &validationErr) {
+			problems = validationErr.Problems
+		}
+
+		err = render(cmd.OutOrStdout(), problems, func(w io.Writer) {
+			if len(problems) == 0 {
+				fmt.Fprintf(w, "%s is valid (%d profiles)\n", cfg.File, len(cfg.Profiles))
+				return
+			}
+			for _, problem := range problems {
+				fmt.Fprintln(w, problem)
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(problems) > 0 {
+			return utility.New(utility.KindConfig, "%s has %d problems", cfg.File, len(problems))
+		}
+		return nil
+	},
+}
+
+var configWhereCmd = &cobra.Command{
+	Use:   "where",
+	Short: "Print which profiles file is loaded and where else was searched",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := config.Find(configFile)
+		if err != nil {
+			return utility.WithKind(utility.KindConfig, err)
+		}
+
+		result := struct {
+			File     string             `json:"file"`
+			Searched []config.Candidate `json:"searched"`
+		}{file, config.SearchPath(configFile)}
+
+		return render(cmd.OutOrStdout(), result, func(w io.Writer) {
+			if file == "" {
+				fmt.Fprintln(w, "No profiles file found.")
+			} else {
+				fmt.Fprintln(w, file)
+			}
+
+			fmt.Fprintln(w, "\nSearch order:")
+			for _, candidate := range result.Searched {
+				marker := " "
+				if candidate.Path == file {
+					marker = "*"
+				}
+				fmt.Fprintf(w, "%s %-20s %s\n", marker, candidate.Source, candidate.Path)
+			}
+		})
+	},
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the loaded profiles with secret references resolved and secrets redacted",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(configFile)
+		if err != nil {
+			return utility.WithKind(utility.KindConfig, err)
+		}
+		cfg.ResolveSecrets(cmd.Context())
+
+		redacted := cfg.Redacted()
+		return render(cmd.OutOrStdout(), redacted, func(w io.Writer) {
+			data, err := yaml.Marshal(redacted)
+			if err != nil {
+				fmt.Fprintln(w, "Error:", err)
+				return
+			}
+			w.Write(data)
+		})
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configWhereCmd)
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"gowithazure/src/cost"
+	"gowithazure/src/report"
+	"gowithazure/src/storage"
+	"gowithazure/src/utility"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// costPrices is the price sheet file.
+	costPrices string
+	// costRegion overrides the region of the profile.
+	costRegion string
+	// costIdle is how long hot blobs must go unused to be moved.
+	costIdle string
+	// costTop is the number of most expensive containers listed per account.
+	costTop int
+)
+
+var costCmd = &cobra.Command{
+	Use:   "cost",
+	Short: "Estimate the monthly storage cost and the savings of moving idle hot blobs",
+	Long: `Scan the blobs of each storage account and price them with a local price sheet (see
+prices.example.yml) to estimate the monthly storage cost per account, access tier and
+container.
+
+For hot blobs not accessed for --idle, it projects moving them to Cool, Cold and Archive:
+- the monthly saving;
+- the one-off cost of the tier changes;
+- the storage owed for the tier's minimum days even if the blobs are deleted sooner;
+- the cost of reading everything back once;
+- how many months the move takes to pay for itself.
+
+The region is the profile's region setting unless --region is given.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if costTop < 0 {
+			return utility.New(utility.KindUsage, "--top cannot be negative")
+		}
+		_, err := parseAge("--idle", costIdle)
+		return err
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selectedAccounts, err := storageAccounts()
+		if err != nil {
+			return err
+		}
+
+		path := costPrices
+		if path == "" {
+			path = "prices.yml"
+			if profilesFile != "" {
+				path = filepath.Join(filepath.Dir(profilesFile), path)
+			}
+		}
+		sheet, err := cost.LoadPrices(path)
+		if err != nil {
+			return utility.WithKind(utility.KindConfig, err)
+		}
+		region := costRegion
+		if region == "" {
+			region = selected.Region
+		}
+		region, prices, err := sheet.Region(region)
+		if err != nil {
+			return utility.WithKind(utility.KindConfig, err)
+		}
+
+		idle, _ := parseAge("--idle", costIdle)
+		capacity, scanErr := storage.Capacity(cmd.Context(), newScanner(), selectedAccounts, storage.CapacityOptions{IdleFor: idle})
+		results := cost.Estimate(capacity, prices, region, sheet.Currency, costTop)
+
+		err = render(cmd.OutOrStdout(), results, func(w io.Writer) {
+			var total float64
+			for _, result := range results {
+				money := func(amount float64) string {
+					return fmt.Sprintf("%.2f %s", amount, result.Currency)
+				}
+
+				fmt.Fprintf(w, "Storage account: %s (%s)\n", result.URL, result.Region)
+				if result.Error != "" {
+					fmt.Fprintf(w, "  Error: %s\n", result.Error)
+				}
+				fmt.Fprintf(w, "  Monthly storage: %s for %s\n", money(result.Monthly), report.Bytes(result.Bytes))
+				for _, tier := range result.ByTier {
+					fmt.Fprintf(w, "    %-10s %12s %14s\n", tier.Tier, report.Bytes(tier.Bytes), money(tier.Monthly))
+				}
+				if result.UnpricedBytes > 0 {
+					fmt.Fprintf(w, "    %-10s %12s %14s\n", "unpriced", report.Bytes(result.UnpricedBytes), "-")
+				}
+
+				fmt.Fprintf(w, "  Moving %s of hot data idle for %s (%d blobs):\n", report.Bytes(result.IdleHot.Bytes), costIdle, result.IdleHot.Blobs)
+				for _, projection := range result.Projections {
+					fmt.Fprintf(w, "    to %-8s saves %s/month, costs %s once, %s minimum, %s to read back", projection.Tier,
+						money(projection.MonthlySaving), money(projection.TransitionCost), money(projection.MinimumCharge), money(projection.RetrievalCost))
+					if projection.BreakEvenMonths > 0 {
+						fmt.Fprintf(w, ", pays off in %.1f months", projection.BreakEvenMonths)
+					}
+					fmt.Fprintln(w)
+				}
+
+				fmt.Fprintln(w, "  Most expensive containers:")
+				for _, container := range result.Containers {
+					fmt.Fprintf(w, "    %-40s %12s %14s", container.Name, report.Bytes(container.Bytes), money(container.Monthly))
+					if best := bestProjection(container.Projections); best != nil {
+						fmt.Fprintf(w, "  saves %s/month in %s", money(best.MonthlySaving), best.Tier)
+					}
+					fmt.Fprintln(w)
+					if container.Error != "" {
+						fmt.Fprintf(w, "      incomplete: %s\n", container.Error)
+					}
+				}
+				total += result.Monthly
+			}
+			if len(results) > 0 {
+				fmt.Fprintf(w, "Total monthly storage: %.2f %s\n", total, results[0].Currency)
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		return scanErr
+	},
+}
+
+// bestProjection returns the projection that saves the most per month, or
+// nil when none saves anything.
+func bestProjection(projections []cost.Projection) *cost.Projection {
+	var best *cost.Projection
+	for i := range projections {
+		if projections[i].MonthlySaving > 0 && (best == nil || projections[i].MonthlySaving > best.MonthlySaving) {
+			best = &projections[i]
+		}
+	}
+	return best
+}
+
+func init() {
+	flags := costCmd.Flags()
+	flags.StringVar(&costPrices, "prices", "", "price sheet file (default prices.yml next to the profiles file, or in the current dir)")
+	flags.StringVar(&costRegion, "region", "", "region of the price sheet to use (default the profile's region)")
+	flags.StringVar(&costIdle, "idle", "30d", "how long hot blobs must go without being accessed to be worth moving")
+	flags.IntVar(&costTop, "top", 10, "number of most expensive containers to list per account, 0 for all")
+	rootCmd.AddCommand(costCmd)
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"gowithazure/src/storage"
+
+	"github.com/spf13/cobra"
+)
+
+// countBlobs also enumerates and counts the blobs in every container.
+var countBlobs bool
+
+var countCmd = &cobra.Command{
+	Use:   "count",
+	Short: "Count the containers, and optionally blobs, in each storage account",
+	Long: `Count the containers, and optionally blobs, in each storage account.
+
+Progress and the counts so far are saved to a checkpoint as pages are listed. If the
+count fails or is interrupted, rerun it with --resume and the same flags to continue
+where it stopped.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selectedAccounts, err := storageAccounts()
+		if err != nil {
+			return err
+		}
+
+		path, err := scanCheckpoint("count")
+		if err != nil {
+			return err
+		}
+		progress, err := openCheckpoint(path, selectedAccounts, map[string]string{
+			"blobs": strconv.FormatBool(countBlobs),
+		})
+		if err != nil {
+			return err
+		}
+
+		results, scanErr := storage.Count(cmd.Context(), newScanner(), selectedAccounts, countBlobs, progress)
+		if results == nil {
+			return scanErr
+		}
+
+		err = render(cmd.OutOrStdout(), results, func(w io.Writer) {
+			var totalContainerCount, totalBlobCount int
+			for _, result := range results {
+				fmt.Fprintf(w, "Storage account: %s\n", result.URL)
+				if result.Error != "" {
+					fmt.Fprintf(w, "  Error: %s\n", result.Error)
+				}
+				fmt.Fprintf(w, "  Container count: %d\n", result.Containers)
+				if countBlobs {
+					fmt.Fprintf(w, "  Blob count: %d\n", result.Blobs)
+					for _, container := range result.PerContainer {
+						if container.Error != "" {
+							fmt.Fprintf(w, "  Incomplete container %s (%d blobs counted): %s\n", container.Name, container.Blobs, container.Error)
+						}
+					}
+				}
+				totalContainerCount += result.Containers
+				totalBlobCount += result.Blobs
+			}
+
+			fmt.Fprintf(w, "Total container count: %d\n", totalContainerCount)
+			if countBlobs {
+				fmt.Fprintf(w, "Total blob count: %d\n", totalBlobCount)
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		return finishCheckpoint(cmd, progress, scanErr)
+	},
+}
+
+func init() {
+	countCmd.Flags().BoolVar(&countBlobs, "blobs", false, "also count the blobs in every container (slow on large accounts)")
+	addResumeFlags(countCmd.Flags(), "<profile>-count.checkpoint in the user cache directory")
+	rootCmd.AddCommand(countCmd)
+}
@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"gowithazure/src/recovery"
+	"gowithazure/src/report"
+	"gowithazure/src/utility"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// deletedOptions are the flags selecting the deleted items.
+	deletedOptions recovery.Options
+	// deletedWithin is the unparsed --within.
+	deletedWithin string
+	// deletedYes restores without asking for confirmation.
+	deletedYes bool
+)
+
+var deletedCmd = &cobra.Command{
+	Use:   "deleted",
+	Short: "List and restore soft-deleted containers and blobs",
+	Long: `With soft delete enabled on a storage account, deleted containers and blobs are kept for
+the retention period of the account before they are gone for good. deleted list shows them
+with their deletion time and the days of retention left; deleted restore brings them back.
+
+Deleted containers are always included. --blobs adds the deleted blobs of live containers,
+which takes walking every blob; the blobs of a deleted container only show once it is
+restored. Narrow the selection down with --container, --prefix and --match like the tier
+command, and with --within to keep the items deleted recently, such as after a cleanup that
+went wrong. --prefix and --match imply --blobs.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := rootCmd.PersistentPreRunE(cmd, args); err != nil {
+			return err
+		}
+		for _, pattern := range append([]string{deletedOptions.Pattern}, deletedOptions.Containers...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return utility.New(utility.KindUsage, "invalid pattern %q", pattern)
+			}
+		}
+		if deletedWithin != "" {
+			var err error
+			if deletedOptions.Within, err = parseAge("--within", deletedWithin); err != nil {
+				return err
+			}
+		}
+		if deletedOptions.Prefix != "" || deletedOptions.Pattern != "" {
+			deletedOptions.Blobs = true
+		}
+		return nil
+	},
+}
+
+var deletedListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the soft-deleted containers and blobs",
+	Example: `  gowithazure deleted list -p us-prod
+  gowithazure deleted list -p us-prod --container 'video-*' --blobs --within 2d -o csv`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selectedAccounts, err := storageAccounts()
+		if err != nil {
+			return err
+		}
+
+		stream, err := newStream(cmd.OutOrStdout(), func(w io.Writer, item any) {
+			fmt.Fprintln(w, describeDeleted(item.(recovery.Item)))
+		})
+		if err != nil {
+			return err
+		}
+		var containers, blobs, bytes int64
+		listErr := recovery.List(cmd.Context(), newScanner(), selectedAccounts, deletedOptions, func(item recovery.Item) {
+			stream.Write(item)
+			if item.Blob == "" {
+				containers++
+			} else {
+				blobs++
+				bytes += item.Bytes
+			}
+		})
+		if err := stream.Close(); err != nil {
+			return err
+		}
+
+		w := cmd.OutOrStdout()
+		if output != "text" {
+			w = cmd.ErrOrStderr()
+		}
+		fmt.Fprintf(w, "%d deleted containers", containers)
+		if deletedOptions.Blobs {
+			fmt.Fprintf(w, " and %d deleted blobs (%s)", blobs, report.Bytes(bytes))
+		}
+		fmt.Fprintln(w)
+		return listErr
+	},
+}
+
+var deletedRestoreCmd = &cobra.Command{
+	Use:   "restore [container | container/blob]...",
+	Short: "Restore soft-deleted containers and blobs",
+	Long: `Restore the deleted containers and blobs selected by the filters, or only those named as
+arguments: a container name, or container/blob for a blob. A container is restored from its
+deleted version; when a name was deleted more than once, the latest deletion is restored. A
+deleted container whose name has been taken by a new container cannot be restored and is
+skipped. A blob is undeleted with its deleted snapshots.
+
+Containers are restored first, so with --blobs the deleted blobs of the containers just
+restored are restored as well. Run it with --dry-run first to see what it would restore;
+a dry run cannot see the blobs of containers it has not restored. Without --dry-run it asks
+for confirmation unless --yes is given.`,
+	Example: `  gowithazure deleted restore -p us-prod --container 'video-*' --within 1d --dry-run
+  gowithazure deleted restore -p us-prod job42-in job42-out
+  gowithazure deleted restore -p us-prod --account https://usprodvideo.blob.core.windows.net job42-in/raw/take1.mp4`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return nil
+		}
+		if len(deletedOptions.Containers) > 0 || deletedOptions.Prefix != "" || deletedOptions.Pattern != "" || deletedWithin != "" {
+			return utility.New(utility.KindUsage, "items to restore cannot be combined with --container, --prefix, --match or --within")
+		}
+		selectedAccounts, err := storageAccounts()
+		if err != nil {
+			return err
+		}
+		if len(selectedAccounts) > 1 {
+			return utility.New(utility.KindUsage, "items to restore need a single account, pass --account")
+		}
+		for _, arg := range args {
+			containerName, name, isBlob := strings.Cut(arg, "/")
+			if containerName == "" || (isBlob && name == "") {
+				return utility.New(utility.KindUsage, "expected container or container/blob, got %q", arg)
+			}
+			deletedOptions.Blobs = deletedOptions.Blobs || isBlob
+		}
+		deletedOptions.Names = args
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selectedAccounts, err := storageAccounts()
+		if err != nil {
+			return err
+		}
+
+		if !deletedOptions.DryRun && !deletedYes {
+			what := fmt.Sprintf("the deleted %s of %d storage account(s) of profile %s", describeDeletedFilters(), len(selectedAccounts), profileName)
+			if deletedOptions.Names != nil {
+				what = strings.Join(deletedOptions.Names, ", ")
+			}
+			confirmed, err := confirm(cmd, fmt.Sprintf("Restore %s?", what), yesHint)
+			if err != nil || !confirmed {
+				return err
+			}
+		}
+
+		stream, err := newStream(cmd.OutOrStdout(), func(w io.Writer, item any) {
+			i := item.(recovery.Item)
+			name := i.Container
+			if i.Blob != "" {
+				name += "/" + i.Blob
+			}
+			switch i.Status {
+			case recovery.Restored:
+				fmt.Fprintf(w, "Restored '%s' in %s\n", name, i.Account)
+			case recovery.Skipped:
+				fmt.Fprintf(w, "Skipped '%s' in %s: %s\n", name, i.Account, i.Reason)
+			case recovery.Failed:
+				fmt.Fprintf(w, "Error restoring '%s' in %s: %s\n", name, i.Account, i.Error)
+			default:
+				fmt.Fprintf(w, "Would restore %s\n", describeDeleted(i))
+			}
+		})
+		if err != nil {
+			return err
+		}
+		var restored, skipped, failed int
+		seen := make(map[string]bool)
+		restoreErr := recovery.Restore(cmd.Context(), newScanner(), selectedAccounts, deletedOptions, func(item recovery.Item) {
+			stream.Write(item)
+			seen[strings.TrimSuffix(item.Container+"/"+item.Blob, "/")] = true
+			switch item.Status {
+			case recovery.Skipped:
+				skipped++
+			case recovery.Failed:
+				failed++
+			default:
+				restored++
+			}
+		})
+		if err := stream.Close(); err != nil {
+			return err
+		}
+
+		w := cmd.OutOrStdout()
+		if output != "text" {
+			w = cmd.ErrOrStderr()
+		}
+		for _, name := range deletedOptions.Names {
+			if !seen[name] {
+				fmt.Fprintf(w, "No deleted item named %s\n", name)
+			}
+		}
+		if deletedOptions.DryRun {
+			fmt.Fprintf(w, "Would restore %d items, %d skipped\n", restored, skipped)
+			return restoreErr
+		}
+		fmt.Fprintf(w, "Restored %d items, %d skipped, %d failed\n", restored, skipped, failed)
+		return restoreErr
+	},
+}
+
+// describeDeleted describes a deleted item for the text output.
+func describeDeleted(item recovery.Item) string {
+	deleted := "at an unknown time"
+	if item.DeletedTime != nil {
+		deleted = item.DeletedTime.Local().Format(time.DateTime)
+	}
+	if item.Blob == "" {
+		return fmt.Sprintf("container '%s' in %s, deleted %s, %d days left", item.Container, item.Account, deleted, item.RemainingDays)
+	}
+	return fmt.Sprintf("blob '%s/%s' in %s (%s), deleted %s, %d days left", item.Container, item.Blob, item.Account, report.Bytes(item.Bytes), deleted, item.RemainingDays)
+}
+
+// describeDeletedFilters describes the items selected by the filters of
+// deleted restore for its confirmation question.
+func describeDeletedFilters() string {
+	what := "containers"
+	if deletedOptions.Blobs {
+		what = "containers and blobs"
+	}
+	if len(deletedOptions.Containers) > 0 {
+		what += " named " + strings.Join(deletedOptions.Containers, ", ")
+	}
+	if deletedOptions.Prefix != "" {
+		what += ", blobs under " + deletedOptions.Prefix
+	}
+	if deletedOptions.Pattern != "" {
+		what += ", blobs matching " + deletedOptions.Pattern
+	}
+	if deletedWithin != "" {
+		what += ", deleted in the last " + deletedWithin + ","
+	}
+	return what
+}
+
+func init() {
+	flags := deletedCmd.PersistentFlags()
+	flags.StringSliceVar(&deletedOptions.Containers, "container", nil, "only include containers with this name or matching this pattern, may be repeated")
+	flags.BoolVar(&deletedOptions.Blobs, "blobs", false, "include the deleted blobs of live containers, which walks every blob")
+	flags.StringVar(&deletedOptions.Prefix, "prefix", "", "only include blobs whose name starts with this prefix")
+	flags.StringVar(&deletedOptions.Pattern, "match", "", "only include blobs whose name matches this pattern, where * does not match /")
+	flags.StringVar(&deletedWithin, "within", "", "only include items deleted less than this long ago, such as 2d or 12h")
+
+	restoreFlags := deletedRestoreCmd.Flags()
+	restoreFlags.BoolVar(&deletedOptions.DryRun, "dry-run", false, "show what would be restored without restoring anything")
+	restoreFlags.BoolVarP(&deletedYes, "yes", "y", false, "restore without asking for confirmation")
+
+	deletedCmd.AddCommand(deletedListCmd, deletedRestoreCmd)
+	rootCmd.AddCommand(deletedCmd)
+}
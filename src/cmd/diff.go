@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"gowithazure/src/storage"
+	"gowithazure/src/utility"
+
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Report containers and blobs in the first account missing from the second",
+	Long: `Compare the containers and blobs of two storage accounts and report anything in
+the primary (first) account that has not been replicated to the second.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selectedAccounts, err := storageAccounts()
+		if err != nil {
+			return err
+		}
+		if len(selectedAccounts) < 2 {
+			return utility.New(utility.KindUsage, "diff needs two storage accounts, got %d", len(selectedAccounts))
+		}
+
+		primary, err := newClient(selectedAccounts[0])
+		if err != nil {
+			return utility.Wrap(err, "connecting to %s", selectedAccounts[0])
+		}
+		secondary, err := newClient(selectedAccounts[1])
+		if err != nil {
+			return utility.Wrap(err, "connecting to %s", selectedAccounts[1])
+		}
+
+		result, err := storage.Diff(cmd.Context(), primary, secondary)
+		if err != nil {
+			return err
+		}
+
+		return render(cmd.OutOrStdout(), result, func(w io.Writer) {
+			fmt.Fprintf(w, "Storage account: %s\n", result.Primary)
+			fmt.Fprintf(w, "  Container count: %d\n", result.PrimaryContainers)
+			fmt.Fprintf(w, "  Blob count: %d\n", result.PrimaryBlobs)
+
+			for _, containerName := range result.MissingContainers {
+				fmt.Fprintf(w, "Container '%s' exists in first account but not in second\n", containerName)
+			}
+			for _, blobName := range result.MissingBlobs {
+				fmt.Fprintf(w, "Blob '%s' exists in primary storage account but has not been replicated\n", blobName)
+			}
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"gowithazure/src/storage"
+
+	"github.com/spf13/cobra"
+)
+
+var emptyCmd = &cobra.Command{
+	Use:   "empty",
+	Short: "Count the containers in each storage account that hold no blobs",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		start := time.Now()
+
+		selectedAccounts, err := storageAccounts()
+		if err != nil {
+			return err
+		}
+
+		results, scanErr := storage.CountEmpty(cmd.Context(), newScanner(), selectedAccounts)
+
+		err = render(cmd.OutOrStdout(), results, func(w io.Writer) {
+			// Aggregate counts across the accounts
+			totalContainers := 0
+			totalEmptyContainers := 0
+			for _, result := range results {
+				if result.Error != "" {
+					fmt.Fprintf(w, "Error processing %s: %s\n", result.URL, result.Error)
+				}
+				totalContainers += result.TotalContainers
+				totalEmptyContainers += result.EmptyContainers
+			}
+
+			// Output the total count and the time taken for processing
+			fmt.Fprintf(w, "Total containers across all accounts: %v\n", totalContainers)
+			fmt.Fprintf(w, "Total empty containers across all accounts: %v\n", totalEmptyContainers)
+			fmt.Fprintf(w, "Total time taken: %v\n", time.Since(start))
+		})
+		if err != nil {
+			return err
+		}
+
+		return scanErr
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(emptyCmd)
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"gowithazure/src/evaluation"
+	"gowithazure/src/utility"
+
+	"github.com/spf13/cobra"
+)
+
+// evaluationName is the evaluation to run.
+var evaluationName string
+
+var evaluateCmd = &cobra.Command{
+	Use:   "evaluate",
+	Short: "Count the containers of each storage account that match an evaluation",
+	Long: `Evaluate the storage accounts of a region profile: count the containers selected by an
+evaluation and how many of them fall in each of its buckets.
+
+Evaluations are defined under evaluations in the profiles file, with name patterns (prefix,
+suffix, regex), metadata matches and an age threshold. The built-in video evaluation, used
+unless the file defines one of that name, counts every container that has not been modified
+in the last 7 days as its total, and those with the suffix -in or -out in its in and out
+buckets.`,
+	Example: `  gowithazure evaluate -p us-prod
+  gowithazure evaluate -p us-prod --evaluation scratch -o csv`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selectedAccounts, err := storageAccounts()
+		if err != nil {
+			return err
+		}
+		evaluator, err := evaluation.Lookup(evaluations, evaluationName)
+		if err != nil {
+			return utility.WithKind(utility.KindUsage, err)
+		}
+
+		results, scanErr := evaluator.Evaluate(cmd.Context(), newScanner(), selectedAccounts)
+
+		err = render(cmd.OutOrStdout(), results, func(w io.Writer) {
+			for _, result := range results {
+				fmt.Fprintf(w, "Azure Storage Account Container Count for %s %s\n", evaluator.Describe(), result.Url)
+				if result.Error != "" {
+					fmt.Fprintf(w, "Error: %s\n", result.Error)
+				}
+				fmt.Fprintf(w, "There are %v containers in the storage account.\n", result.Total)
+				for i, bucket := range result.Buckets {
+					fmt.Fprintf(w, "There are %v containers %s (%s) in the storage account.\n", bucket.Containers, evaluator.DescribeBucket(i), bucket.Name)
+				}
+				if len(result.Buckets) > 1 {
+					fmt.Fprintf(w, "There are %v containers in any of these buckets in the storage account.\n", result.InAnyBucket)
+				}
+				fmt.Fprintln(w, "--------------------------------------------------")
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		return scanErr
+	},
+}
+
+func init() {
+	evaluateCmd.Flags().StringVarP(&evaluationName, "evaluation", "e", evaluation.VideoName, "evaluation to run, defined under evaluations in the profiles file")
+	rootCmd.AddCommand(evaluateCmd)
+}
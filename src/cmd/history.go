@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"gowithazure/src/history"
+	"gowithazure/src/report"
+	"gowithazure/src/utility"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// historyDB is the history database file.
+	historyDB string
+	// historySince is how far back the history goes.
+	historySince string
+	// historyBy groups the runs of the history, one of history.Periods.
+	historyBy string
+	// historyPerAccount shows every account instead of their totals.
+	historyPerAccount bool
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show how container counts, the -in/-out backlog and empty containers trend",
+	Long: `Show the snapshots recorded by the snapshot command for the selected profile: the
+containers, empty containers and stale -in/-out containers of every run, or of the last run
+of each day or week, with the change since the previous one.
+
+The accounts of a run are added up unless --per-account is given. --account limits the
+history to the given accounts.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !slices.Contains(history.Periods, historyBy) {
+			return utility.New(utility.KindUsage, "unsupported --by %q, expected one of %v", historyBy, history.Periods)
+		}
+		since, err := parseSince(historySince)
+		if err != nil {
+			return err
+		}
+
+		store, err := openHistory()
+		if err != nil {
+			return err
+		}
+		summaries, err := store.Summaries(profileName, since)
+		store.Close()
+		if err != nil {
+			return utility.Wrap(err, "reading history")
+		}
+
+		if cmd.Flags().Changed("account") {
+			selectedAccounts, err := storageAccounts()
+			if err != nil {
+				return err
+			}
+			urls := make(map[string]bool, len(selectedAccounts))
+			for _, account := range selectedAccounts {
+				urls[account.String()] = true
+			}
+			summaries = slices.DeleteFunc(summaries, func(summary history.Summary) bool {
+				return !urls[summary.Account]
+			})
+		}
+
+		points := history.Trend(summaries, historyBy, historyPerAccount)
+		return render(cmd.OutOrStdout(), points, func(w io.Writer) {
+			if len(points) == 0 {
+				fmt.Fprintf(w, "No snapshots of profile %s since %s, record one with the snapshot command\n", profileName, since.Format("2006-01-02"))
+				return
+			}
+			fmt.Fprintf(w, "History of profile %s since %s, by %s\n", profileName, since.Format("2006-01-02"), historyBy)
+
+			previous := make(map[string]history.Summary)
+			for _, point := range points {
+				before, seen := previous[point.Account]
+				previous[point.Account] = point
+				change := func(now, then int64) string {
+					if !seen {
+						return ""
+					}
+					return fmt.Sprintf(" (%+d)", now-then)
+				}
+
+				fmt.Fprintf(w, "%s", point.Time.Format("2006-01-02 15:04"))
+				if point.Account != "" {
+					fmt.Fprintf(w, "  %s", point.Account)
+				}
+				fmt.Fprintf(w, "  containers %d%s  empty %d%s  stale -in %d%s  stale -out %d%s",
+					point.Containers, change(int64(point.Containers), int64(before.Containers)),
+					point.Empty, change(int64(point.Empty), int64(before.Empty)),
+					point.StaleIn, change(int64(point.StaleIn), int64(before.StaleIn)),
+					point.StaleOut, change(int64(point.StaleOut), int64(before.StaleOut)))
+				if point.Blobs > 0 {
+					fmt.Fprintf(w, "  blobs %d%s  size %s", point.Blobs, change(point.Blobs, before.Blobs), report.Bytes(point.Bytes))
+				}
+				if point.Error != "" {
+					fmt.Fprintf(w, "  (%s)", point.Error)
+				}
+				fmt.Fprintln(w)
+			}
+		})
+	},
+}
+
+// parseSince turns a --since value into the time it reaches back to.
+func parseSince(value string) (time.Time, error) {
+	age, err := parseAge("--since", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().UTC().Add(-age), nil
+}
+
+// addHistoryFlags registers --db on a command that uses the history database.
+func addHistoryFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&historyDB, "db", "", "history database file (default $XDG_DATA_HOME/gowithazure/history.db)")
+}
+
+// openHistory opens the history database at --db or its default path.
+func openHistory() (*history.Store, error) {
+	path := historyDB
+	if path == "" {
+		var err error
+		path, err = history.DefaultPath()
+		if err != nil {
+			return nil, utility.Wrap(err, "locating history database")
+		}
+	}
+	store, err := history.Open(path)
+	if err != nil {
+		return nil, utility.WithKind(utility.KindConfig, err)
+	}
+	return store, nil
+}
+
+func init() {
+	flags := historyCmd.Flags()
+	flags.StringVar(&historySince, "since", "30d", "how far back to go, in days (30d), weeks (8w) or a duration (36h)")
+	flags.StringVar(&historyBy, "by", "day", fmt.Sprintf("show every run or the last run of each period, one of %v", history.Periods))
+	flags.BoolVar(&historyPerAccount, "per-account", false, "show every storage account instead of their totals")
+	addHistoryFlags(historyCmd)
+	rootCmd.AddCommand(historyCmd)
+}
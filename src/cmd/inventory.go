@@ -0,0 +1,325 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+
+	"gowithazure/src/checkpoint"
+	"gowithazure/src/config"
+	"gowithazure/src/inventory"
+	"gowithazure/src/utility"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// inventoryFormat is the file format of the inventory.
+	inventoryFormat string
+	// inventoryFile is the file the inventory is written to; "-" is stdout.
+	inventoryFile string
+	// inventoryPrefix limits the inventory to containers with this prefix.
+	inventoryPrefix string
+	// inventoryDeleted includes soft-deleted items.
+	inventoryDeleted bool
+	// inventoryBlobPrefix limits the blob inventory to blobs with this prefix.
+	inventoryBlobPrefix string
+	// inventoryVersions and inventorySnapshots include previous versions and
+	// snapshots in the blob inventory.
+	inventoryVersions  bool
+	inventorySnapshots bool
+)
+
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: "Export an inventory of the storage accounts to CSV, JSON Lines or Parquet",
+	Long: `Export an inventory of the storage accounts. Records are written as the listings
+are paged in, so inventories of accounts with millions of items use little memory.
+The columns are named like the json fields of the other commands.
+
+When the inventory is written to a csv or jsonl file, progress is saved to a checkpoint
+file next to it. If the run fails or is interrupted, rerun it with --resume and the same
+flags to continue where it stopped. The checkpoint is removed once the inventory is complete.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := rootCmd.PersistentPreRunE(cmd, args); err != nil {
+			return err
+		}
+		if !slices.Contains(inventory.Formats, inventoryFormat) {
+			return utility.New(utility.KindUsage, "unsupported inventory format %q, expected one of %v", inventoryFormat, inventory.Formats)
+		}
+		if inventoryFormat == "parquet" && inventoryFile == "-" {
+			return utility.New(utility.KindUsage, "parquet inventories must be written to a file, pass --file")
+		}
+		return nil
+	},
+}
+
+var inventoryContainersCmd = &cobra.Command{
+	Use:   "containers",
+	Short: "Export every container with its properties, metadata and lease, retention and deletion state",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selectedAccounts, err := storageAccounts()
+		if err != nil {
+			return err
+		}
+
+		progress, err := inventoryCheckpoint(selectedAccounts, map[string]string{
+			"format":  inventoryFormat,
+			"prefix":  inventoryPrefix,
+			"deleted": strconv.FormatBool(inventoryDeleted),
+		})
+		if err != nil {
+			return err
+		}
+		out, writer, err := openInventoryWriter(cmd, progress, inventory.ContainerRecord{})
+		if err != nil {
+			return err
+		}
+
+		scan := newScanner()
+		if progress != nil {
+			scan.Progress = progress
+		}
+		total := 0
+		options := inventory.ContainerOptions{Prefix: inventoryPrefix, Deleted: inventoryDeleted}
+		scanErr := inventory.Containers(cmd.Context(), scan, selectedAccounts, options, func(records []inventory.ContainerRecord, _, _ string) error {
+			total += len(records)
+			return writeInventoryPage(writer, out, progress, records)
+		})
+
+		// Whatever was listed is kept even when some accounts failed.
+		if err := finishInventory(writer, out); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "Wrote %d containers from %d storage accounts to %s\n", total, len(selectedAccounts), out)
+
+		if progress == nil {
+			return scanErr
+		}
+		return finishCheckpoint(cmd, progress, scanErr)
+	},
+}
+
+var inventoryBlobsCmd = &cobra.Command{
+	Use:   "blobs",
+	Short: "Export every blob with its size, content type, tier, times, type, MD5, version, snapshot and tags",
+	Long: `Export every blob of every container, or of the containers and blobs matching
+--prefix and --blob-prefix.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selectedAccounts, err := storageAccounts()
+		if err != nil {
+			return err
+		}
+
+		progress, err := inventoryCheckpoint(selectedAccounts, map[string]string{
+			"format":     inventoryFormat,
+			"prefix":     inventoryPrefix,
+			"blobPrefix": inventoryBlobPrefix,
+			"deleted":    strconv.FormatBool(inventoryDeleted),
+			"versions":   strconv.FormatBool(inventoryVersions),
+			"snapshots":  strconv.FormatBool(inventorySnapshots),
+		})
+		if err != nil {
+			return err
+		}
+		out, writer, err := openInventoryWriter(cmd, progress, inventory.BlobRecord{})
+		if err != nil {
+			return err
+		}
+
+		scan := newScanner()
+		if progress != nil {
+			scan.Progress = progress
+		}
+		options := inventory.BlobOptions{
+			ContainerOptions: inventory.ContainerOptions{Prefix: inventoryPrefix, Deleted: inventoryDeleted},
+			BlobPrefix:       inventoryBlobPrefix,
+			Versions:         inventoryVersions,
+			Snapshots:        inventorySnapshots,
+		}
+		total := 0
+		scanErr := inventory.Blobs(cmd.Context(), scan, selectedAccounts, options, func(records []inventory.BlobRecord, _, _, _ string) error {
+			total += len(records)
+			return writeInventoryPage(writer, out, progress, records)
+		})
+
+		if err := finishInventory(writer, out); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "Wrote %d blobs from %d storage accounts to %s\n", total, len(selectedAccounts), out)
+
+		if progress == nil {
+			return scanErr
+		}
+		return finishCheckpoint(cmd, progress, scanErr)
+	},
+}
+
+// inventoryCheckpoint returns the checkpoint of an inventory, or nil when it
+// goes somewhere that cannot be resumed: only a csv or jsonl file can be
+// appended to.
+func inventoryCheckpoint(accounts []config.Account, settings map[string]string) (*checkpoint.Checkpoint, error) {
+	if inventoryFile == "-" || inventoryFormat == "parquet" {
+		if resume {
+			return nil, utility.New(utility.KindUsage, "--resume needs a csv or jsonl inventory written to a file")
+		}
+		return nil, nil
+	}
+	return openCheckpoint(inventoryFile+".checkpoint", accounts, settings)
+}
+
+// openInventoryWriter opens the inventory output and its writer, continuing
+// the file covered by progress when resuming.
+func openInventoryWriter(cmd *cobra.Command, progress *checkpoint.Checkpoint, prototype any) (*inventoryOutput, inventory.Writer, error) {
+	var offset int64
+	if progress != nil {
+		offset = progress.Offset
+	}
+	out, err := openInventory(cmd, offset)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var writer inventory.Writer
+	if offset > 0 {
+		writer, err = inventory.ResumeWriter(out, inventoryFormat)
+	} else {
+		writer, err = inventory.NewWriter(out, inventoryFormat, prototype)
+	}
+	if err != nil {
+		out.Close()
+		return nil, nil, err
+	}
+	return out, writer, nil
+}
+
+// writeInventoryPage writes the records of one listed page. With a checkpoint
+// it runs as the commit of the page, so the page is flushed and the offset
+// recorded with its marker.
+func writeInventoryPage[T any](writer inventory.Writer, out *inventoryOutput, progress *checkpoint.Checkpoint, records []T) error {
+	for _, record := range records {
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	if progress == nil {
+		return nil
+	}
+
+	// The checkpoint may only cover what has reached the file.
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	progress.Offset = out.Offset()
+	return nil
+}
+
+// inventoryOutput buffers an inventory on its way to the file or stdout and
+// counts the bytes that reached it.
+type inventoryOutput struct {
+	*bufio.Writer
+	target *byteCounter
+	file   *os.File
+}
+
+// byteCounter counts the bytes written through it.
+type byteCounter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// openInventory opens the inventory file, or stdout for "-". When offset is
+// not 0 the file is resumed: it is cut back to offset, dropping anything a
+// failed run wrote after its last checkpoint, and appended to.
+func openInventory(cmd *cobra.Command, offset int64) (*inventoryOutput, error) {
+	if inventoryFile == "-" {
+		target := &byteCounter{w: cmd.OutOrStdout()}
+		return &inventoryOutput{Writer: bufio.NewWriterSize(target, 1<<20), target: target}, nil
+	}
+
+	var file *os.File
+	var err error
+	if offset > 0 {
+		file, err = os.OpenFile(inventoryFile, os.O_WRONLY, 0)
+		if err == nil {
+			err = file.Truncate(offset)
+		}
+		if err == nil {
+			_, err = file.Seek(offset, io.SeekStart)
+		}
+	} else {
+		file, err = os.Create(inventoryFile)
+	}
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return nil, utility.WithKind(utility.KindUsage, err)
+	}
+
+	target := &byteCounter{w: file, n: offset}
+	return &inventoryOutput{Writer: bufio.NewWriterSize(target, 1<<20), target: target, file: file}, nil
+}
+
+// Offset returns the length of the inventory that has been flushed.
+func (o *inventoryOutput) Offset() int64 {
+	return o.target.n
+}
+
+// Close flushes the inventory and closes the file.
+func (o *inventoryOutput) Close() error {
+	err := o.Flush()
+	if o.file != nil {
+		if closeErr := o.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// String names where the inventory goes, for the summary line.
+func (o *inventoryOutput) String() string {
+	if o.file == nil {
+		return "stdout"
+	}
+	return o.file.Name()
+}
+
+// finishInventory completes the inventory and closes its output.
+func finishInventory(writer inventory.Writer, out *inventoryOutput) error {
+	if err := writer.Close(); err != nil {
+		out.Close()
+		return utility.Wrap(err, "writing inventory")
+	}
+	if err := out.Close(); err != nil {
+		return utility.Wrap(err, "writing inventory")
+	}
+	return nil
+}
+
+func init() {
+	flags := inventoryCmd.PersistentFlags()
+	flags.StringVar(&inventoryFormat, "format", "csv", fmt.Sprintf("inventory file format, one of %v", inventory.Formats))
+	flags.StringVarP(&inventoryFile, "file", "f", "-", "file to write the inventory to, - for stdout")
+	flags.StringVar(&inventoryPrefix, "prefix", "", "only include containers whose name starts with this prefix")
+	flags.BoolVar(&inventoryDeleted, "deleted", false, "include soft-deleted items")
+	addResumeFlags(flags, "the inventory file with .checkpoint appended")
+
+	blobFlags := inventoryBlobsCmd.Flags()
+	blobFlags.StringVar(&inventoryBlobPrefix, "blob-prefix", "", "only include blobs whose name starts with this prefix")
+	blobFlags.BoolVar(&inventoryVersions, "versions", false, "include previous versions of blobs")
+	blobFlags.BoolVar(&inventorySnapshots, "snapshots", false, "include blob snapshots")
+
+	inventoryCmd.AddCommand(inventoryContainersCmd)
+	inventoryCmd.AddCommand(inventoryBlobsCmd)
+	rootCmd.AddCommand(inventoryCmd)
+}
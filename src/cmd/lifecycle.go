@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gowithazure/src/inventory"
+	"gowithazure/src/lifecycle"
+	"gowithazure/src/report"
+	"gowithazure/src/utility"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// lifecycleRules is the lifecycle rules file.
+	lifecycleRules string
+	// lifecycleInventory is the blob inventory simulated against, - for stdin.
+	lifecycleInventory string
+	// lifecycleFormat is the format of the inventory, guessed from its name
+	// when empty.
+	lifecycleFormat string
+	// lifecycleIn simulates the rules as of this long from now.
+	lifecycleIn string
+	// lifecycleFile is where the policy is written, - for stdout.
+	lifecycleFile string
+)
+
+var lifecycleCmd = &cobra.Command{
+	Use:   "lifecycle",
+	Short: "Simulate lifecycle rules on an inventory and generate their management policy",
+	Long: `Instead of moving blobs from here with the tier command, declare lifecycle rules in a
+YAML file (see lifecycle.example.yml) and let the storage service apply them:
+- lifecycle simulate shows what the rules would do to the blobs of an inventory, offline;
+- lifecycle policy writes the equivalent Azure lifecycle management policy.
+
+The rules are read from lifecycle.yml next to the profiles file unless --rules is given.`,
+}
+
+var lifecycleSimulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Show how many blobs and bytes each lifecycle rule would act on",
+	Long: `Read a blob inventory written by inventory blobs, in csv or jsonl, and work out what the
+lifecycle rules would do to each blob, the way the service applies a policy: the most drastic
+action due for a blob wins, a blob is only moved to a cooler tier than its own, and blobs
+being rehydrated are not moved. Snapshots, previous versions and soft-deleted blobs are left
+out.
+
+Ages are counted from the inventory's last modified and last access times to now, or to --in
+from now to see what the rules will have done by then.`,
+	Example: `  gowithazure inventory blobs -p us-prod --file blobs.csv
+  gowithazure lifecycle simulate --inventory blobs.csv
+  gowithazure lifecycle simulate --rules archive.yml --inventory blobs.jsonl --in 90d`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if lifecycleInventory == "" {
+			return utility.New(utility.KindUsage, "--inventory is required")
+		}
+		if lifecycleFormat != "" && lifecycleFormat != "csv" && lifecycleFormat != "jsonl" {
+			return utility.New(utility.KindUsage, "invalid --format %q, expected csv or jsonl: parquet inventories cannot be read back", lifecycleFormat)
+		}
+		_, err := parseAge("--in", lifecycleIn)
+		return err
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rules, err := loadLifecycleRules()
+		if err != nil {
+			return err
+		}
+
+		format := lifecycleFormat
+		if format == "" {
+			format = "csv"
+			if ext := strings.ToLower(filepath.Ext(lifecycleInventory)); ext == ".jsonl" || ext == ".ndjson" {
+				format = "jsonl"
+			}
+		}
+		var in io.Reader = cmd.InOrStdin()
+		if lifecycleInventory != "-" {
+			file, err := os.Open(lifecycleInventory)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			in = file
+		}
+
+		ahead, _ := parseAge("--in", lifecycleIn)
+		at := time.Now().Add(ahead)
+		simulator := lifecycle.NewSimulator(rules, at)
+		if err := inventory.ReadBlobs(in, format, func(record inventory.BlobRecord) error {
+			simulator.Add(record)
+			return cmd.Context().Err()
+		}); err != nil {
+			return fmt.Errorf("%s: %w", lifecycleInventory, err)
+		}
+		effects := simulator.Effects()
+
+		var total, affected lifecycle.Effect
+		for _, effect := range effects {
+			total.Blobs += effect.Blobs
+			total.Bytes += effect.Bytes
+			if effect.Action != "none" {
+				affected.Blobs += effect.Blobs
+				affected.Bytes += effect.Bytes
+			}
+		}
+
+		if err := render(cmd.OutOrStdout(), effects, func(w io.Writer) {
+			fmt.Fprintf(w, "Lifecycle rules as of %s:\n", at.Format("2006-01-02"))
+			rule := "-"
+			for _, effect := range effects {
+				name := effect.Rule
+				if name == "" {
+					name = "no rule"
+				}
+				if name != rule {
+					fmt.Fprintf(w, "  %s\n", name)
+					rule = name
+				}
+				fmt.Fprintf(w, "    %-8s %12d blobs %12s\n", effect.Action, effect.Blobs, report.Bytes(effect.Bytes))
+			}
+		}); err != nil {
+			return err
+		}
+
+		summary := cmd.ErrOrStderr()
+		if output == "text" {
+			summary = cmd.OutOrStdout()
+		}
+		fmt.Fprintf(summary, "%d of %d blobs (%s of %s) would be acted on", affected.Blobs, total.Blobs, report.Bytes(affected.Bytes), report.Bytes(total.Bytes))
+		if simulator.Skipped > 0 {
+			fmt.Fprintf(summary, ", %d snapshots, previous versions and deleted blobs left out", simulator.Skipped)
+		}
+		fmt.Fprintln(summary)
+		return nil
+	},
+}
+
+var lifecyclePolicyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Write the Azure lifecycle management policy of the lifecycle rules",
+	Long: `Write the lifecycle rules as an Azure storage lifecycle management policy, in the JSON
+taken by az storage account management-policy create --policy. Rules on access age need last
+access time tracking enabled on the account.`,
+	Example: `  gowithazure lifecycle policy --file policy.json
+  az storage account management-policy create -g storage-rg --account-name usprodvideo --policy @policy.json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rules, err := loadLifecycleRules()
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(rules.Policy(), "", "  ")
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+
+		if lifecycleFile == "-" {
+			_, err = cmd.OutOrStdout().Write(data)
+			return err
+		}
+		if err := os.WriteFile(lifecycleFile, data, 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "Wrote the policy of %d rules to %s\n", len(rules.Rules), lifecycleFile)
+		return nil
+	},
+}
+
+// loadLifecycleRules reads the --rules file, by default lifecycle.yml next
+// to the profiles file.
+func loadLifecycleRules() (*lifecycle.Rules, error) {
+	path := lifecycleRules
+	if path == "" {
+		path = "lifecycle.yml"
+		if profilesFile != "" {
+			path = filepath.Join(filepath.Dir(profilesFile), path)
+		}
+	}
+	rules, err := lifecycle.LoadRules(path)
+	if err != nil {
+		return nil, utility.WithKind(utility.KindConfig, err)
+	}
+	return rules, nil
+}
+
+func init() {
+	lifecycleCmd.PersistentFlags().StringVar(&lifecycleRules, "rules", "", "lifecycle rules file (default lifecycle.yml next to the profiles file, or in the current dir)")
+
+	simulateFlags := lifecycleSimulateCmd.Flags()
+	simulateFlags.StringVarP(&lifecycleInventory, "inventory", "i", "", "blob inventory to simulate the rules on, - for stdin")
+	simulateFlags.StringVar(&lifecycleFormat, "format", "", "format of the inventory, csv or jsonl (default from its extension, else csv)")
+	simulateFlags.StringVar(&lifecycleIn, "in", "0d", "simulate the rules as of this long from now, such as 30d or 8w")
+
+	lifecyclePolicyCmd.Flags().StringVarP(&lifecycleFile, "file", "f", "-", "file to write the policy to, - for stdout")
+
+	lifecycleCmd.AddCommand(lifecycleSimulateCmd)
+	lifecycleCmd.AddCommand(lifecyclePolicyCmd)
+	rootCmd.AddCommand(lifecycleCmd)
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"gowithazure/src/storage"
+
+	"github.com/spf13/cobra"
+)
+
+// listedContainer is one line of the list output.
+type listedContainer struct {
+	Account string `json:"account"`
+	storage.ContainerInfo
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the containers in each storage account",
+	Long: `List the containers in each storage account with their last modified time.
+Containers are written as they are paged in, so large accounts produce long output.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selectedAccounts, err := storageAccounts()
+		if err != nil {
+			return err
+		}
+
+		stream, err := newStream(cmd.OutOrStdout(), func(w io.Writer, item any) {
+			container := item.(listedContainer)
+			fmt.Fprintf(w, "Container Name: %s\n", container.Name)
+			fmt.Fprintf(w, "Container: %v\n", container.LastModified)
+		})
+		if err != nil {
+			return err
+		}
+
+		// Accounts are listed one after the other so the output of each
+		// stays together.
+		w := cmd.OutOrStdout()
+		scan := newScanner()
+		for _, account := range selectedAccounts {
+			total := 0
+			err := storage.ListContainers(cmd.Context(), scan, account, func(container storage.ContainerInfo) {
+				total++
+				stream.Write(listedContainer{account.String(), container})
+			})
+			if err != nil {
+				stream.Close()
+				return err
+			}
+
+			if output == "text" {
+				fmt.Fprintf(w, "There are %v containers in the storage account %s.\n", total, account)
+			}
+		}
+
+		return stream.Close()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+}
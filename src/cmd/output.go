@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"io"
+
+	"gowithazure/src/report"
+)
+
+// render writes result to w in the selected output format. text is used for
+// the human readable format; see the report package for the others.
+func render(w io.Writer, result any, text func(w io.Writer)) error {
+	return report.Render(w, output, result, text)
+}
+
+// newStream returns a stream writing to w in the selected output format, for
+// the commands that report one result at a time instead of collecting them.
+// text writes one item in the human readable format.
+func newStream(w io.Writer, text func(w io.Writer, item any)) (*report.Stream, error) {
+	return report.NewStream(w, output, text)
+}
@@ -0,0 +1,387 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"gowithazure/src/config"
+	"gowithazure/src/rehydrate"
+	"gowithazure/src/report"
+	"gowithazure/src/scanner"
+	"gowithazure/src/utility"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// rehydrateState is the rehydration state file.
+	rehydrateState string
+	// rehydrateOptions are the flags of rehydrate start.
+	rehydrateOptions rehydrate.Options
+	// rehydrateList is a file naming the blobs to rehydrate.
+	rehydrateList string
+	// rehydrateYes requests rehydrations without asking for confirmation.
+	rehydrateYes bool
+	// rehydrateWatch is how often rehydrate status checks again, 0 to check
+	// once.
+	rehydrateWatch time.Duration
+)
+
+// rehydrateSaveInterval is how often rehydrate start saves the state while it
+// requests rehydrations, so that an interrupted run keeps most of them.
+const rehydrateSaveInterval = 10 * time.Second
+
+var rehydrateCmd = &cobra.Command{
+	Use:   "rehydrate",
+	Short: "Bring archived blobs back online and follow their progress",
+	Long: `Rehydrating an archived blob takes hours (up to 15 for Standard priority, under one
+for most High priority requests). rehydrate start requests it, in place or to a copy, and
+records every request in a local state file; rehydrate status then asks the service how
+each one is doing until they are all online.
+
+The state is kept per profile in $XDG_DATA_HOME/gowithazure unless --state is given.`,
+}
+
+var rehydrateStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Request the rehydration of archived blobs",
+	Long: `Request the rehydration of the archived blobs of each storage account to the --to tier
+at --priority, and record them in the state file as they are requested. Blobs that are
+already being rehydrated, or still pending in the state file from an earlier run, are left
+alone, so an interrupted run can be started again.
+
+Blobs are selected either by walking the accounts, narrowed down with --container, --prefix
+and --match like the tier command, or from a --list file with one blob per line: a blob URL,
+or container/blob when a single account is selected. Empty lines and lines starting with #
+are skipped.
+
+With --copy-to, each blob is rehydrated to a copy of the same name in that container of its
+account, and the archived original stays where it is.
+
+Run it with --dry-run first to see the blobs and their total size. Without --dry-run it asks
+for confirmation unless --yes is given.`,
+	Example: `  gowithazure rehydrate start -p us-prod --container video-out --prefix 2023/ --dry-run
+  gowithazure rehydrate start -p us-prod --list restore.txt --priority High --copy-to restored --yes`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		if rehydrateOptions.Tier, err = choose("--to", rehydrateOptions.Tier, rehydrate.Tiers); err != nil {
+			return err
+		}
+		if rehydrateOptions.Priority, err = choose("--priority", rehydrateOptions.Priority, rehydrate.Priorities); err != nil {
+			return err
+		}
+		if rehydrateList != "" && (len(rehydrateOptions.Containers) > 0 || rehydrateOptions.Prefix != "" || rehydrateOptions.Pattern != "") {
+			return utility.New(utility.KindUsage, "--list cannot be combined with --container, --prefix or --match")
+		}
+		for _, pattern := range append([]string{rehydrateOptions.Pattern}, rehydrateOptions.Containers...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return utility.New(utility.KindUsage, "invalid pattern %q", pattern)
+			}
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selectedAccounts, err := storageAccounts()
+		if err != nil {
+			return err
+		}
+		var items []rehydrate.Item
+		if rehydrateList != "" {
+			if items, err = readRehydrateList(rehydrateList, selectedAccounts); err != nil {
+				return err
+			}
+		}
+
+		state, err := openRehydrateState()
+		if err != nil {
+			return err
+		}
+
+		if !rehydrateOptions.DryRun && !rehydrateYes {
+			what := fmt.Sprintf("the archived blobs of %d storage account(s) of profile %s", len(selectedAccounts), profileName)
+			if rehydrateList != "" {
+				what = fmt.Sprintf("the %d blobs listed in %s", len(items), rehydrateList)
+			}
+			how := "in place"
+			if rehydrateOptions.CopyTo != "" {
+				how = "to copies in " + rehydrateOptions.CopyTo
+			}
+			confirmed, err := confirm(cmd, fmt.Sprintf("Rehydrate %s %s to %s at %s priority?", what, how, rehydrateOptions.Tier, rehydrateOptions.Priority), yesHint)
+			if err != nil || !confirmed {
+				return err
+			}
+		}
+
+		rehydrateOptions.State = state
+		stream, err := newStream(cmd.OutOrStdout(), func(w io.Writer, item any) {
+			b := item.(rehydrate.Blob)
+			switch {
+			case b.Status == rehydrate.Skipped:
+				fmt.Fprintf(w, "Already requested '%s/%s' in %s, pending in the state file\n", b.Container, b.Name, b.Account)
+			case b.Status == rehydrate.Failed:
+				fmt.Fprintf(w, "Error rehydrating '%s/%s' in %s: %s\n", b.Container, b.Name, b.Account, b.Error)
+			case rehydrateOptions.DryRun:
+				fmt.Fprintf(w, "Would rehydrate '%s/%s' in %s (%s)\n", b.Container, b.Name, b.Account, report.Bytes(b.Bytes))
+			case b.ArchiveStatus != "":
+				fmt.Fprintf(w, "Already rehydrating '%s/%s' in %s (%s)\n", b.Container, b.Name, b.Account, b.ArchiveStatus)
+			default:
+				fmt.Fprintf(w, "Requested '%s/%s' in %s (%s)\n", b.Container, b.Name, b.Account, report.Bytes(b.Bytes))
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		var requested, skipped, failed, bytes int64
+		saved := time.Now()
+		record := func(b rehydrate.Blob) {
+			stream.Write(b)
+			switch b.Status {
+			case rehydrate.Skipped:
+				skipped++
+				return
+			case rehydrate.Failed:
+				failed++
+				return
+			}
+			requested++
+			bytes += b.Bytes
+			if rehydrateOptions.DryRun {
+				return
+			}
+			state.Add(b)
+			// A failed save is retried at the next interval and at the end,
+			// which reports it.
+			if time.Since(saved) >= rehydrateSaveInterval && state.Save() == nil {
+				saved = time.Now()
+			}
+		}
+		var startErr error
+		if rehydrateList != "" {
+			startErr = rehydrate.StartList(cmd.Context(), newScanner(), selectedAccounts, items, rehydrateOptions, record)
+		} else {
+			startErr = rehydrate.Start(cmd.Context(), newScanner(), selectedAccounts, rehydrateOptions, record)
+		}
+		var saveErr error
+		if !rehydrateOptions.DryRun {
+			saveErr = state.Save()
+		}
+		if err := stream.Close(); err != nil {
+			return err
+		}
+
+		w := cmd.OutOrStdout()
+		if output != "text" {
+			w = cmd.ErrOrStderr()
+		}
+		if rehydrateOptions.DryRun {
+			fmt.Fprintf(w, "Would rehydrate %d blobs (%s) to %s at %s priority, %d already requested\n", requested, report.Bytes(bytes), rehydrateOptions.Tier, rehydrateOptions.Priority, skipped)
+			return startErr
+		}
+		if saveErr != nil {
+			return utility.Wrap(saveErr, "saving rehydration state")
+		}
+		fmt.Fprintf(w, "Requested %d rehydrations (%s) to %s at %s priority, %d already requested, %d failed\n", requested, report.Bytes(bytes), rehydrateOptions.Tier, rehydrateOptions.Priority, skipped, failed)
+		if requested > 0 {
+			fmt.Fprintf(w, "Recorded in %s, follow them with: gowithazure rehydrate status --watch 30m\n", state.Path())
+		}
+		return startErr
+	},
+}
+
+var rehydrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Check how the recorded rehydrations are doing",
+	Long: `Ask the service about every pending rehydration in the state file, record what it says
+and report the blobs that are online, pending and failed. With --watch it checks again at
+that interval until none is pending, printing a progress line each time. An account that
+cannot be reached does not stop the others: its blobs stay pending with the error, and
+--watch keeps checking.
+
+--account limits the check to the given accounts.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selectedAccounts, err := storageAccounts()
+		if err != nil {
+			return err
+		}
+		state, err := openRehydrateState()
+		if err != nil {
+			return err
+		}
+		if len(state.Blobs) == 0 {
+			fmt.Fprintf(cmd.ErrOrStderr(), "No rehydrations recorded in %s, request some with rehydrate start\n", state.Path())
+			return nil
+		}
+
+		// An account that cannot be reached leaves the error on its blobs,
+		// which stay pending, and is reported once the others are rendered.
+		var checkErr error
+		for {
+			checkErr = rehydrate.Check(cmd.Context(), newScanner(), selectedAccounts, state.Pending())
+			if err := state.Save(); err != nil {
+				return utility.Wrap(err, "saving rehydration state")
+			}
+			if err := cmd.Context().Err(); err != nil {
+				return utility.WithKind(utility.KindCanceled, err)
+			}
+			pending := len(state.Pending())
+			if rehydrateWatch == 0 || pending == 0 {
+				break
+			}
+
+			online, failed := countStatuses(state.Blobs)
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s  online %d/%d, pending %d, failed %d, next check in %s\n",
+				time.Now().Format("15:04"), online, len(state.Blobs), pending, failed, rehydrateWatch)
+			if checkErr != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "%s  check failed: %s\n", time.Now().Format("15:04"), config.Redact(checkErr.Error()))
+			}
+			if err := scanner.Sleep(cmd.Context(), rehydrateWatch); err != nil {
+				return utility.WithKind(utility.KindCanceled, err)
+			}
+		}
+
+		renderErr := render(cmd.OutOrStdout(), state.Blobs, func(w io.Writer) {
+			now := time.Now().UTC()
+			for _, b := range state.Blobs {
+				switch b.Status {
+				case rehydrate.Pending:
+					status := b.ArchiveStatus
+					if status == "" {
+						status = "pending"
+					}
+					fmt.Fprintf(w, "pending  %s/%s in %s: %s for %s", b.Container, b.Name, b.Account, status, now.Sub(b.Requested).Round(time.Minute))
+				case rehydrate.Failed:
+					fmt.Fprintf(w, "failed   %s/%s in %s: %s", b.Container, b.Name, b.Account, b.Error)
+				default:
+					container, name := b.Target()
+					fmt.Fprintf(w, "online   %s/%s in %s after %s", container, name, b.Account, b.Online.Sub(b.Requested).Round(time.Minute))
+				}
+				if b.Status == rehydrate.Pending && b.Error != "" {
+					fmt.Fprintf(w, " (last check failed: %s)", b.Error)
+				}
+				fmt.Fprintln(w)
+			}
+			online, failed := countStatuses(state.Blobs)
+			fmt.Fprintf(w, "Online %d of %d, pending %d, failed %d\n", online, len(state.Blobs), len(state.Blobs)-online-failed, failed)
+		})
+		if renderErr != nil {
+			return renderErr
+		}
+		return utility.Wrap(checkErr, "checking rehydrations")
+	},
+}
+
+// openRehydrateState loads the state file at --state or its default path.
+func openRehydrateState() (*rehydrate.State, error) {
+	path := rehydrateState
+	if path == "" {
+		var err error
+		path, err = rehydrate.DefaultPath(profileName)
+		if err != nil {
+			return nil, utility.Wrap(err, "locating rehydration state")
+		}
+	}
+	state, err := rehydrate.Load(path)
+	if err != nil {
+		return nil, utility.WithKind(utility.KindConfig, err)
+	}
+	return state, nil
+}
+
+// readRehydrateList reads the blobs named in a list file: blob URLs of the
+// selected accounts, or container/blob when a single account is selected.
+func readRehydrateList(file string, accounts []config.Account) ([]rehydrate.Item, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, utility.WithKind(utility.KindUsage, err)
+	}
+	defer f.Close()
+
+	var items []rehydrate.Item
+	lines := bufio.NewScanner(f)
+	for n := 1; lines.Scan(); n++ {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		index, rest := 0, line
+		if strings.Contains(line, "://") {
+			index = -1
+			for i, account := range accounts {
+				if after, ok := strings.CutPrefix(line, strings.TrimSuffix(account.String(), "/")+"/"); ok {
+					index, rest = i, after
+					break
+				}
+			}
+			if index < 0 {
+				return nil, utility.New(utility.KindUsage, "%s:%d: %s is not a blob of the selected accounts", file, n, line)
+			}
+			if rest, err = url.PathUnescape(rest); err != nil {
+				return nil, utility.New(utility.KindUsage, "%s:%d: %v", file, n, err)
+			}
+		} else if len(accounts) > 1 {
+			return nil, utility.New(utility.KindUsage, "%s:%d: container/blob lines need a single account, pass --account or use blob URLs", file, n)
+		}
+
+		containerName, name, ok := strings.Cut(rest, "/")
+		if !ok || containerName == "" || name == "" {
+			return nil, utility.New(utility.KindUsage, "%s:%d: expected container/blob, got %q", file, n, rest)
+		}
+		items = append(items, rehydrate.Item{Account: index, Container: containerName, Name: name})
+	}
+	if err := lines.Err(); err != nil {
+		return nil, utility.Wrap(err, "reading %s", file)
+	}
+	return items, nil
+}
+
+// countStatuses counts the blobs that are online and failed.
+func countStatuses(blobs []*rehydrate.Blob) (online, failed int) {
+	for _, b := range blobs {
+		switch b.Status {
+		case rehydrate.Online:
+			online++
+		case rehydrate.Failed:
+			failed++
+		}
+	}
+	return online, failed
+}
+
+// choose returns the value of values named by the value of a flag, in the
+// case used by values.
+func choose(flag, value string, values []string) (string, error) {
+	if i := slices.IndexFunc(values, func(v string) bool { return strings.EqualFold(v, value) }); i >= 0 {
+		return values[i], nil
+	}
+	return "", utility.New(utility.KindUsage, "unsupported %s %q, expected one of %v", flag, value, values)
+}
+
+func init() {
+	rehydrateCmd.PersistentFlags().StringVar(&rehydrateState, "state", "", "rehydration state file (default <profile>-rehydrate.json in $XDG_DATA_HOME/gowithazure)")
+
+	flags := rehydrateStartCmd.Flags()
+	flags.StringSliceVar(&rehydrateOptions.Containers, "container", nil, "only rehydrate blobs of containers with this name or matching this pattern, may be repeated")
+	flags.StringVar(&rehydrateOptions.Prefix, "prefix", "", "only rehydrate blobs whose name starts with this prefix")
+	flags.StringVar(&rehydrateOptions.Pattern, "match", "", "only rehydrate blobs whose name matches this pattern, where * does not match /")
+	flags.StringVar(&rehydrateList, "list", "", "file listing the blobs to rehydrate, one blob URL or container/blob per line")
+	flags.StringVar(&rehydrateOptions.Tier, "to", "Hot", fmt.Sprintf("access tier to rehydrate to, one of %v", rehydrate.Tiers))
+	flags.StringVar(&rehydrateOptions.Priority, "priority", "Standard", fmt.Sprintf("rehydration priority, one of %v", rehydrate.Priorities))
+	flags.StringVar(&rehydrateOptions.CopyTo, "copy-to", "", "rehydrate to a copy in this container of the same account, leaving the original archived")
+	flags.BoolVar(&rehydrateOptions.DryRun, "dry-run", false, "list the archived blobs that would be rehydrated without requesting anything")
+	flags.BoolVarP(&rehydrateYes, "yes", "y", false, "request the rehydrations without asking for confirmation")
+
+	rehydrateStatusCmd.Flags().DurationVar(&rehydrateWatch, "watch", 0, "check again at this interval until no rehydration is pending, such as 30m")
+
+	rehydrateCmd.AddCommand(rehydrateStartCmd)
+	rehydrateCmd.AddCommand(rehydrateStatusCmd)
+	rootCmd.AddCommand(rehydrateCmd)
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"gowithazure/src/checkpoint"
+	"gowithazure/src/config"
+	"gowithazure/src/utility"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	// resume continues a scan from its checkpoint.
+	resume bool
+	// checkpointFile overrides where a scan keeps its checkpoint.
+	checkpointFile string
+)
+
+// addResumeFlags registers --resume and --checkpoint on a resumable command;
+// defaultFile describes where its checkpoint is kept otherwise.
+func addResumeFlags(flags *pflag.FlagSet, defaultFile string) {
+	flags.BoolVar(&resume, "resume", false, "continue an interrupted run from its checkpoint")
+	flags.StringVar(&checkpointFile, "checkpoint", "", fmt.Sprintf("checkpoint file (default %s)", defaultFile))
+}
+
+// scanCheckpoint is the default checkpoint file of a scan command, kept per
+// profile in the user's cache directory.
+func scanCheckpoint(name string) (string, error) {
+	path, err := checkpoint.DefaultPath(profileName + "-" + name)
+	if err != nil {
+		return "", utility.Wrap(err, "locating checkpoint")
+	}
+	return path, nil
+}
+
+// openCheckpoint loads the checkpoint of a scan when resuming and otherwise
+// starts a new one, at --checkpoint or else at path. settings are the flags
+// the results depend on; the selected accounts are added to them.
+func openCheckpoint(path string, accounts []config.Account, settings map[string]string) (*checkpoint.Checkpoint, error) {
+	if checkpointFile != "" {
+		path = checkpointFile
+	}
+	urls := make([]string, len(accounts))
+	for i, account := range accounts {
+		urls[i] = account.String()
+	}
+	settings["accounts"] = strings.Join(urls, " ")
+
+	if !resume {
+		return checkpoint.New(path, settings), nil
+	}
+	progress, err := checkpoint.Load(path, settings)
+	if err != nil {
+		return nil, utility.WithKind(utility.KindUsage, err)
+	}
+	return progress, nil
+}
+
+// finishCheckpoint removes the checkpoint of a scan that completed, or saves
+// it and says how to continue one that did not. It returns scanErr.
+func finishCheckpoint(cmd *cobra.Command, progress *checkpoint.Checkpoint, scanErr error) error {
+	if scanErr == nil {
+		if err := progress.Remove(); err != nil {
+			return utility.Wrap(err, "removing checkpoint")
+		}
+		return nil
+	}
+	if err := progress.Save(); err != nil {
+		return utility.Wrap(err, "saving checkpoint")
+	}
+	fmt.Fprintf(cmd.ErrOrStderr(), "Progress saved to %s, rerun with --resume to continue\n", progress.Path())
+	return scanErr
+}
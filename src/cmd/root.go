@@ -0,0 +1,184 @@
+// Package cmd implements the gowithazure command line tool. Each file in this
+// package defines one subcommand; the flags shared by all of them live here.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+
+	"gowithazure/src/auth"
+	"gowithazure/src/config"
+	"gowithazure/src/keyvault"
+	"gowithazure/src/scanner"
+	"gowithazure/src/storage"
+	"gowithazure/src/utility"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// configFile is the explicit path of the profiles file.
+	configFile string
+	// accounts overrides the storage account URLs from the profile.
+	accounts []string
+	// profile selects the region profile to use.
+	profile string
+	// output selects how results are rendered.
+	output string
+	// concurrency bounds how many accounts or containers are processed at once.
+	concurrency int
+	// workers bounds how many containers have their blobs listed at once;
+	// 0 means the same as concurrency.
+	workers int
+
+	// profilesFile is the profiles file that was loaded, if any.
+	profilesFile string
+	// profileName and selected are the profile resolved by PersistentPreRunE.
+	profileName string
+	selected    config.Profile
+	// evaluations are the evaluations defined in the profiles file.
+	evaluations map[string]config.Evaluation
+	// credential is built from selected on first use.
+	credential     azcore.TokenCredential
+	credentialErr  error
+	credentialOnce sync.Once
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "gowithazure",
+	Short: "Tools for interacting with Azure storage accounts and virtual machines",
+	Long: `gowithazure counts, lists and evaluates the containers in our Azure storage
+accounts, moves blobs between access tiers and lists virtual machines.`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(configFile)
+		if err != nil {
+			return utility.WithKind(utility.KindConfig, err)
+		}
+		profileName, _, err = cfg.Select(profile)
+		if err != nil {
+			return utility.WithKind(utility.KindConfig, err)
+		}
+		// Only the secrets of the selected profile are resolved; config
+		// validate reports those of the others.
+		cfg.ResolveSecrets(cmd.Context(), profileName)
+		if err := cfg.Validate(); err != nil {
+			return utility.WithKind(utility.KindConfig, err)
+		}
+		profilesFile = cfg.File
+		evaluations = cfg.Evaluations
+		selected = cfg.Profiles[profileName]
+
+		// Profile defaults apply to any shared flag not given explicitly.
+		flags := cmd.Flags()
+		if !flags.Changed("output") && selected.Defaults.Output != "" {
+			output = selected.Defaults.Output
+		}
+		if !flags.Changed("concurrency") && selected.Defaults.Concurrency != 0 {
+			concurrency = selected.Defaults.Concurrency
+		}
+		if !flags.Changed("workers") && selected.Defaults.Workers != 0 {
+			workers = selected.Defaults.Workers
+		}
+
+		return checkSharedFlags()
+	},
+}
+
+// Execute runs the root command. Ctrl-C or SIGTERM cancel the command's
+// context, so scans stop promptly and exit with the canceled code. Failures
+// are reported with any secret values redacted and the process exits with the
+// code for their kind (see utility.Kind).
+func Execute() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	if err != nil {
+		os.Exit(utility.Report(rootCmd.ErrOrStderr(), err, config.Redact))
+	}
+}
+
+func init() {
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return utility.WithKind(utility.KindUsage, err)
+	})
+
+	// Key Vault references are read with the default credential chain, as
+	// the profile credentials may themselves live in the vault.
+	config.RegisterSecretResolver("keyvault", &keyvault.Resolver{
+		Credential: func() (azcore.TokenCredential, error) {
+			return auth.NewCredential(config.Credentials{Source: "default"})
+		},
+	})
+
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&configFile, "config", "", fmt.Sprintf("profiles file to load (default $%s, then the XDG config dir, the executable's dir and the current dir)", config.ConfigEnv))
+	flags.StringSliceVarP(&accounts, "account", "a", nil, "storage account URL to process, may be repeated (defaults to the accounts in the profile)")
+	flags.StringVarP(&profile, "profile", "p", "", fmt.Sprintf("region profile from the profiles file (default $%s, then the file's default, then %q)", config.ProfileEnv, config.DefaultProfile))
+	flags.StringVarP(&output, "output", "o", "text", fmt.Sprintf("output format, one of %v", config.OutputFormats))
+	flags.IntVarP(&concurrency, "concurrency", "c", 4, "maximum number of accounts or containers processed at once")
+	flags.IntVar(&workers, "workers", 0, "maximum number of containers whose blobs are listed at once (default the value of --concurrency)")
+}
+
+// checkSharedFlags validates the values of the flags shared by every command.
+func checkSharedFlags() error {
+	if !slices.Contains(config.OutputFormats, output) {
+		return utility.New(utility.KindUsage, "unsupported output format %q, expected one of %v", output, config.OutputFormats)
+	}
+	if concurrency < 1 {
+		return utility.New(utility.KindUsage, "concurrency must be at least 1, got %d", concurrency)
+	}
+	if workers < 0 {
+		return utility.New(utility.KindUsage, "workers must not be negative, got %d", workers)
+	}
+	return nil
+}
+
+// storageAccounts returns the storage accounts to process: those given with
+// --account, or else the accounts of the selected profile.
+func storageAccounts() ([]config.Account, error) {
+	selectedAccounts := selected.Accounts
+	if len(accounts) > 0 {
+		selectedAccounts = make([]config.Account, len(accounts))
+		for i, value := range accounts {
+			selectedAccounts[i] = config.ParseAccount(value)
+		}
+	}
+	if len(selectedAccounts) == 0 {
+		return nil, utility.New(utility.KindConfig, "no storage accounts configured for profile %q, pass --account", profileName)
+	}
+
+	return selectedAccounts, nil
+}
+
+// profileCredential returns the credential of the selected profile, building
+// it on first use. See auth/azurelogin.go for the available strategies.
+func profileCredential() (azcore.TokenCredential, error) {
+	credentialOnce.Do(func() {
+		credential, credentialErr = auth.NewCredential(selected.Credentials)
+		credentialErr = utility.WithKind(utility.KindAuth, credentialErr)
+	})
+	return credential, credentialErr
+}
+
+// newClient creates a blob client for the account, authenticating with the
+// profile's credential unless the account carries its own key or SAS.
+func newClient(account config.Account) (*azblob.Client, error) {
+	return storage.NewClient(account, profileCredential)
+}
+
+// newScanner returns a scanner over the storage accounts bounded by
+// --concurrency and --workers.
+func newScanner() *scanner.Scanner {
+	scan := scanner.New(concurrency, newClient)
+	scan.Workers = workers
+	return scan
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"strconv"
+	"strings"
+
+	"gowithazure/src/utility"
+)
+
+// sizeUnits are the suffixes parseSize understands, longest first so "KiB"
+// is not read as "B".
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"B", 1},
+}
+
+// parseSize parses the value of a size flag: a number of bytes, optionally
+// followed by a unit such as KiB, MB or GiB.
+func parseSize(flag, value string) (int64, error) {
+	invalid := utility.New(utility.KindUsage, "invalid %s %q, expected a size such as 4096, 512KiB or 10MB", flag, value)
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(strings.ToUpper(value), strings.ToUpper(u.suffix)) {
+			value, unit = strings.TrimSpace(value[:len(value)-len(u.suffix)]), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, invalid
+	}
+	return int64(n * float64(unit)), nil
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"gowithazure/src/history"
+	"gowithazure/src/report"
+	"gowithazure/src/utility"
+
+	"github.com/spf13/cobra"
+)
+
+// snapshotBlobs counts and sizes every blob instead of only probing for one.
+var snapshotBlobs bool
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Record the containers of each storage account in the history database",
+	Long: `Scan the storage accounts and record every container, with its last modified time
+and whether it is empty, in the local history database under the profile and the time
+of the run. With --blobs every blob is counted and sized as well.
+
+Run it on a schedule and use the history command to follow container counts, the stale
+-in/-out backlog and empty containers over days and weeks.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selectedAccounts, err := storageAccounts()
+		if err != nil {
+			return err
+		}
+		store, err := openHistory()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		snapshot, scanErr := history.Take(cmd.Context(), newScanner(), selectedAccounts, profileName, snapshotBlobs)
+		// A run stopped halfway says nothing about the accounts; one with
+		// failed accounts is kept with their errors.
+		if utility.KindOf(scanErr) == utility.KindCanceled {
+			return scanErr
+		}
+		if err := store.Save(snapshot); err != nil {
+			return utility.Wrap(err, "saving snapshot")
+		}
+
+		summaries := snapshot.Summaries()
+		err = render(cmd.OutOrStdout(), summaries, func(w io.Writer) {
+			fmt.Fprintf(w, "Snapshot of profile %s at %s\n", snapshot.Profile, snapshot.Time.Format("2006-01-02 15:04:05 MST"))
+			for _, summary := range summaries {
+				fmt.Fprintf(w, "Storage account: %s\n", summary.Account)
+				if summary.Error != "" {
+					fmt.Fprintf(w, "  Error: %s\n", summary.Error)
+				}
+				fmt.Fprintf(w, "  Containers: %d, empty: %d\n", summary.Containers, summary.Empty)
+				fmt.Fprintf(w, "  Stale -in: %d, stale -out: %d\n", summary.StaleIn, summary.StaleOut)
+				if snapshot.Blobs {
+					fmt.Fprintf(w, "  Blobs: %d, size: %s\n", summary.Blobs, report.Bytes(summary.Bytes))
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		return scanErr
+	},
+}
+
+func init() {
+	snapshotCmd.Flags().BoolVar(&snapshotBlobs, "blobs", false, "also count and size the blobs in every container (slow on large accounts)")
+	addHistoryFlags(snapshotCmd)
+	rootCmd.AddCommand(snapshotCmd)
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"gowithazure/src/storage"
+
+	"github.com/spf13/cobra"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Summarise containers by name length and age",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selectedAccounts, err := storageAccounts()
+		if err != nil {
+			return err
+		}
+
+		results, scanErr := storage.Stats(cmd.Context(), newScanner(), selectedAccounts)
+
+		err = render(cmd.OutOrStdout(), results, func(w io.Writer) {
+			for _, stats := range results {
+				fmt.Fprintf(w, "Azure Storage Account Container Count %s\n", stats.URL)
+				if stats.Error != "" {
+					fmt.Fprintf(w, "Error: %s\n", stats.Error)
+				}
+				fmt.Fprintf(w, "There are %v containers in the storage account.\n", stats.TotalContainers)
+
+				fmt.Fprintln(w, "Containers by name length:")
+				lengths := make([]int, 0, len(stats.NameLengthCounts))
+				for nameLen := range stats.NameLengthCounts {
+					lengths = append(lengths, nameLen)
+				}
+				sort.Ints(lengths)
+				for _, nameLen := range lengths {
+					fmt.Fprintf(w, "  Containers with name length of %d characters: %d\n", nameLen, stats.NameLengthCounts[nameLen])
+				}
+
+				fmt.Fprintf(w, "Containers last modified more than two years ago: %d\n", stats.OlderThanTwoYears)
+				fmt.Fprintf(w, "Containers modified within the last 30 days: %d\n", stats.ModifiedLast30Days)
+				fmt.Fprintln(w, "--------------------------------------------------")
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		return scanErr
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+}
@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gowithazure/src/checkpoint"
+	"gowithazure/src/report"
+	"gowithazure/src/storage"
+	"gowithazure/src/utility"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// tierOptions are the flags selecting the blobs to move.
+	tierOptions storage.TierOptions
+	// tierOlderThan and tierMinSize are the unparsed --older-than and
+	// --min-size.
+	tierOlderThan string
+	tierMinSize   string
+	// tierYes moves blobs without asking for confirmation.
+	tierYes bool
+)
+
+var tierCmd = &cobra.Command{
+	Use:   "tier",
+	Short: "Move the blobs that match the filters from one access tier to another",
+	Long: `Walk the containers of each storage account and move the block blobs in the --from
+access tier (Hot by default) to the --to tier (Cool by default). Only the blobs matching
+every filter given are moved:
+
+- --container: container names, or patterns such as "video-*", may be repeated;
+- --prefix and --match: the start of the blob name, or a pattern such as "*/raw/*.mp4";
+- --older-than: blobs not modified (or, with --age-by access, not read) for that long;
+- --min-size: blobs of at least that size, such as 100MiB.
+
+Blobs are moved in Blob Batch requests of up to --batch-size blobs per container, and
+blobs that are throttled or fail transiently are retried.
+
+Run it with --dry-run first: it lists the blobs that would be moved and sums their size
+without changing anything. Without --dry-run it asks for confirmation unless --yes is
+given.
+
+Progress is saved to a checkpoint as pages of blobs are moved. If the run fails or is
+interrupted, rerun it with --resume and the same flags to continue where it stopped.`,
+	Example: `  gowithazure tier -p us-prod --container 'video-*' --older-than 90d --dry-run
+  gowithazure tier -p us-prod --to Cold --prefix raw/ --min-size 1GiB --yes`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		if tierOptions.From, err = choose("--from", tierOptions.From, storage.AccessTiers); err != nil {
+			return err
+		}
+		if tierOptions.To, err = choose("--to", tierOptions.To, storage.AccessTiers); err != nil {
+			return err
+		}
+		if tierOptions.From == tierOptions.To {
+			return utility.New(utility.KindUsage, "--from and --to are both %s", tierOptions.From)
+		}
+		if tierOptions.From == storage.AccessTiers[len(storage.AccessTiers)-1] {
+			return utility.New(utility.KindUsage, "archived blobs have to be rehydrated, they cannot be moved with tier")
+		}
+		if !slices.Contains(storage.AgeBases, tierOptions.AgeBy) {
+			return utility.New(utility.KindUsage, "unsupported --age-by %q, expected one of %v", tierOptions.AgeBy, storage.AgeBases)
+		}
+		for _, pattern := range append([]string{tierOptions.Pattern}, tierOptions.Containers...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return utility.New(utility.KindUsage, "invalid pattern %q", pattern)
+			}
+		}
+		tierOptions.OlderThan = 0
+		if tierOlderThan != "" {
+			if tierOptions.OlderThan, err = parseAge("--older-than", tierOlderThan); err != nil {
+				return err
+			}
+		}
+		if tierOptions.BatchSize < 1 || tierOptions.BatchSize > storage.MaxBatchSize {
+			return utility.New(utility.KindUsage, "--batch-size must be between 1 and %d", storage.MaxBatchSize)
+		}
+		tierOptions.MinSize, err = parseSize("--min-size", tierMinSize)
+		return err
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selectedAccounts, err := storageAccounts()
+		if err != nil {
+			return err
+		}
+
+		scan := newScanner()
+		var progress *checkpoint.Checkpoint
+		if !tierOptions.DryRun {
+			if !tierYes {
+				confirmed, err := confirm(cmd, fmt.Sprintf("Move %s blobs%s to %s in %d storage account(s) of profile %s?",
+					tierOptions.From, describeTierFilters(), tierOptions.To, len(selectedAccounts), profileName), yesHint)
+				if err != nil || !confirmed {
+					return err
+				}
+			}
+
+			file, err := scanCheckpoint("tier")
+			if err != nil {
+				return err
+			}
+			progress, err = openCheckpoint(file, selectedAccounts, map[string]string{
+				"from":       tierOptions.From,
+				"to":         tierOptions.To,
+				"container":  strings.Join(tierOptions.Containers, ","),
+				"prefix":     tierOptions.Prefix,
+				"match":      tierOptions.Pattern,
+				"older-than": tierOptions.OlderThan.String(),
+				"age-by":     tierOptions.AgeBy,
+				"min-size":   strconv.FormatInt(tierOptions.MinSize, 10),
+			})
+			if err != nil {
+				return err
+			}
+			scan.Progress = progress
+		}
+
+		stream, err := newStream(cmd.OutOrStdout(), func(w io.Writer, item any) {
+			change := item.(storage.TierChange)
+			switch {
+			case change.DryRun:
+				fmt.Fprintf(w, "Would move '%s/%s' in %s (%s) from %s to %s\n", change.Container, change.Blob, change.Account, report.Bytes(change.Bytes), change.From, change.To)
+			case change.Error != "":
+				fmt.Fprintf(w, "Error setting blob tier for '%s/%s' in %s: %s\n", change.Container, change.Blob, change.Account, change.Error)
+			default:
+				fmt.Fprintf(w, "Moved '%s/%s' in %s (%s) from %s to %s\n", change.Container, change.Blob, change.Account, report.Bytes(change.Bytes), change.From, change.To)
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		// summaries tally the changes of each account in the order they
+		// were first seen.
+		type summary struct {
+			account              string
+			blobs, bytes, failed int64
+		}
+		var summaries []*summary
+		byAccount := make(map[string]*summary)
+		tierOptions.Credential = profileCredential
+		start := time.Now()
+		stats, scanErr := storage.Tier(cmd.Context(), scan, selectedAccounts, tierOptions, func(change storage.TierChange) {
+			stream.Write(change)
+			s := byAccount[change.Account]
+			if s == nil {
+				s = &summary{account: change.Account}
+				byAccount[change.Account] = s
+				summaries = append(summaries, s)
+			}
+			if change.Error != "" {
+				s.failed++
+				return
+			}
+			s.blobs++
+			s.bytes += change.Bytes
+		})
+		if err := stream.Close(); err != nil {
+			return err
+		}
+
+		// The summary goes with the text output, and to stderr when stdout
+		// carries machine readable output.
+		w := cmd.OutOrStdout()
+		if output != "text" {
+			w = cmd.ErrOrStderr()
+		}
+		verb := "Moved"
+		if tierOptions.DryRun {
+			verb = "Would move"
+		}
+		var blobs, bytes int64
+		for _, s := range summaries {
+			fmt.Fprintf(w, "%s %d blobs (%s) to %s in %s", verb, s.blobs, report.Bytes(s.bytes), tierOptions.To, s.account)
+			if s.failed > 0 {
+				fmt.Fprintf(w, ", %d failed", s.failed)
+			}
+			fmt.Fprintln(w)
+			blobs += s.blobs
+			bytes += s.bytes
+		}
+		fmt.Fprintf(w, "%s %d blobs (%s) from %s to %s in total\n", verb, blobs, report.Bytes(bytes), tierOptions.From, tierOptions.To)
+		if !tierOptions.DryRun && stats.Requests > 0 {
+			elapsed := time.Since(start)
+			seconds := max(elapsed.Seconds(), 0.001)
+			fmt.Fprintf(w, "Took %s: %.1f blobs/s, %s/s, in %d requests with %d blobs retried\n",
+				elapsed.Round(time.Millisecond), float64(blobs)/seconds, report.Bytes(int64(float64(bytes)/seconds)), stats.Requests, stats.Retried)
+		}
+
+		if tierOptions.DryRun {
+			return scanErr
+		}
+		return finishCheckpoint(cmd, progress, scanErr)
+	},
+}
+
+// describeTierFilters summarises the filters given to tier for the
+// confirmation prompt.
+func describeTierFilters() string {
+	var filters []string
+	if len(tierOptions.Containers) > 0 {
+		filters = append(filters, "in containers "+strings.Join(tierOptions.Containers, ", "))
+	}
+	if tierOptions.Prefix != "" {
+		filters = append(filters, fmt.Sprintf("starting with %q", tierOptions.Prefix))
+	}
+	if tierOptions.Pattern != "" {
+		filters = append(filters, fmt.Sprintf("matching %q", tierOptions.Pattern))
+	}
+	if tierOptions.OlderThan > 0 {
+		event := "modified"
+		if tierOptions.AgeBy == "access" {
+			event = "accessed"
+		}
+		filters = append(filters, fmt.Sprintf("%s more than %s ago", event, tierOlderThan))
+	}
+	if tierOptions.MinSize > 0 {
+		filters = append(filters, "of at least "+report.Bytes(tierOptions.MinSize))
+	}
+	if len(filters) == 0 {
+		return ""
+	}
+	return " " + strings.Join(filters, ", ")
+}
+
+// yesHint is the confirmation hint of the commands that take --yes.
+const yesHint = "pass --yes to go ahead without it"
+
+// confirm asks question on stderr and reads the answer from stdin. Only "y"
+// or "yes" confirms; when there is no answer to read, such as when stdin is
+// not a terminal, it fails with hint, which says how to skip the question.
+func confirm(cmd *cobra.Command, question, hint string) (bool, error) {
+	fmt.Fprintf(cmd.ErrOrStderr(), "%s [y/N] ", question)
+	answer, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(cmd.ErrOrStderr())
+		return false, utility.New(utility.KindUsage, "no answer to the confirmation, %s", hint)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		fmt.Fprintln(cmd.ErrOrStderr(), "Nothing changed.")
+		return false, nil
+	}
+	return true, nil
+}
+
+func init() {
+	flags := tierCmd.Flags()
+	flags.StringVar(&tierOptions.From, "from", "Hot", fmt.Sprintf("access tier of the blobs to move, one of %v", storage.AccessTiers[:len(storage.AccessTiers)-1]))
+	flags.StringVar(&tierOptions.To, "to", "Cool", fmt.Sprintf("access tier to move the blobs to, one of %v", storage.AccessTiers))
+	flags.StringSliceVar(&tierOptions.Containers, "container", nil, "only move blobs of containers with this name or matching this pattern, may be repeated")
+	flags.StringVar(&tierOptions.Prefix, "prefix", "", "only move blobs whose name starts with this prefix")
+	flags.StringVar(&tierOptions.Pattern, "match", "", "only move blobs whose name matches this pattern, where * does not match /, such as '*/raw/*.mp4'")
+	flags.StringVar(&tierOlderThan, "older-than", "", "only move blobs older than this, in days (90d), weeks (12w) or a duration")
+	flags.StringVar(&tierOptions.AgeBy, "age-by", "modified", fmt.Sprintf("what --older-than measures from, one of %v", storage.AgeBases))
+	flags.StringVar(&tierMinSize, "min-size", "0", "only move blobs of at least this size, such as 100MiB")
+	flags.IntVar(&tierOptions.BatchSize, "batch-size", storage.MaxBatchSize, "number of blobs moved per Blob Batch request, 1 to move them one request at a time")
+	flags.BoolVar(&tierOptions.DryRun, "dry-run", false, "list the blobs that would be moved and their total size without moving them")
+	flags.BoolVarP(&tierYes, "yes", "y", false, "move the blobs without asking for confirmation")
+	addResumeFlags(flags, "<profile>-tier.checkpoint in the user cache directory")
+	rootCmd.AddCommand(tierCmd)
+}
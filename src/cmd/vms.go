@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gowithazure/src/utility"
+	"gowithazure/src/vms"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// vmsAll processes every subscription without prompting.
+	vmsAll bool
+	// vmsDetailed resolves network interfaces to IP addresses.
+	vmsDetailed bool
+	// vmsCSV exports the results to a timestamped CSV file.
+	vmsCSV bool
+)
+
+var vmsCmd = &cobra.Command{
+	Use:   "vms",
+	Short: "List the virtual machines across Azure subscriptions",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		w := cmd.OutOrStdout()
+		log := cmd.ErrOrStderr()
+
+		// Authenticate to Azure
+		fmt.Fprintln(log, "Authenticating to Azure...")
+		cred, err := profileCredential()
+		if err != nil {
+			return utility.Wrap(err, "failed to obtain Azure credential")
+		}
+
+		fmt.Fprintln(log, "Fetching all subscriptions...")
+		subscriptions, err := vms.ListSubscriptions(ctx, cred)
+		if err != nil {
+			return err
+		}
+
+		in := bufio.NewReader(os.Stdin)
+
+		// Display subscriptions and let user select
+		if !vmsAll {
+			subscriptions = vms.SelectSubscriptions(subscriptions, in, log)
+			if len(subscriptions) == 0 {
+				fmt.Fprintln(log, "No subscriptions selected. Exiting.")
+				return nil
+			}
+		}
+
+		// Ask if user wants to collect detailed network information
+		detailed := vmsDetailed
+		if !detailed && !cmd.Flags().Changed("detailed") {
+			fmt.Fprintln(log, "\nCollect detailed network information? This may take longer. (y/n):")
+			answer, _ := in.ReadString('\n')
+			answer = strings.ToLower(strings.TrimSpace(answer))
+			detailed = answer == "y" || answer == "yes"
+		}
+
+		allVMs := vms.ListVMs(ctx, cred, subscriptions, detailed, log)
+		fmt.Fprintf(log, "Processing complete. Found %d VMs total.\n", len(allVMs))
+
+		if vmsCSV {
+			if _, err := vms.ExportCSV(allVMs, log); err != nil {
+				return err
+			}
+		}
+
+		return render(w, allVMs, func(w io.Writer) {
+			vms.PrintVMTable(w, allVMs)
+		})
+	},
+}
+
+func init() {
+	vmsCmd.Flags().BoolVar(&vmsAll, "all", false, "process every subscription instead of prompting for a selection")
+	vmsCmd.Flags().BoolVar(&vmsDetailed, "detailed", false, "collect detailed network information (prompted for when not set)")
+	vmsCmd.Flags().BoolVar(&vmsCSV, "csv", true, "export the results to a timestamped CSV file")
+	rootCmd.AddCommand(vmsCmd)
+}
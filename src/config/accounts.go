@@ -0,0 +1,168 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// Azurite's well-known development account, used for UseDevelopmentStorage=true.
+const (
+	devStoreAccountName = "devstoreaccount1"
+	devStoreAccountKey  = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+	devStoreBlobURL     = "http://127.0.0.1:10000/devstoreaccount1"
+)
+
+// Account is one storage account of a profile. In the profiles file it is
+// either a plain URL, which authenticates with the profile's credentials, or
+// an object that sets at most one of accountKey, sas or connectionString:
+//
+//	accounts:
+//	  - https://aadonly.blob.core.windows.net/
+//	  - url: https://keyonly.blob.core.windows.net/
+//	    accountKey: base64key==
+//	  - url: https://sasonly.blob.core.windows.net/
+//	    sas: sv=2022-11-02&ss=b&srt=sco&sp=rl&sig=...
+//	  - connectionString: UseDevelopmentStorage=true
+type Account struct {
+	URL string `mapstructure:"url" json:"url,omitempty" yaml:"url,omitempty"`
+	// AccountName is only needed with AccountKey when it can't be taken
+	// from the URL.
+	AccountName      string `mapstructure:"accountName" json:"accountName,omitempty" yaml:"accountName,omitempty"`
+	AccountKey       string `mapstructure:"accountKey" json:"accountKey,omitempty" yaml:"accountKey,omitempty"`
+	SAS              string `mapstructure:"sas" json:"sas,omitempty" yaml:"sas,omitempty"`
+	ConnectionString string `mapstructure:"connectionString" json:"connectionString,omitempty" yaml:"connectionString,omitempty"`
+}
+
+// ParseAccount turns a value given on the command line into an Account. A
+// value containing '=' is taken as a connection string, anything else as a URL.
+func ParseAccount(value string) Account {
+	if strings.Contains(value, "=") && !strings.Contains(value, "://") {
+		return Account{ConnectionString: value}
+	}
+	return Account{URL: value}
+}
+
+// String returns the blob endpoint of the account, without any SAS, for use
+// in reports and logs.
+func (a Account) String() string {
+	if resolved, err := a.Resolve(); err == nil {
+		return resolved.URL
+	}
+	return a.URL
+}
+
+// Resolve expands a connection string into URL, AccountName and AccountKey or
+// SAS, splits a SAS query off the URL and fills in AccountName from the URL
+// for shared key accounts.
+func (a Account) Resolve() (Account, error) {
+	if a.ConnectionString != "" {
+		parsed, err := ParseConnectionString(a.ConnectionString)
+		if err != nil {
+			return a, err
+		}
+		a = parsed
+	}
+	if base, query, ok := strings.Cut(a.URL, "?"); ok && a.SAS == "" {
+		a.URL, a.SAS = base, query
+	}
+	if a.AccountKey != "" && a.AccountName == "" {
+		a.AccountName = accountNameFromURL(a.URL)
+		if a.AccountName == "" {
+			return a, fmt.Errorf("cannot determine the account name of %q, set accountName", a.URL)
+		}
+	}
+	a.SAS = strings.TrimPrefix(a.SAS, "?")
+	return a, nil
+}
+
+// ParseConnectionString reads an Azure storage connection string. Besides the
+// AccountName/AccountKey form it understands BlobEndpoint, SharedAccessSignature
+// and UseDevelopmentStorage=true for the local Azurite emulator.
+func ParseConnectionString(connectionString string) (Account, error) {
+	fields := make(map[string]string)
+	for _, part := range strings.Split(strings.TrimRight(connectionString, ";"), ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return Account{}, fmt.Errorf("malformed connection string, expected key=value pairs separated by semicolons")
+		}
+		fields[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	if strings.EqualFold(fields["UseDevelopmentStorage"], "true") {
+		endpoint := devStoreBlobURL
+		if proxy := fields["DevelopmentStorageProxyUri"]; proxy != "" {
+			endpoint = strings.TrimRight(proxy, "/") + "/" + devStoreAccountName
+		}
+		return Account{URL: endpoint, AccountName: devStoreAccountName, AccountKey: devStoreAccountKey}, nil
+	}
+
+	account := Account{
+		URL:         fields["BlobEndpoint"],
+		AccountName: fields["AccountName"],
+		AccountKey:  fields["AccountKey"],
+		SAS:         fields["SharedAccessSignature"],
+	}
+	if account.URL == "" {
+		if account.AccountName == "" {
+			return Account{}, fmt.Errorf("connection string needs BlobEndpoint or AccountName")
+		}
+		protocol := fields["DefaultEndpointsProtocol"]
+		if protocol == "" {
+			protocol = "https"
+		}
+		suffix := fields["EndpointSuffix"]
+		if suffix == "" {
+			suffix = "core.windows.net"
+		}
+		account.URL = fmt.Sprintf("%s://%s.blob.%s/", protocol, account.AccountName, suffix)
+	}
+	if account.AccountKey == "" && account.SAS == "" {
+		return Account{}, fmt.Errorf("connection string needs AccountKey or SharedAccessSignature")
+	}
+
+	return account, nil
+}
+
+// accountNameFromURL returns the account name of a blob endpoint: the first
+// host label, or the first path segment for emulator style URLs.
+func accountNameFromURL(account string) string {
+	u, err := url.Parse(account)
+	if err != nil {
+		return ""
+	}
+	if isEmulatorHost(u.Hostname()) {
+		name, _, _ := strings.Cut(strings.Trim(u.Path, "/"), "/")
+		return name
+	}
+	name, _, _ := strings.Cut(u.Hostname(), ".")
+	return name
+}
+
+// isEmulatorHost reports whether host is local, as Azurite is.
+func isEmulatorHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// stringToAccountHook lets an account be written as a plain URL string.
+func stringToAccountHook(from, to reflect.Type, data any) (any, error) {
+	if from.Kind() != reflect.String || to != reflect.TypeOf(Account{}) {
+		return data, nil
+	}
+	return Account{URL: data.(string)}, nil
+}
+
+// decodeHook is viper's default decode hook plus stringToAccountHook.
+var decodeHook = mapstructure.ComposeDecodeHookFunc(
+	stringToAccountHook,
+	mapstructure.StringToTimeDurationHookFunc(),
+	mapstructure.StringToSliceHookFunc(","),
+)
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gowithazure/src/report"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// ProfileEnv is the environment variable consulted for the profile name when
+// --profile is not given.
+const ProfileEnv = "GOWITHAZURE_PROFILE"
+
+// DefaultProfile is used when neither --profile, ProfileEnv nor the default
+// key of the profiles file name a profile.
+const DefaultProfile = "dev"
+
+// OutputFormats are the values accepted by --output and defaults.output.
+var OutputFormats = report.Formats
+
+// Config is the contents of the profiles file. Each region (dev, us-prod,
+// eu-prod, au-prod, ...) is a profile, so adding a region is a config change.
+type Config struct {
+	Default  string             `mapstructure:"default" json:"default,omitempty" yaml:"default,omitempty"`
+	Profiles map[string]Profile `mapstructure:"profiles" json:"profiles,omitempty" yaml:"profiles,omitempty"`
+	// Evaluations are the evaluations of the evaluate command by name,
+	// shared by every profile.
+	Evaluations map[string]Evaluation `mapstructure:"evaluations" json:"evaluations,omitempty" yaml:"evaluations,omitempty"`
+
+	// File is the path of the profiles file that was loaded, if any.
+	File string `mapstructure:"-" json:"-" yaml:"-"`
+	// unknown are the keys in the file that match no field of Config.
+	unknown []string
+	// unresolved are the secret references that could not be resolved.
+	unresolved []Problem
+}
+
+// Profile holds the storage accounts of one region along with the credentials
+// used to reach them and the defaults for the shared command line flags. The
+// credentials are used for every account that does not carry its own key,
+// SAS or connection string.
+type Profile struct {
+	// Region is the Azure region of the accounts, such as eastus, used to
+	// look up their prices.
+	Region      string      `mapstructure:"region" json:"region,omitempty" yaml:"region,omitempty"`
+	Accounts    []Account   `mapstructure:"accounts" json:"accounts,omitempty" yaml:"accounts,omitempty"`
+	Credentials Credentials `mapstructure:"credentials" json:"credentials,omitempty" yaml:"credentials,omitempty"`
+	Defaults    Defaults    `mapstructure:"defaults" json:"defaults,omitempty" yaml:"defaults,omitempty"`
+}
+
+// Credentials describes where a profile's Azure credentials come from. Source
+// picks the strategy; the other fields are used by the strategies that need
+// them:
+//
+//	default            environment, workload identity, managed identity, then az login
+//	client-secret      tenantId, clientId, clientSecret (service-principal is an alias)
+//	client-certificate tenantId, clientId, certificateFile, certificatePassword
+//	workload-identity  tenantId, clientId, tokenFile (each defaults to the webhook's env vars)
+//	managed-identity   clientId of a user-assigned identity, or none for system-assigned
+//	azure-cli          tenantId, optional
+//	chained            chain, a list of credentials tried in order
+type Credentials struct {
+	Source              string        `mapstructure:"source" json:"source,omitempty" yaml:"source,omitempty"`
+	TenantID            string        `mapstructure:"tenantId" json:"tenantId,omitempty" yaml:"tenantId,omitempty"`
+	ClientID            string        `mapstructure:"clientId" json:"clientId,omitempty" yaml:"clientId,omitempty"`
+	ClientSecret        string        `mapstructure:"clientSecret" json:"clientSecret,omitempty" yaml:"clientSecret,omitempty"`
+	CertificateFile     string        `mapstructure:"certificateFile" json:"certificateFile,omitempty" yaml:"certificateFile,omitempty"`
+	CertificatePassword string        `mapstructure:"certificatePassword" json:"certificatePassword,omitempty" yaml:"certificatePassword,omitempty"`
+	TokenFile           string        `mapstructure:"tokenFile" json:"tokenFile,omitempty" yaml:"tokenFile,omitempty"`
+	Chain               []Credentials `mapstructure:"chain" json:"chain,omitempty" yaml:"chain,omitempty"`
+}
+
+// Defaults override the default values of the shared command line flags.
+type Defaults struct {
+	Output      string `mapstructure:"output" json:"output,omitempty" yaml:"output,omitempty"`
+	Concurrency int    `mapstructure:"concurrency" json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+	Workers     int    `mapstructure:"workers" json:"workers,omitempty" yaml:"workers,omitempty"`
+}
+
+// Load finds the profiles file (see SearchPath) and reads it. explicit is the
+// value of --config. Secret references such as file:/run/secrets/x, env:VAR
+// or keyvault:<vault>/<secret> are left in place until ResolveSecrets. A
+// missing file is not an error, it simply yields a Config with no profiles.
+// The result is not validated; call Validate before relying on it.
+func Load(explicit string) (*Config, error) {
+	var cfg Config
+
+	file, err := Find(explicit)
+	if err != nil {
+		return nil, err
+	}
+	if file == "" {
+		return &cfg, nil
+	}
+
+	viper.SetConfigFile(file)
+	viper.AutomaticEnv()
+	viper.SetConfigType("yml")
+
+	if err := viper.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	cfg.File = viper.ConfigFileUsed()
+
+	var metadata mapstructure.Metadata
+	if err := viper.Unmarshal(&cfg, func(dc *mapstructure.DecoderConfig) {
+		dc.Metadata = &metadata
+		dc.DecodeHook = decodeHook
+	}); err != nil {
+		return nil, fmt.Errorf("error decoding config file %s: %w", cfg.File, err)
+	}
+	// mapstructure reports map keys as profiles[dev].key; match the dotted
+	// form used everywhere else.
+	for _, key := range metadata.Unused {
+		cfg.unknown = append(cfg.unknown, strings.NewReplacer("[", ".", "]", "").Replace(key))
+	}
+	sort.Strings(cfg.unknown)
+
+	return &cfg, nil
+}
+
+// ProfileNames returns the names of the configured profiles in sorted order.
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Select resolves the profile to use. An explicit name (from --profile) wins,
+// then ProfileEnv, then the default key of the file and finally DefaultProfile.
+// An explicitly named profile must exist; a defaulted one may be absent, in
+// which case an empty Profile is returned.
+func (c *Config) Select(name string) (string, Profile, error) {
+	explicit := true
+	if name == "" {
+		name = os.Getenv(ProfileEnv)
+	}
+	if name == "" {
+		name, explicit = c.Default, false
+	}
+	if name == "" {
+		name = DefaultProfile
+	}
+
+	profile, ok := c.Profiles[name]
+	if !ok && (explicit || c.Default != "") {
+		return name, profile, fmt.Errorf("unknown profile %q, expected one of %v", name, c.ProfileNames())
+	}
+
+	return name, profile, nil
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// Evaluation defines what the evaluate command counts in each storage
+// account: the containers that pass Match and have not been modified for
+// more than OlderThanDays (0 counts them whatever their age), and how many of
+// those fall in each bucket. A container may fall in several buckets.
+type Evaluation struct {
+	OlderThanDays int      `mapstructure:"olderThanDays" json:"olderThanDays,omitempty" yaml:"olderThanDays,omitempty"`
+	Match         Matcher  `mapstructure:"match" json:"match,omitempty" yaml:"match,omitempty"`
+	Buckets       []Bucket `mapstructure:"buckets" json:"buckets,omitempty" yaml:"buckets,omitempty"`
+}
+
+// Bucket is a named group of containers counted by an evaluation.
+type Bucket struct {
+	Name    string `mapstructure:"name" json:"name" yaml:"name"`
+	Matcher `mapstructure:",squash" yaml:",inline"`
+}
+
+// Matcher selects containers by name and metadata. Every condition that is
+// set must hold; a Matcher with none matches every container. Regex uses Go
+// regular expression syntax and matches anywhere in the name unless anchored.
+// Metadata keys are compared in any case, and the value "*" matches any value
+// of the key.
+type Matcher struct {
+	Prefix   string            `mapstructure:"prefix" json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	Suffix   string            `mapstructure:"suffix" json:"suffix,omitempty" yaml:"suffix,omitempty"`
+	Regex    string            `mapstructure:"regex" json:"regex,omitempty" yaml:"regex,omitempty"`
+	Metadata map[string]string `mapstructure:"metadata" json:"metadata,omitempty" yaml:"metadata,omitempty"`
+}
+
+// Empty reports whether the matcher has no condition.
+func (m Matcher) Empty() bool {
+	return m.Prefix == "" && m.Suffix == "" && m.Regex == "" && len(m.Metadata) == 0
+}
+
+// EvaluationNames returns the names of the configured evaluations in sorted
+// order.
+func (c *Config) EvaluationNames() []string {
+	names := make([]string, 0, len(c.Evaluations))
+	for name := range c.Evaluations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validate appends the problems of a single evaluation found under key.
+func (e Evaluation) validate(v *validator, key string) {
+	if e.OlderThanDays < 0 {
+		v.add(key+".olderThanDays", "must not be negative")
+	}
+	e.Match.validate(v, key+".match")
+
+	seen := make(map[string]int)
+	for i, bucket := range e.Buckets {
+		bucketKey := fmt.Sprintf("%s.buckets[%d]", key, i)
+		switch first, ok := seen[bucket.Name]; {
+		case bucket.Name == "":
+			v.add(bucketKey+".name", "required")
+		case ok:
+			v.add(bucketKey+".name", fmt.Sprintf("%q is also the name of %s.buckets[%d]", bucket.Name, key, first))
+		default:
+			seen[bucket.Name] = i
+		}
+		if bucket.Matcher.Empty() {
+			v.add(bucketKey, "matches every container, set prefix, suffix, regex or metadata")
+		}
+		bucket.Matcher.validate(v, bucketKey)
+	}
+}
+
+// validate appends the problems of a matcher found under key.
+func (m Matcher) validate(v *validator, key string) {
+	if m.Regex != "" {
+		if _, err := regexp.Compile(m.Regex); err != nil {
+			v.add(key+".regex", err.Error())
+		}
+	}
+}
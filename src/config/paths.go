@@ -0,0 +1,102 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ConfigEnv is the environment variable naming the profiles file when
+// --config is not given.
+const ConfigEnv = "GOWITHAZURE_CONFIG"
+
+// fileNames are the names a profiles file is looked for under in each directory.
+var fileNames = []string{"profiles.yml", "profiles.yaml"}
+
+// Candidate is one place a profiles file is looked for.
+type Candidate struct {
+	Source string `json:"source"`
+	Path   string `json:"path"`
+}
+
+// SearchPath returns, in order, the places a profiles file is looked for:
+// the explicit path from --config, ConfigEnv, the XDG config directory, the
+// directory of the executable and the current directory. An explicit path or
+// ConfigEnv short-circuits the search, so only that candidate is returned.
+func SearchPath(explicit string) []Candidate {
+	if explicit != "" {
+		return []Candidate{{Source: "--config", Path: explicit}}
+	}
+	if env := os.Getenv(ConfigEnv); env != "" {
+		return []Candidate{{Source: "$" + ConfigEnv, Path: env}}
+	}
+
+	var dirs []Candidate
+	if dir := xdgConfigHome(); dir != "" {
+		dirs = append(dirs, Candidate{Source: "XDG config dir", Path: filepath.Join(dir, "gowithazure")})
+	}
+	if exe, err := os.Executable(); err == nil {
+		if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+			exe = resolved
+		}
+		dirs = append(dirs, Candidate{Source: "executable dir", Path: filepath.Dir(exe)})
+	}
+	if wd, err := os.Getwd(); err == nil {
+		dirs = append(dirs, Candidate{Source: "current dir", Path: wd})
+	}
+
+	var candidates []Candidate
+	for _, dir := range dirs {
+		for _, name := range fileNames {
+			candidates = append(candidates, Candidate{Source: dir.Source, Path: filepath.Join(dir.Path, name)})
+		}
+	}
+	return candidates
+}
+
+// Find returns the first candidate of SearchPath that exists, or "" when no
+// profiles file is found. A file named by --config or ConfigEnv must exist.
+func Find(explicit string) (string, error) {
+	candidates := SearchPath(explicit)
+	for _, candidate := range candidates {
+		info, err := os.Stat(candidate.Path)
+		if err == nil && !info.IsDir() {
+			return candidate.Path, nil
+		}
+		if candidate.Source == "--config" || candidate.Source == "$"+ConfigEnv {
+			if err == nil {
+				err = errors.New("is a directory")
+			}
+			return "", fmt.Errorf("config file from %s: %w", candidate.Source, err)
+		}
+	}
+	return "", nil
+}
+
+// xdgConfigHome returns $XDG_CONFIG_HOME, falling back to ~/.config as the
+// XDG base directory spec requires.
+func xdgConfigHome() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return dir
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config")
+	}
+	return ""
+}
+
+// DataDir is the directory the tool keeps its data in, such as the history
+// database: $XDG_DATA_HOME/gowithazure, falling back to ~/.local/share as the
+// XDG base directory spec requires.
+func DataDir() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "gowithazure"), nil
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secret values in dumps and error messages.
+const Redacted = "[REDACTED]"
+
+// SecretResolver looks up the value a secret reference points at. ref is the
+// part of the reference after "<scheme>:".
+type SecretResolver interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// SecretResolverFunc adapts an ordinary function to a SecretResolver.
+type SecretResolverFunc func(ctx context.Context, ref string) (string, error)
+
+// Resolve calls f(ctx, ref).
+func (f SecretResolverFunc) Resolve(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+// resolvers maps each reference scheme to its SecretResolver. The keyvault
+// scheme is registered by the command line tool, which owns the credential
+// used to reach the vault.
+var resolvers = map[string]SecretResolver{
+	"file": SecretResolverFunc(resolveFile),
+	"env":  SecretResolverFunc(resolveEnv),
+}
+
+// RegisterSecretResolver adds or replaces the SecretResolver for scheme.
+func RegisterSecretResolver(scheme string, resolver SecretResolver) {
+	resolvers[scheme] = resolver
+}
+
+// resolveFile reads a secret from a file such as /run/secrets/x, dropping the
+// trailing newline most tools write.
+func resolveFile(ctx context.Context, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolveEnv reads a secret from an environment variable.
+func resolveEnv(ctx context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// secretField is a config value that may hold a secret reference.
+type secretField struct {
+	key   string
+	value *string
+	// secret marks values that must never be printed. Identifiers such as
+	// tenantId may be references too but are not redacted.
+	secret bool
+}
+
+// secretFields returns the values of the profile name that may hold
+// references, located by key. Profiles are held by value, so the caller
+// stores profile back into the config once the fields are updated.
+func (p *Profile) secretFields(name string) []secretField {
+	var fields []secretField
+	key := "profiles." + name
+	for i := range p.Accounts {
+		account := &p.Accounts[i]
+		accountKey := fmt.Sprintf("%s.accounts[%d]", key, i)
+		fields = append(fields,
+			secretField{accountKey + ".accountKey", &account.AccountKey, true},
+			secretField{accountKey + ".sas", &account.SAS, true},
+			secretField{accountKey + ".connectionString", &account.ConnectionString, true},
+		)
+	}
+	return append(fields, p.Credentials.secretFields(key+".credentials")...)
+}
+
+// secretFields returns the values of a credentials section that may hold
+// references, including those of its chain.
+func (c *Credentials) secretFields(key string) []secretField {
+	fields := []secretField{
+		{key + ".tenantId", &c.TenantID, false},
+		{key + ".clientId", &c.ClientID, false},
+		{key + ".clientSecret", &c.ClientSecret, true},
+		{key + ".certificateFile", &c.CertificateFile, false},
+		{key + ".certificatePassword", &c.CertificatePassword, true},
+		{key + ".tokenFile", &c.TokenFile, false},
+	}
+	for i := range c.Chain {
+		fields = append(fields, c.Chain[i].secretFields(fmt.Sprintf("%s.chain[%d]", key, i))...)
+	}
+	return fields
+}
+
+// isReference reports whether value is a secret reference of a registered
+// scheme.
+func isReference(value string) bool {
+	scheme, _, ok := strings.Cut(value, ":")
+	_, registered := resolvers[scheme]
+	return ok && registered
+}
+
+// ResolveSecrets replaces the references of the named profiles, or of every
+// profile when none is named, with the values they point at and remembers
+// each secret value for Redact. Commands resolve the selected profile only,
+// so a vault they do not need cannot fail them; config validate resolves
+// them all. References that cannot be resolved are reported by Validate.
+func (c *Config) ResolveSecrets(ctx context.Context, names ...string) {
+	if len(names) == 0 {
+		names = c.ProfileNames()
+	}
+	for _, name := range names {
+		profile, ok := c.Profiles[name]
+		if !ok {
+			continue
+		}
+		profile.Accounts = append([]Account(nil), profile.Accounts...)
+		profile.Credentials = profile.Credentials.clone()
+		for _, field := range profile.secretFields(name) {
+			if isReference(*field.value) {
+				scheme, ref, _ := strings.Cut(*field.value, ":")
+				value, err := resolvers[scheme].Resolve(ctx, ref)
+				if err != nil {
+					c.unresolved = append(c.unresolved, Problem{
+						File:    c.File,
+						Key:     field.key,
+						Message: fmt.Sprintf("cannot resolve %s reference: %v", scheme, err),
+					})
+					continue
+				}
+				*field.value = value
+			}
+			if field.secret {
+				AddSecret(*field.value)
+			}
+		}
+		c.Profiles[name] = profile
+	}
+}
+
+// Redacted returns a copy of the config with every secret value replaced by
+// Redacted, safe to dump.
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redacted.Profiles = make(map[string]Profile, len(c.Profiles))
+	for name, profile := range c.Profiles {
+		profile.Accounts = append([]Account(nil), profile.Accounts...)
+		profile.Credentials = profile.Credentials.clone()
+		for _, field := range profile.secretFields(name) {
+			if field.secret && *field.value != "" && !isReference(*field.value) {
+				*field.value = Redacted
+			}
+		}
+		redacted.Profiles[name] = profile
+	}
+	return &redacted
+}
+
+// clone deep copies the chain so redacting the copy leaves c untouched.
+func (c Credentials) clone() Credentials {
+	chain := make([]Credentials, len(c.Chain))
+	for i, link := range c.Chain {
+		chain[i] = link.clone()
+	}
+	c.Chain = chain
+	return c
+}
+
+var (
+	secretsMu sync.RWMutex
+	// secrets are the values Redact removes, longest first.
+	secrets []string
+	// secretPatterns catch secrets that reach a message in a form we were
+	// never given, such as a SAS signature re-encoded into a request URL.
+	secretPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)(\bsig=)[^&"'\s]+`),
+		regexp.MustCompile(`(?i)(\bAccountKey=)[^;"'\s]+`),
+		regexp.MustCompile(`(?i)(\bSharedAccessSignature=)[^;"'\s]+`),
+	}
+)
+
+// AddSecret registers a value that Redact must remove from messages.
+func AddSecret(value string) {
+	if len(value) < 4 {
+		// Too short to redact without mangling unrelated text.
+		return
+	}
+
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	secrets = append(secrets, value)
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+}
+
+// Redact removes every known secret value, SAS signature and account key from
+// s. Use it on anything derived from an error before it is logged or printed.
+func Redact(s string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	for _, pattern := range secretPatterns {
+		s = pattern.ReplaceAllString(s, "${1}"+Redacted)
+	}
+	return s
+}
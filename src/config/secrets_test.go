@@ -0,0 +1,147 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "client-secret")
+	if err := os.WriteFile(secretFile, []byte("file-secret-value\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOWITHAZURE_TEST_SAS", "sv=2022&sig=env-sas-value")
+	t.Setenv("GOWITHAZURE_TEST_TENANT", "tenant-from-env")
+
+	cfg := load(t, `
+profiles:
+  dev:
+    accounts:
+      - url: https://devvideo.blob.core.windows.net/
+        sas: env:GOWITHAZURE_TEST_SAS
+      - url: https://devaudio.blob.core.windows.net/
+        accountKey: literal-account-key
+    credentials:
+      source: client-secret
+      tenantId: env:GOWITHAZURE_TEST_TENANT
+      clientId: app
+      clientSecret: file:`+secretFile+`
+  prod:
+    accounts:
+      - url: https://prodvideo.blob.core.windows.net/
+        sas: env:GOWITHAZURE_TEST_MISSING
+    credentials:
+      source: chained
+      chain:
+        - source: client-secret
+          tenantId: t
+          clientId: c
+          clientSecret: file:`+filepath.Join(dir, "missing")+`
+`)
+
+	// Only the selected profile is resolved; prod keeps its references.
+	cfg.ResolveSecrets(context.Background(), "dev")
+	dev, prod := cfg.Profiles["dev"], cfg.Profiles["prod"]
+	tests := []struct {
+		key, got, want string
+	}{
+		{"dev sas", dev.Accounts[0].SAS, "sv=2022&sig=env-sas-value"},
+		{"dev accountKey", dev.Accounts[1].AccountKey, "literal-account-key"},
+		{"dev tenantId", dev.Credentials.TenantID, "tenant-from-env"},
+		{"dev clientSecret", dev.Credentials.ClientSecret, "file-secret-value"},
+		{"prod sas", prod.Accounts[0].SAS, "env:GOWITHAZURE_TEST_MISSING"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s = %q, want %q", test.key, test.got, test.want)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate after resolving dev: %v", err)
+	}
+	// The resolved secrets are known to Redact; identifiers are not.
+	message := "client file-secret-value, key literal-account-key, tenant tenant-from-env"
+	if got, want := Redact(message), "client [REDACTED], key [REDACTED], tenant tenant-from-env"; got != want {
+		t.Errorf("Redact(%q) = %q, want %q", message, got, want)
+	}
+
+	// Resolving every profile reports the references that cannot be
+	// resolved, located by key.
+	cfg.ResolveSecrets(context.Background())
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate accepted unresolved references")
+	}
+	problems := err.(*ValidationError).Problems
+	want := map[string]string{
+		"profiles.prod.accounts[0].sas":                   "cannot resolve env reference: environment variable GOWITHAZURE_TEST_MISSING is not set",
+		"profiles.prod.credentials.chain[0].clientSecret": "cannot resolve file reference",
+	}
+	if len(problems) != len(want) {
+		t.Errorf("got problems %v, want %d", problems, len(want))
+	}
+	for _, problem := range problems {
+		if message, ok := want[problem.Key]; !ok || !strings.HasPrefix(problem.Message, message) || problem.File != cfg.File {
+			t.Errorf("unexpected problem %s", problem)
+		}
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := &Config{Profiles: map[string]Profile{
+		"dev": {
+			Accounts: []Account{
+				{URL: "https://devvideo.blob.core.windows.net/", AccountKey: "redacted-account-key"},
+				{URL: "https://devaudio.blob.core.windows.net/", SAS: "env:DEV_SAS"},
+			},
+			Credentials: Credentials{
+				Source:   "chained",
+				ClientID: "app",
+				Chain:    []Credentials{{Source: "client-secret", TenantID: "t", ClientID: "c", ClientSecret: "chain-secret"}},
+			},
+		},
+	}}
+
+	redacted := cfg.Redacted().Profiles["dev"]
+	if got := redacted.Accounts[0].AccountKey; got != Redacted {
+		t.Errorf("accountKey = %q, want it redacted", got)
+	}
+	if got := redacted.Accounts[1].SAS; got != "env:DEV_SAS" {
+		t.Errorf("sas = %q, want the reference, which is no secret", got)
+	}
+	if got := redacted.Credentials.Chain[0].ClientSecret; got != Redacted {
+		t.Errorf("chain clientSecret = %q, want it redacted", got)
+	}
+	if redacted.Credentials.ClientID != "app" || redacted.Accounts[0].URL != "https://devvideo.blob.core.windows.net/" {
+		t.Errorf("identifiers were redacted: %+v", redacted)
+	}
+	original := cfg.Profiles["dev"]
+	if original.Accounts[0].AccountKey != "redacted-account-key" || original.Credentials.Chain[0].ClientSecret != "chain-secret" {
+		t.Errorf("Redacted changed the config it copies: %+v", original)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	AddSecret("registered-secret-value")
+	AddSecret("abc")
+
+	tests := []struct {
+		in, want string
+	}{
+		{"failed with registered-secret-value in it", "failed with [REDACTED] in it"},
+		{"GET https://a.blob.core.windows.net/c?sv=2022&sig=c2lnbmF0dXJl%3D&se=1", "GET https://a.blob.core.windows.net/c?sv=2022&sig=[REDACTED]&se=1"},
+		{"DefaultEndpointsProtocol=https;AccountName=a;AccountKey=a2V5PQ==;EndpointSuffix=x", "DefaultEndpointsProtocol=https;AccountName=a;AccountKey=[REDACTED];EndpointSuffix=x"},
+		{"BlobEndpoint=https://a/;SharedAccessSignature=sv=1&sig=x", "BlobEndpoint=https://a/;SharedAccessSignature=[REDACTED]"},
+		// Values too short to redact safely are left alone.
+		{"abc and abcd", "abc and abcd"},
+	}
+	for _, test := range tests {
+		if got := Redact(test.in); got != test.want {
+			t.Errorf("Redact(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Problem is a single validation failure, located by file and key.
+type Problem struct {
+	File    string `json:"file"`
+	Key     string `json:"key"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.File, p.Key, p.Message)
+}
+
+// ValidationError carries every Problem found in a profiles file.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems)+1)
+	lines = append(lines, fmt.Sprintf("invalid configuration (%d problems):", len(e.Problems)))
+	for _, p := range e.Problems {
+		lines = append(lines, "  "+p.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// requiredCredentials lists, for each accepted credentials.source, the
+// fields that must be set.
+var requiredCredentials = map[string][]string{
+	"":                   nil,
+	"default":            nil,
+	"client-secret":      {"tenantId", "clientId", "clientSecret"},
+	"service-principal":  {"tenantId", "clientId", "clientSecret"},
+	"client-certificate": {"tenantId", "clientId", "certificateFile"},
+	"workload-identity":  nil,
+	"managed-identity":   nil,
+	"azure-cli":          nil,
+	"chained":            {"chain"},
+}
+
+// Validate checks the whole file rather than only the selected profile so a
+// mistake in one region is caught before it is needed. It returns a
+// *ValidationError listing every problem, or nil.
+func (c *Config) Validate() error {
+	v := validator{file: c.File}
+	if v.file == "" {
+		v.file = "profiles.yml"
+	}
+
+	for _, key := range c.unknown {
+		v.add(key, "unknown key")
+	}
+	v.problems = append(v.problems, c.unresolved...)
+
+	if c.Default != "" {
+		if _, ok := c.Profiles[c.Default]; !ok {
+			v.add("default", fmt.Sprintf("refers to unknown profile %q", c.Default))
+		}
+	}
+
+	for _, name := range c.ProfileNames() {
+		c.Profiles[name].validate(&v, "profiles."+name)
+	}
+	for _, name := range c.EvaluationNames() {
+		c.Evaluations[name].validate(&v, "evaluations."+name)
+	}
+
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+// validate appends the problems of a single profile found under key.
+func (p Profile) validate(v *validator, key string) {
+	if len(p.Accounts) == 0 {
+		v.add(key+".accounts", "at least one storage account is required")
+	}
+
+	seen := make(map[string]int)
+	for i, account := range p.Accounts {
+		accountKey := fmt.Sprintf("%s.accounts[%d]", key, i)
+		resolved, ok := account.validate(v, accountKey)
+		if !ok {
+			continue
+		}
+
+		normalized := normalizeAccountURL(resolved.URL)
+		if first, ok := seen[normalized]; ok {
+			v.add(accountKey, fmt.Sprintf("duplicate of %s.accounts[%d]", key, first))
+			continue
+		}
+		seen[normalized] = i
+	}
+
+	p.Credentials.validate(v, key+".credentials")
+
+	if p.Defaults.Output != "" && !slices.Contains(OutputFormats, p.Defaults.Output) {
+		v.add(key+".defaults.output", fmt.Sprintf("unsupported output format %q, expected one of %v", p.Defaults.Output, OutputFormats))
+	}
+	if p.Defaults.Concurrency < 0 {
+		v.add(key+".defaults.concurrency", "must not be negative")
+	}
+	if p.Defaults.Workers < 0 {
+		v.add(key+".defaults.workers", "must not be negative")
+	}
+}
+
+// RegisterCredentialSource makes source an accepted credentials.source and
+// lists the fields that must be set for it. See auth.Register.
+func RegisterCredentialSource(source string, required ...string) {
+	requiredCredentials[source] = required
+}
+
+// validate appends the problems of a credentials section found under key.
+func (c Credentials) validate(v *validator, key string) {
+	required, ok := requiredCredentials[c.Source]
+	if !ok {
+		sources := make([]string, 0, len(requiredCredentials))
+		for source := range requiredCredentials {
+			if source != "" {
+				sources = append(sources, source)
+			}
+		}
+		sort.Strings(sources)
+		v.add(key+".source", fmt.Sprintf("unknown source %q, expected one of %v", c.Source, sources))
+		return
+	}
+
+	set := map[string]bool{
+		"tenantId":        c.TenantID != "",
+		"clientId":        c.ClientID != "",
+		"clientSecret":    c.ClientSecret != "",
+		"certificateFile": c.CertificateFile != "",
+		"chain":           len(c.Chain) > 0,
+	}
+	for _, field := range required {
+		if !set[field] {
+			v.add(key+"."+field, fmt.Sprintf("required for %s credentials", c.Source))
+		}
+	}
+
+	if c.Source != "chained" && len(c.Chain) > 0 {
+		v.add(key+".chain", "only used by chained credentials")
+	}
+	for i, link := range c.Chain {
+		link.validate(v, fmt.Sprintf("%s.chain[%d]", key, i))
+	}
+}
+
+// validate appends the problems of a single account found under key and
+// returns it resolved, or false when it is unusable.
+func (a Account) validate(v *validator, key string) (Account, bool) {
+	secrets := 0
+	for _, set := range []bool{a.AccountKey != "", a.SAS != "", a.ConnectionString != ""} {
+		if set {
+			secrets++
+		}
+	}
+	if secrets > 1 {
+		v.add(key, "set only one of accountKey, sas and connectionString")
+		return a, false
+	}
+	if a.ConnectionString != "" && a.URL != "" {
+		v.add(key+".url", "not used with connectionString, the endpoint comes from the connection string")
+		return a, false
+	}
+	if a.ConnectionString == "" && a.URL == "" {
+		v.add(key+".url", "required")
+		return a, false
+	}
+	if isReference(a.ConnectionString) {
+		// Not resolved: only the selected profile is, and a failure to
+		// resolve is reported on its own.
+		return a, false
+	}
+
+	resolved, err := a.Resolve()
+	if err != nil {
+		field := ".connectionString"
+		if a.ConnectionString == "" {
+			field = ".accountName"
+		}
+		v.add(key+field, err.Error())
+		return a, false
+	}
+
+	// Bearer tokens are only sent over https, but the emulator is reached
+	// over http with a key or SAS.
+	allowHTTP := resolved.AccountKey != "" || resolved.SAS != ""
+	if err := ValidateAccountURL(resolved.URL, allowHTTP); err != nil {
+		field := ".url"
+		if a.ConnectionString != "" {
+			field = ".connectionString"
+		}
+		v.add(key+field, err.Error())
+		return a, false
+	}
+
+	return resolved, true
+}
+
+// ValidateAccountURL checks that account is a blob service endpoint such as
+// https://myaccount.blob.core.windows.net/, or an emulator endpoint such as
+// http://127.0.0.1:10000/devstoreaccount1. http is only accepted for local
+// emulator hosts and only when allowHTTP is set.
+func ValidateAccountURL(account string, allowHTTP bool) error {
+	u, err := url.Parse(account)
+	if err != nil {
+		return fmt.Errorf("not a valid URL: %v", err)
+	}
+
+	if isEmulatorHost(u.Hostname()) {
+		if u.Scheme != "https" && !(u.Scheme == "http" && allowHTTP) {
+			return fmt.Errorf("%q must use https, or http with an account key or SAS", account)
+		}
+		if accountNameFromURL(account) == "" {
+			return fmt.Errorf("%q is not an emulator endpoint, expected http://127.0.0.1:10000/<account>", account)
+		}
+		return nil
+	}
+
+	if u.Scheme != "https" {
+		return fmt.Errorf("%q must use https", account)
+	}
+
+	labels := strings.Split(u.Hostname(), ".")
+	if len(labels) < 3 || labels[0] == "" || labels[1] != "blob" {
+		return fmt.Errorf("%q is not a blob endpoint, expected https://<account>.blob.<endpoint suffix>/", account)
+	}
+	if strings.Trim(u.Path, "/") != "" {
+		return fmt.Errorf("%q must be the account endpoint without a container path", account)
+	}
+
+	return nil
+}
+
+// normalizeAccountURL reduces an account URL to its lower case host and path
+// so the same account written two ways is detected as a duplicate.
+func normalizeAccountURL(account string) string {
+	u, _ := url.Parse(account)
+	return strings.ToLower(u.Host + "/" + strings.Trim(u.Path, "/"))
+}
+
+// validator accumulates problems for a single file.
+type validator struct {
+	file     string
+	problems []Problem
+}
+
+func (v *validator) add(key, message string) {
+	v.problems = append(v.problems, Problem{File: v.file, Key: key, Message: message})
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// load writes a profiles file holding content and loads it.
+func load(t *testing.T, content string) *Config {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "profiles.yml")
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(file)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		// problems are the keys of the expected problems and a part of
+		// their message, in order.
+		problems [][2]string
+	}{
+		{
+			name: "valid",
+			content: `
+default: dev
+profiles:
+  dev:
+    accounts:
+      - url: http://127.0.0.1:10000/devstoreaccount1
+        accountKey: a2V5
+      - https://usvideo.blob.core.windows.net/
+      - url: https://usprodvideo.blob.core.windows.net/
+        sas: sv=2022&sig=abc
+    credentials:
+      source: client-secret
+      tenantId: t
+      clientId: c
+      clientSecret: s
+evaluations:
+  scratch:
+    olderThanDays: 3
+    match: {prefix: scratch-}
+`,
+		},
+		{
+			name: "every problem",
+			content: `
+default: prod
+profiles:
+  dev:
+    accounts: []
+    credentials: {source: client-secret, tenantId: t}
+    defaults: {output: xml, concurrency: -1, workers: -2}
+    region: eastus
+    colour: blue
+  eu-prod:
+    accounts:
+      - https://euvideo.blob.core.windows.net/
+      - https://EUVIDEO.blob.core.windows.net
+      - url: https://euvideo.blob.core.windows.net/video
+      - url: https://other.blob.core.windows.net/
+        accountKey: a2V5
+        sas: sv=1
+      - http://euvideo2.blob.core.windows.net/
+      - {}
+    credentials:
+      source: chained
+      chain:
+        - source: magic
+        - source: client-certificate
+evaluations:
+  broken:
+    olderThanDays: -1
+    match: {regex: "("}
+    buckets:
+      - name: a
+        suffix: -a
+      - name: a
+      - suffix: -c
+`,
+			problems: [][2]string{
+				{"profiles.dev.colour", "unknown key"},
+				{"default", `unknown profile "prod"`},
+				{"profiles.dev.accounts", "at least one storage account"},
+				{"profiles.dev.credentials.clientId", "required for client-secret"},
+				{"profiles.dev.credentials.clientSecret", "required for client-secret"},
+				{"profiles.dev.defaults.output", `unsupported output format "xml"`},
+				{"profiles.dev.defaults.concurrency", "must not be negative"},
+				{"profiles.dev.defaults.workers", "must not be negative"},
+				{"profiles.eu-prod.accounts[1]", "duplicate of profiles.eu-prod.accounts[0]"},
+				{"profiles.eu-prod.accounts[2].url", "without a container path"},
+				{"profiles.eu-prod.accounts[3]", "set only one of accountKey, sas and connectionString"},
+				{"profiles.eu-prod.accounts[4].url", "must use https"},
+				{"profiles.eu-prod.accounts[5].url", "required"},
+				{"profiles.eu-prod.credentials.chain[0].source", `unknown source "magic"`},
+				{"profiles.eu-prod.credentials.chain[1].tenantId", "required for client-certificate"},
+				{"profiles.eu-prod.credentials.chain[1].clientId", "required for client-certificate"},
+				{"profiles.eu-prod.credentials.chain[1].certificateFile", "required for client-certificate"},
+				{"evaluations.broken.olderThanDays", "must not be negative"},
+				{"evaluations.broken.match.regex", "missing closing )"},
+				{"evaluations.broken.buckets[1].name", `"a" is also the name of evaluations.broken.buckets[0]`},
+				{"evaluations.broken.buckets[1]", "matches every container"},
+				{"evaluations.broken.buckets[2].name", "required"},
+			},
+		},
+		{
+			name: "connection strings",
+			content: `
+profiles:
+  dev:
+    accounts:
+      - connectionString: UseDevelopmentStorage=true
+      - connectionString: DefaultEndpointsProtocol=https;AccountName=video;AccountKey=a2V5;EndpointSuffix=core.windows.net
+        url: https://video.blob.core.windows.net/
+      - connectionString: AccountKey=a2V5
+`,
+			problems: [][2]string{
+				{"profiles.dev.accounts[1].url", "not used with connectionString"},
+				{"profiles.dev.accounts[2].connectionString", ""},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := load(t, test.content)
+			err := cfg.Validate()
+			if test.problems == nil {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("Validate returned %v, want a *ValidationError", err)
+			}
+			for i, problem := range invalid.Problems {
+				if problem.File != cfg.File {
+					t.Errorf("problem %s is located in %q, want %q", problem.Key, problem.File, cfg.File)
+				}
+				if i >= len(test.problems) {
+					t.Errorf("unexpected problem %s", problem)
+					continue
+				}
+				want := test.problems[i]
+				if problem.Key != want[0] || !strings.Contains(problem.Message, want[1]) {
+					t.Errorf("problem %d is %s, want %s: ...%s...", i, problem, want[0], want[1])
+				}
+			}
+			if len(invalid.Problems) < len(test.problems) {
+				t.Errorf("got %d problems, want %d:\n%v", len(invalid.Problems), len(test.problems), err)
+			}
+			if !strings.HasPrefix(err.Error(), "invalid configuration (") {
+				t.Errorf("error %q does not introduce the problems", err)
+			}
+		})
+	}
+}
+
+func TestValidateAccountURL(t *testing.T) {
+	tests := []struct {
+		url       string
+		allowHTTP bool
+		err       string
+	}{
+		{url: "https://video.blob.core.windows.net/"},
+		{url: "https://video.blob.core.chinacloudapi.cn"},
+		{url: "http://127.0.0.1:10000/devstoreaccount1", allowHTTP: true},
+		{url: "http://127.0.0.1:10000/devstoreaccount1", err: "must use https, or http with an account key or SAS"},
+		{url: "http://localhost:10000/", allowHTTP: true, err: "is not an emulator endpoint"},
+		{url: "https://video.file.core.windows.net/", err: "is not a blob endpoint"},
+		{url: "https://video.blob.core.windows.net/c", err: "without a container path"},
+		{url: "http://video.blob.core.windows.net/", allowHTTP: true, err: "must use https"},
+		{url: "https://video.blob.core.windows.net/%zz", err: "not a valid URL"},
+	}
+	for _, test := range tests {
+		err := ValidateAccountURL(test.url, test.allowHTTP)
+		if (test.err == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("ValidateAccountURL(%q, %t) = %v, want %q", test.url, test.allowHTTP, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package cost
+
+import (
+	"sort"
+
+	"gowithazure/src/storage"
+)
+
+// gb is the unit storage is priced in.
+const gb = 1 << 30
+
+// TierCost is the monthly storage cost of the blobs in one tier.
+type TierCost struct {
+	Tier    string  `json:"tier"`
+	Bytes   int64   `json:"bytes"`
+	Monthly float64 `json:"monthly"`
+}
+
+// Projection is what moving the idle hot blobs to a cooler tier would do.
+type Projection struct {
+	Tier  string `json:"tier"`
+	Blobs int64  `json:"blobs"`
+	Bytes int64  `json:"bytes"`
+	// MonthlySaving is what storing the blobs in Tier instead of Hot saves
+	// every month.
+	MonthlySaving float64 `json:"monthlySaving"`
+	// TransitionCost is the one-off price of the tier changes.
+	TransitionCost float64 `json:"transitionCost"`
+	// MinimumCharge is the storage billed for the minimum days of Tier, owed
+	// even when the blobs are deleted or moved again sooner.
+	MinimumCharge float64 `json:"minimumCharge"`
+	// RetrievalCost is the price of reading every blob back once.
+	RetrievalCost float64 `json:"retrievalCost"`
+	// BreakEvenMonths is how long the blobs must stay in Tier for the saving
+	// to pay for the transition; 0 when there is nothing to save.
+	BreakEvenMonths float64 `json:"breakEvenMonths"`
+}
+
+// ContainerCost is the monthly cost of one container and the projections of
+// moving its idle hot blobs.
+type ContainerCost struct {
+	Name        string       `json:"name"`
+	Bytes       int64        `json:"bytes"`
+	Monthly     float64      `json:"monthly"`
+	IdleHot     storage.Size `json:"idleHot"`
+	Projections []Projection `json:"projections"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// AccountCost is the monthly cost of one storage account. Blobs without a
+// priced tier, such as page blobs, are left out of Monthly and counted in
+// UnpricedBytes.
+type AccountCost struct {
+	URL           string          `json:"url"`
+	Region        string          `json:"region,omitempty"`
+	Currency      string          `json:"currency"`
+	Bytes         int64           `json:"bytes"`
+	Monthly       float64         `json:"monthly"`
+	ByTier        []TierCost      `json:"byTier"`
+	UnpricedBytes int64           `json:"unpricedBytes"`
+	IdleHot       storage.Size    `json:"idleHot"`
+	Projections   []Projection    `json:"projections"`
+	Containers    []ContainerCost `json:"containers"`
+	Error         string          `json:"error,omitempty"`
+}
+
+// Estimate prices the capacity of every account with the prices of one
+// region. Containers are ordered from the most expensive down, only the
+// first top of them when top is not 0.
+func Estimate(capacities []storage.AccountCapacity, prices RegionPrices, region, currency string, top int) []AccountCost {
+	results := make([]AccountCost, len(capacities))
+	for i, capacity := range capacities {
+		result := AccountCost{
+			URL:         capacity.URL,
+			Region:      region,
+			Currency:    currency,
+			Bytes:       capacity.Bytes,
+			IdleHot:     capacity.IdleHot,
+			Projections: prices.project(capacity.IdleHot),
+			Error:       capacity.Error,
+		}
+		for _, size := range capacity.ByTier {
+			monthly, ok := prices.monthly(size)
+			if !ok {
+				result.UnpricedBytes += size.Bytes
+				continue
+			}
+			result.ByTier = append(result.ByTier, TierCost{Tier: size.Key, Bytes: size.Bytes, Monthly: monthly})
+			result.Monthly += monthly
+		}
+
+		for _, container := range capacity.Containers {
+			cost := ContainerCost{
+				Name:        container.Name,
+				Bytes:       container.Bytes,
+				IdleHot:     container.IdleHot,
+				Projections: prices.project(container.IdleHot),
+				Error:       container.Error,
+			}
+			for _, size := range container.ByTier {
+				monthly, _ := prices.monthly(size)
+				cost.Monthly += monthly
+			}
+			result.Containers = append(result.Containers, cost)
+		}
+		sort.SliceStable(result.Containers, func(a, b int) bool {
+			return result.Containers[a].Monthly > result.Containers[b].Monthly
+		})
+		if top > 0 && len(result.Containers) > top {
+			result.Containers = result.Containers[:top]
+		}
+		results[i] = result
+	}
+	return results
+}
+
+// monthly returns the storage cost of a tier's blobs for a month, or false
+// when the tier has no price.
+func (p RegionPrices) monthly(size storage.Size) (float64, bool) {
+	price, ok := lookup(p.Storage, size.Key)
+	if !ok {
+		return 0, false
+	}
+	return float64(size.Bytes) / gb * price, true
+}
+
+// project returns the projections of moving hot blobs to each cooler tier.
+func (p RegionPrices) project(hot storage.Size) []Projection {
+	hotPrice, _ := lookup(p.Storage, "Hot")
+	gigabytes := float64(hot.Bytes) / gb
+	operations := float64(hot.Blobs) / 10000
+
+	var projections []Projection
+	for _, tier := range Tiers[1:] {
+		price, _ := lookup(p.Storage, tier)
+		write, _ := lookup(p.WriteOperations, tier)
+		read, _ := lookup(p.ReadOperations, tier)
+		retrieval, _ := lookup(p.Retrieval, tier)
+		days, _ := lookup(p.MinimumDays, tier)
+
+		projection := Projection{
+			Tier:           tier,
+			Blobs:          hot.Blobs,
+			Bytes:          hot.Bytes,
+			MonthlySaving:  gigabytes * (hotPrice - price),
+			TransitionCost: operations * write,
+			MinimumCharge:  gigabytes * price * float64(days) / 30,
+			RetrievalCost:  gigabytes*retrieval + operations*read,
+		}
+		if projection.MonthlySaving > 0 {
+			projection.BreakEvenMonths = projection.TransitionCost / projection.MonthlySaving
+		}
+		projections = append(projections, projection)
+	}
+	return projections
+}
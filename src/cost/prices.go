@@ -0,0 +1,150 @@
+// Package cost estimates what the storage accounts cost per month from their
+// capacity and a local price sheet, and what moving idle hot blobs to a
+// cooler access tier would save. Prices are read from a YAML file rather than
+// the Azure retail prices API, so estimates can be made offline and with
+// negotiated prices.
+package cost
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Tiers are the access tiers a price sheet prices, from the hottest down.
+var Tiers = []string{"Hot", "Cool", "Cold", "Archive"}
+
+// PriceSheet holds the prices of blob storage per region:
+//
+//	currency: USD
+//	regions:
+//	  eastus:
+//	    storage:         {hot: 0.0184, cool: 0.01, cold: 0.0036, archive: 0.00099}
+//	    writeOperations: {hot: 0.05, cool: 0.10, cold: 0.18, archive: 0.10}
+//	    readOperations:  {hot: 0.004, cool: 0.01, cold: 0.10, archive: 5.00}
+//	    retrieval:       {cool: 0.01, cold: 0.03, archive: 0.02}
+//	    minimumDays:     {cool: 30, cold: 90, archive: 180}
+type PriceSheet struct {
+	Currency string                  `yaml:"currency"`
+	Regions  map[string]RegionPrices `yaml:"regions"`
+}
+
+// RegionPrices are the prices of one region, each keyed by access tier.
+type RegionPrices struct {
+	// Storage is the price of storing one GB for a month.
+	Storage map[string]float64 `yaml:"storage"`
+	// WriteOperations and ReadOperations are the prices of 10,000 operations.
+	// Moving a blob to a cooler tier is billed as a write in that tier.
+	WriteOperations map[string]float64 `yaml:"writeOperations"`
+	ReadOperations  map[string]float64 `yaml:"readOperations"`
+	// Retrieval is the price of reading one GB from the tier.
+	Retrieval map[string]float64 `yaml:"retrieval"`
+	// MinimumDays is how long a blob is billed for in the tier at least: a
+	// blob deleted or moved earlier is charged early deletion for the rest.
+	MinimumDays map[string]int `yaml:"minimumDays"`
+}
+
+// LoadPrices reads and checks the price sheet at path.
+func LoadPrices(path string) (*PriceSheet, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no price sheet at %s, copy prices.example.yml there or pass --prices", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sheet PriceSheet
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&sheet); err != nil {
+		return nil, fmt.Errorf("reading price sheet %s: %w", path, err)
+	}
+	if err := sheet.validate(); err != nil {
+		return nil, fmt.Errorf("price sheet %s: %w", path, err)
+	}
+	return &sheet, nil
+}
+
+// validate checks that every region prices storage in every tier and that
+// no price is negative.
+func (s *PriceSheet) validate() error {
+	if len(s.Regions) == 0 {
+		return errors.New("no regions")
+	}
+	var problems []string
+	for _, name := range s.RegionNames() {
+		region := s.Regions[name]
+		for _, tier := range Tiers {
+			if _, ok := lookup(region.Storage, tier); !ok {
+				problems = append(problems, fmt.Sprintf("regions.%s.storage has no price for %s", name, tier))
+			}
+		}
+		for field, prices := range map[string]map[string]float64{
+			"storage":         region.Storage,
+			"writeOperations": region.WriteOperations,
+			"readOperations":  region.ReadOperations,
+			"retrieval":       region.Retrieval,
+		} {
+			for tier, price := range prices {
+				if price < 0 {
+					problems = append(problems, fmt.Sprintf("regions.%s.%s.%s is negative", name, field, tier))
+				}
+			}
+		}
+		for tier, days := range region.MinimumDays {
+			if days < 0 {
+				problems = append(problems, fmt.Sprintf("regions.%s.minimumDays.%s is negative", name, tier))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// RegionNames returns the regions of the sheet in order.
+func (s *PriceSheet) RegionNames() []string {
+	names := make([]string, 0, len(s.Regions))
+	for name := range s.Regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Region returns the name and prices of a region. A sheet with a single
+// region prices every account when no region is given.
+func (s *PriceSheet) Region(name string) (string, RegionPrices, error) {
+	if name == "" {
+		if len(s.Regions) == 1 {
+			name = s.RegionNames()[0]
+			return name, s.Regions[name], nil
+		}
+		return "", RegionPrices{}, fmt.Errorf("no region set, set region in the profile or pass --region, one of %v", s.RegionNames())
+	}
+	for key, region := range s.Regions {
+		if strings.EqualFold(key, name) {
+			return key, region, nil
+		}
+	}
+	return "", RegionPrices{}, fmt.Errorf("the price sheet has no region %q, expected one of %v", name, s.RegionNames())
+}
+
+// lookup returns the price of a tier, matching the tier name in any case.
+func lookup[T any](prices map[string]T, tier string) (T, bool) {
+	for key, price := range prices {
+		if strings.EqualFold(key, tier) {
+			return price, true
+		}
+	}
+	var zero T
+	return zero, false
+}
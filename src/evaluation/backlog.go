@@ -0,0 +1,149 @@
+package evaluation
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gowithazure/src/config"
+	"gowithazure/src/scanner"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+)
+
+// StaleContainer is one container of the video backlog: an -in or -out
+// container left unmodified for too long.
+type StaleContainer struct {
+	Account      string    `json:"account"`
+	Name         string    `json:"name"`
+	Direction    string    `json:"direction"`
+	LastModified time.Time `json:"lastModified"`
+	AgeDays      int       `json:"ageDays"`
+	Blobs        int64     `json:"blobs"`
+	Bytes        int64     `json:"bytes"`
+	// Counterpart is the name of the matching -out container of an -in
+	// container and the other way round. An input without its output, or an
+	// output without its input, is orphaned. CounterpartUnknown is set when
+	// the counterpart was not seen but the account could not be listed
+	// completely, so it may exist.
+	Counterpart        string `json:"counterpart"`
+	CounterpartExists  bool   `json:"counterpartExists"`
+	CounterpartUnknown bool   `json:"counterpartUnknown,omitempty"`
+	// Error says why the blobs could not all be counted, or why the
+	// counterpart is unknown.
+	Error string `json:"error,omitempty"`
+}
+
+// Orphaned reports whether the counterpart of the container is known not to
+// exist.
+func (c StaleContainer) Orphaned() bool {
+	return !c.CounterpartExists && !c.CounterpartUnknown
+}
+
+// Counterpart returns the name of the -out container matching an -in
+// container and the other way round, or "" for any other name.
+func Counterpart(name string) string {
+	switch Direction(name) {
+	case "in":
+		return strings.TrimSuffix(name, "-in") + "-out"
+	case "out":
+		return strings.TrimSuffix(name, "-out") + "-in"
+	}
+	return ""
+}
+
+// Backlog lists the -in and -out containers of every storage account not
+// modified for longer than olderThan, with the number and size of their blobs
+// and whether their counterpart exists, at any age. Containers are in the
+// order of accounts, then by name. A container whose blobs could not all be
+// listed is reported with an error, and so is one whose counterpart was not
+// seen in an account whose containers could not all be listed; the scan
+// error is returned along with the containers that were found.
+func Backlog(ctx context.Context, scan *scanner.Scanner, accounts []config.Account, olderThan time.Duration) ([]StaleContainer, error) {
+	type key struct {
+		account   int
+		container string
+	}
+	var (
+		mu    sync.Mutex
+		stale = make(map[key]*StaleContainer)
+		names = make([]map[string]bool, len(accounts))
+	)
+	for i := range names {
+		names[i] = make(map[string]bool)
+	}
+
+	now := time.Now()
+	err := scan.Scan(ctx, accounts, scanner.Callbacks{
+		Container: func(_ context.Context, account *scanner.Account, item *service.ContainerItem) error {
+			mu.Lock()
+			defer mu.Unlock()
+			names[account.Index][*item.Name] = true
+
+			direction := Direction(*item.Name)
+			if direction == "" || item.Properties == nil || item.Properties.LastModified == nil {
+				return scanner.SkipContainer
+			}
+			lastModified := *item.Properties.LastModified
+			if now.Sub(lastModified) <= olderThan {
+				return scanner.SkipContainer
+			}
+			stale[key{account.Index, *item.Name}] = &StaleContainer{
+				Account:      account.URL,
+				Name:         *item.Name,
+				Direction:    direction,
+				LastModified: lastModified,
+				AgeDays:      int(now.Sub(lastModified) / (24 * time.Hour)),
+				Counterpart:  Counterpart(*item.Name),
+			}
+			return nil
+		},
+		Blob: func(_ context.Context, account *scanner.Account, containerName string, item *container.BlobItem) error {
+			mu.Lock()
+			defer mu.Unlock()
+			c := stale[key{account.Index, containerName}]
+			c.Blobs++
+			if item.Properties != nil && item.Properties.ContentLength != nil {
+				c.Bytes += *item.Properties.ContentLength
+			}
+			return nil
+		},
+		ContainerDone: func(account *scanner.Account, containerName string, err error) {
+			if err == nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if c := stale[key{account.Index, containerName}]; c != nil {
+				c.Error = config.Redact(err.Error())
+			}
+		},
+	})
+
+	keys := make([]key, 0, len(stale))
+	for k := range stale {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].account != keys[j].account {
+			return keys[i].account < keys[j].account
+		}
+		return keys[i].container < keys[j].container
+	})
+	backlog := make([]StaleContainer, len(keys))
+	for i, k := range keys {
+		c := stale[k]
+		c.CounterpartExists = names[k.account][c.Counterpart]
+		if !c.CounterpartExists && scanner.Incomplete(err, k.account) {
+			c.CounterpartUnknown = true
+			if c.Error == "" {
+				c.Error = "the account could not be listed completely, " + c.Counterpart + " may exist"
+			}
+		}
+		backlog[i] = *c
+	}
+	return backlog, err
+}
@@ -0,0 +1,98 @@
+package evaluation
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"gowithazure/src/config"
+)
+
+func TestBacklog(t *testing.T) {
+	now := time.Now().UTC()
+	old, recent := now.AddDate(0, 0, -30), now.AddDate(0, 0, -1)
+	containers := []fakeContainer{
+		{name: "job1-in", lastModified: old, blobs: 2},
+		{name: "job3-in", lastModified: old},
+		{name: "job1-out", lastModified: recent},
+		{name: "job4-out", lastModified: old, blobs: 1},
+		{name: "scratch", lastModified: old},
+	}
+
+	tests := []struct {
+		name string
+		fake *fakeAccount
+		// want maps the stale containers to their expectations.
+		want    map[string]StaleContainer
+		scanErr bool
+	}{
+		{
+			// The blobs of job4-out cannot be listed, which leaves the
+			// containers, and so the counterparts, known.
+			name: "failed blob listing",
+			fake: &fakeAccount{containers: containers, denied: map[string]bool{"job4-out": true}},
+			want: map[string]StaleContainer{
+				"job1-in":  {Direction: "in", Counterpart: "job1-out", CounterpartExists: true, Blobs: 2, Bytes: 200},
+				"job3-in":  {Direction: "in", Counterpart: "job3-out"},
+				"job4-out": {Direction: "out", Counterpart: "job4-in", Error: "AuthorizationPermissionMismatch"},
+			},
+			scanErr: true,
+		},
+		{
+			// The second page is refused: job1-out exists but is not seen,
+			// so neither job1-in nor job3-in can be called orphaned.
+			name: "failed listing",
+			fake: &fakeAccount{containers: containers, pageSize: 2, failPage: "2"},
+			want: map[string]StaleContainer{
+				"job1-in": {Direction: "in", Counterpart: "job1-out", CounterpartUnknown: true, Blobs: 2, Bytes: 200, Error: "job1-out may exist"},
+				"job3-in": {Direction: "in", Counterpart: "job3-out", CounterpartUnknown: true, Error: "job3-out may exist"},
+			},
+			scanErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			account, scan := serve(t, test.fake)
+			backlog, err := Backlog(context.Background(), scan, []config.Account{account}, StaleAfter)
+			if (err != nil) != test.scanErr {
+				t.Errorf("Backlog error %v, want one: %t", err, test.scanErr)
+			}
+			if len(backlog) != len(test.want) {
+				t.Errorf("got %d stale containers, want %d: %+v", len(backlog), len(test.want), backlog)
+			}
+			for i, got := range backlog {
+				if i > 0 && backlog[i-1].Name >= got.Name {
+					t.Errorf("%s listed after %s, want them by name", got.Name, backlog[i-1].Name)
+				}
+				want, ok := test.want[got.Name]
+				if !ok {
+					t.Errorf("unexpected stale container %s", got.Name)
+					continue
+				}
+				if got.Direction != want.Direction || got.Counterpart != want.Counterpart || got.CounterpartExists != want.CounterpartExists ||
+					got.CounterpartUnknown != want.CounterpartUnknown || got.Blobs != want.Blobs || got.Bytes != want.Bytes ||
+					!strings.Contains(got.Error, want.Error) || (want.Error == "") != (got.Error == "") {
+					t.Errorf("%s: got %+v, want %+v", got.Name, got, want)
+				}
+				if got.AgeDays != 30 || got.Account != account.String() {
+					t.Errorf("%s: age %d days in %s, want 30 days in %s", got.Name, got.AgeDays, got.Account, account)
+				}
+				// Only containers whose counterpart is known to be missing
+				// make it into --orphans.
+				if orphaned := !want.CounterpartExists && !want.CounterpartUnknown; got.Orphaned() != orphaned {
+					t.Errorf("%s: Orphaned() = %t, want %t", got.Name, got.Orphaned(), orphaned)
+				}
+			}
+		})
+	}
+}
+
+func TestCounterpart(t *testing.T) {
+	tests := map[string]string{"job1-in": "job1-out", "job1-out": "job1-in", "in-out-in": "in-out-out", "scratch": "", "-in": "-out"}
+	for name, want := range tests {
+		if got := Counterpart(name); got != want {
+			t.Errorf("Counterpart(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Package evaluation counts the containers of the storage accounts that
+// match an evaluation defined in the profiles file: name patterns, metadata
+// and an age threshold select the containers, and named buckets break them
+// down. The built-in video evaluation counts the containers not modified in
+// the last 7 days, and the -in and -out ones among them in its buckets.
+// Containers are listed 5000 at a time, one page per request, so accounts
+// with many containers take a while to evaluate.
+package evaluation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gowithazure/src/config"
+	"gowithazure/src/scanner"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+)
+
+// Result holds the counts of one evaluation in one storage account.
+type Result struct {
+	Url        string `json:"url"`
+	Evaluation string `json:"evaluation"`
+	// Total is the number of containers selected by the evaluation, and
+	// InAnyBucket those of them that fall in at least one bucket.
+	Total       int           `json:"total"`
+	Buckets     []BucketCount `json:"buckets"`
+	InAnyBucket int           `json:"inAnyBucket"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// BucketCount is the number of containers in one bucket.
+type BucketCount struct {
+	Name       string `json:"name"`
+	Containers int    `json:"containers"`
+}
+
+// Results are the results of an evaluation, one per storage account. Laid out
+// as a table or CSV, each bucket gets a column of its own.
+type Results []Result
+
+// Header implements report.Table.
+func (r Results) Header() []string {
+	header := []string{"url", "evaluation", "total"}
+	if len(r) > 0 {
+		for _, bucket := range r[0].Buckets {
+			header = append(header, bucket.Name)
+		}
+	}
+	return append(header, "inAnyBucket", "error")
+}
+
+// Rows implements report.Table.
+func (r Results) Rows() [][]string {
+	rows := make([][]string, len(r))
+	for i, result := range r {
+		row := []string{result.Url, result.Evaluation, strconv.Itoa(result.Total)}
+		for _, bucket := range result.Buckets {
+			row = append(row, strconv.Itoa(bucket.Containers))
+		}
+		rows[i] = append(row, strconv.Itoa(result.InAnyBucket), result.Error)
+	}
+	return rows
+}
+
+// Evaluator is an evaluation ready to be applied to containers.
+type Evaluator struct {
+	Name       string
+	Evaluation config.Evaluation
+	match      matcher
+	buckets    []matcher
+}
+
+// New compiles the evaluation called name.
+func New(name string, evaluation config.Evaluation) (*Evaluator, error) {
+	e := &Evaluator{Name: name, Evaluation: evaluation}
+	var err error
+	if e.match, err = compile(evaluation.Match); err != nil {
+		return nil, fmt.Errorf("evaluation %s: %w", name, err)
+	}
+	for _, bucket := range evaluation.Buckets {
+		m, err := compile(bucket.Matcher)
+		if err != nil {
+			return nil, fmt.Errorf("evaluation %s, bucket %s: %w", name, bucket.Name, err)
+		}
+		e.buckets = append(e.buckets, m)
+	}
+	return e, nil
+}
+
+// Lookup returns the evaluation called name among those configured, falling
+// back to the built-in video evaluation.
+func Lookup(configured map[string]config.Evaluation, name string) (*Evaluator, error) {
+	evaluation, ok := configured[name]
+	if !ok {
+		if name != VideoName {
+			names := []string{VideoName}
+			for configuredName := range configured {
+				if configuredName != VideoName {
+					names = append(names, configuredName)
+				}
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown evaluation %q, expected one of %v", name, names)
+		}
+		evaluation = Video
+	}
+	return New(name, evaluation)
+}
+
+// Describe says in words which containers the evaluation selects.
+func (e *Evaluator) Describe() string {
+	description := "containers"
+	if !e.Evaluation.Match.Empty() {
+		description += " " + describe(e.Evaluation.Match)
+	}
+	if e.Evaluation.OlderThanDays > 0 {
+		description += fmt.Sprintf(" not modified for %d days", e.Evaluation.OlderThanDays)
+	}
+	return description
+}
+
+// DescribeBucket says in words which containers fall in the i-th bucket.
+func (e *Evaluator) DescribeBucket(i int) string {
+	return describe(e.Evaluation.Buckets[i].Matcher)
+}
+
+// Evaluate applies the evaluation to the containers of every storage
+// account. Results are in the order of accounts.
+func (e *Evaluator) Evaluate(ctx context.Context, scan *scanner.Scanner, accounts []config.Account) (Results, error) {
+	results := make(Results, len(accounts))
+	for i, account := range accounts {
+		results[i] = Result{Url: account.String(), Evaluation: e.Name, Buckets: make([]BucketCount, len(e.buckets))}
+		for j, bucket := range e.Evaluation.Buckets {
+			results[i].Buckets[j].Name = bucket.Name
+		}
+	}
+
+	// Containers of one account are visited in sequence, and each account
+	// only touches its own result.
+	now := time.Now()
+	err := scan.Scan(ctx, accounts, scanner.Callbacks{
+		Container: func(_ context.Context, account *scanner.Account, container *service.ContainerItem) error {
+			if !e.selects(container, now) {
+				return nil
+			}
+
+			result := &results[account.Index]
+			result.Total++
+			inAny := false
+			for j, bucket := range e.buckets {
+				if bucket.matches(container) {
+					result.Buckets[j].Containers++
+					inAny = true
+				}
+			}
+			if inAny {
+				result.InAnyBucket++
+			}
+			return nil
+		},
+	})
+
+	for i := range results {
+		results[i].Error = scanner.Message(err, i)
+	}
+
+	return results, err
+}
+
+// selects reports whether the evaluation counts the container at now.
+func (e *Evaluator) selects(container *service.ContainerItem, now time.Time) bool {
+	if e.Evaluation.OlderThanDays > 0 {
+		// Containers listed without a last modified time have no age.
+		if container.Properties == nil || container.Properties.LastModified == nil ||
+			now.Sub(*container.Properties.LastModified) <= time.Duration(e.Evaluation.OlderThanDays)*24*time.Hour {
+			return false
+		}
+	}
+	return e.match.matches(container)
+}
+
+// matcher is a compiled config.Matcher.
+type matcher struct {
+	config.Matcher
+	regex *regexp.Regexp
+}
+
+// compile compiles the regular expression of a matcher.
+func compile(m config.Matcher) (matcher, error) {
+	compiled := matcher{Matcher: m}
+	if m.Regex != "" {
+		var err error
+		if compiled.regex, err = regexp.Compile(m.Regex); err != nil {
+			return compiled, err
+		}
+	}
+	return compiled, nil
+}
+
+// matches reports whether the container meets every condition of m.
+func (m matcher) matches(container *service.ContainerItem) bool {
+	name := ""
+	if container.Name != nil {
+		name = *container.Name
+	}
+	if !strings.HasPrefix(name, m.Prefix) || !strings.HasSuffix(name, m.Suffix) {
+		return false
+	}
+	if m.regex != nil && !m.regex.MatchString(name) {
+		return false
+	}
+	for key, want := range m.Metadata {
+		value, ok := metadataValue(container.Metadata, key)
+		if !ok || (want != "*" && value != want) {
+			return false
+		}
+	}
+	return true
+}
+
+// metadataValue looks a metadata key up in any case.
+func metadataValue(metadata map[string]*string, key string) (string, bool) {
+	for k, v := range metadata {
+		if strings.EqualFold(k, key) {
+			if v == nil {
+				return "", true
+			}
+			return *v, true
+		}
+	}
+	return "", false
+}
+
+// describe says in words what a matcher matches, such as "with the -in
+// suffix".
+func describe(m config.Matcher) string {
+	var parts []string
+	if m.Prefix != "" {
+		parts = append(parts, fmt.Sprintf("with the %s prefix", m.Prefix))
+	}
+	if m.Suffix != "" {
+		parts = append(parts, fmt.Sprintf("with the %s suffix", m.Suffix))
+	}
+	if m.Regex != "" {
+		parts = append(parts, fmt.Sprintf("matching %s", m.Regex))
+	}
+	if len(m.Metadata) > 0 {
+		keys := make([]string, 0, len(m.Metadata))
+		for key := range m.Metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, key := range keys {
+			pairs[i] = key + "=" + m.Metadata[key]
+		}
+		parts = append(parts, "with metadata "+strings.Join(pairs, ", "))
+	}
+	return strings.Join(parts, " and ")
+}
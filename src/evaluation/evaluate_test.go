@@ -0,0 +1,240 @@
+package evaluation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gowithazure/src/config"
+	"gowithazure/src/scanner"
+	"gowithazure/src/storage"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+)
+
+// fakeContainer is a container of the fake storage account, holding blobs
+// of 100 bytes.
+type fakeContainer struct {
+	name         string
+	lastModified time.Time
+	metadata     map[string]string
+	blobs        int
+}
+
+// fakeAccount serves the containers of a storage account, listed pageSize at
+// a time with the index of the first container of a page as its marker. The
+// listing of the page at failPage, and the blob listing of the containers in
+// denied, are refused.
+type fakeAccount struct {
+	t          *testing.T
+	containers []fakeContainer
+	pageSize   int
+	failPage   string
+	denied     map[string]bool
+}
+
+func (f *fakeAccount) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if r.Method != http.MethodGet || query.Get("comp") != "list" {
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/devstoreaccount1/")
+	if query.Get("restype") == "container" {
+		if f.denied[name] {
+			w.Header().Set("x-ms-error-code", "AuthorizationPermissionMismatch")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Blobs>`)
+		for _, c := range f.containers {
+			if c.name != name {
+				continue
+			}
+			for i := range c.blobs {
+				fmt.Fprintf(w, `<Blob><Name>b%d</Name><Properties><Content-Length>100</Content-Length><Etag>e</Etag></Properties></Blob>`, i)
+			}
+		}
+		fmt.Fprint(w, `</Blobs><NextMarker/></EnumerationResults>`)
+		return
+	}
+
+	marker := query.Get("marker")
+	if marker != "" && marker == f.failPage {
+		w.Header().Set("x-ms-error-code", "AuthorizationFailure")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	start, _ := strconv.Atoi(marker)
+	end := len(f.containers)
+	if f.pageSize > 0 {
+		end = min(start+f.pageSize, end)
+	}
+	fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Containers>`)
+	for _, c := range f.containers[start:end] {
+		fmt.Fprintf(w, `<Container><Name>%s</Name><Properties><Last-Modified>%s</Last-Modified><Etag>e</Etag></Properties><Metadata>`,
+			c.name, c.lastModified.Format(http.TimeFormat))
+		for key, value := range c.metadata {
+			fmt.Fprintf(w, `<%s>%s</%s>`, key, value, key)
+		}
+		fmt.Fprint(w, `</Metadata></Container>`)
+	}
+	next := ""
+	if end < len(f.containers) {
+		next = strconv.Itoa(end)
+	}
+	fmt.Fprintf(w, `</Containers><NextMarker>%s</NextMarker></EnumerationResults>`, next)
+}
+
+// serve starts fake and returns its account and a scanner of it.
+func serve(t *testing.T, fake *fakeAccount) (config.Account, *scanner.Scanner) {
+	fake.t = t
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	account := config.Account{URL: server.URL + "/devstoreaccount1", AccountKey: "c2VjcmV0a2V5"}
+	scan := scanner.New(1, func(account config.Account) (*azblob.Client, error) { return storage.NewClient(account, nil) })
+	return account, scan
+}
+
+func TestMatcher(t *testing.T) {
+	tests := []struct {
+		matcher  config.Matcher
+		name     string
+		metadata map[string]*string
+		want     bool
+	}{
+		{matcher: config.Matcher{}, name: "anything", want: true},
+		{matcher: config.Matcher{Suffix: "-in"}, name: "job1-in", want: true},
+		{matcher: config.Matcher{Suffix: "-in"}, name: "job1-in-x", want: false},
+		{matcher: config.Matcher{Prefix: "job"}, name: "job1-out", want: true},
+		{matcher: config.Matcher{Prefix: "job"}, name: "myjob1", want: false},
+		{matcher: config.Matcher{Prefix: "job", Suffix: "-out"}, name: "job1-in", want: false},
+		{matcher: config.Matcher{Regex: `^scratch-\d+$`}, name: "scratch-42", want: true},
+		{matcher: config.Matcher{Regex: `^scratch-\d+$`}, name: "scratch-x", want: false},
+		{matcher: config.Matcher{Regex: `tmp`}, name: "a-tmp-b", want: true},
+		{matcher: config.Matcher{Metadata: map[string]string{"team": "video"}}, name: "c", metadata: map[string]*string{"Team": to.Ptr("video")}, want: true},
+		{matcher: config.Matcher{Metadata: map[string]string{"team": "video"}}, name: "c", metadata: map[string]*string{"team": to.Ptr("audio")}, want: false},
+		{matcher: config.Matcher{Metadata: map[string]string{"team": "*"}}, name: "c", metadata: map[string]*string{"team": to.Ptr("audio")}, want: true},
+		{matcher: config.Matcher{Metadata: map[string]string{"team": "*"}}, name: "c", want: false},
+		{matcher: config.Matcher{Suffix: "-in", Metadata: map[string]string{"team": "*"}}, name: "c-out", metadata: map[string]*string{"team": nil}, want: false},
+	}
+	for _, test := range tests {
+		m, err := compile(test.matcher)
+		if err != nil {
+			t.Fatalf("compile(%+v): %v", test.matcher, err)
+		}
+		if got := m.matches(&service.ContainerItem{Name: &test.name, Metadata: test.metadata}); got != test.want {
+			t.Errorf("%s matching %+v: got %t, want %t", describe(test.matcher), test.name, got, test.want)
+		}
+	}
+}
+
+func TestNewRejectsAnInvalidRegex(t *testing.T) {
+	_, err := New("broken", config.Evaluation{Buckets: []config.Bucket{{Name: "b", Matcher: config.Matcher{Regex: "("}}}})
+	if err == nil || !strings.Contains(err.Error(), "evaluation broken, bucket b") {
+		t.Errorf("New: %v, want the invalid regex of bucket b", err)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Now().UTC()
+	days := func(n int) time.Time { return now.Add(-time.Duration(n) * 24 * time.Hour) }
+	account, scan := serve(t, &fakeAccount{containers: []fakeContainer{
+		{name: "job1-in", lastModified: days(30)},
+		{name: "job1-out", lastModified: days(8), metadata: map[string]string{"team": "video"}},
+		{name: "job2-in", lastModified: days(6)},
+		{name: "scratch-1", lastModified: days(30), metadata: map[string]string{"Team": "data"}},
+		{name: "scratch-2", lastModified: days(1)},
+	}})
+
+	tests := []struct {
+		name       string
+		evaluation config.Evaluation
+		total      int
+		buckets    []int
+		inAny      int
+	}{
+		{
+			// Every stale container is counted, -in and -out or not.
+			name:       VideoName,
+			evaluation: Video,
+			total:      3,
+			buckets:    []int{1, 1},
+			inAny:      2,
+		},
+		{
+			name:       "scratch",
+			evaluation: config.Evaluation{Match: config.Matcher{Prefix: "scratch-"}},
+			total:      2,
+		},
+		{
+			name: "teams",
+			evaluation: config.Evaluation{
+				OlderThanDays: 7,
+				Buckets: []config.Bucket{
+					{Name: "tagged", Matcher: config.Matcher{Metadata: map[string]string{"team": "*"}}},
+					{Name: "video", Matcher: config.Matcher{Metadata: map[string]string{"team": "video"}}},
+					{Name: "numbered", Matcher: config.Matcher{Regex: `\d`}},
+				},
+			},
+			total:   3,
+			buckets: []int{2, 1, 3},
+			inAny:   3,
+		},
+		{
+			name:       "recent",
+			evaluation: config.Evaluation{OlderThanDays: 7, Match: config.Matcher{Suffix: "-in"}},
+			total:      1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			evaluator, err := New(test.name, test.evaluation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			results, err := evaluator.Evaluate(context.Background(), scan, []config.Account{account})
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+			result := results[0]
+			if result.Total != test.total || result.InAnyBucket != test.inAny || len(result.Buckets) != len(test.evaluation.Buckets) {
+				t.Errorf("total %d, in any bucket %d, %d buckets; want %d, %d, %d",
+					result.Total, result.InAnyBucket, len(result.Buckets), test.total, test.inAny, len(test.evaluation.Buckets))
+			}
+			for i, bucket := range result.Buckets {
+				if bucket.Name != test.evaluation.Buckets[i].Name || bucket.Containers != test.buckets[i] {
+					t.Errorf("bucket %s: %d containers, want %s: %d", bucket.Name, bucket.Containers, test.evaluation.Buckets[i].Name, test.buckets[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateReportsAFailedAccount(t *testing.T) {
+	now := time.Now().UTC()
+	account, scan := serve(t, &fakeAccount{
+		containers: []fakeContainer{{name: "a-in", lastModified: now.AddDate(0, 0, -30)}, {name: "b-in", lastModified: now.AddDate(0, 0, -30)}},
+		pageSize:   1,
+		failPage:   "1",
+	})
+	evaluator, err := Lookup(nil, VideoName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := evaluator.Evaluate(context.Background(), scan, []config.Account{account})
+	if err == nil {
+		t.Fatal("Evaluate succeeded with a failed listing")
+	}
+	if results[0].Total != 1 || !strings.Contains(results[0].Error, "AuthorizationFailure") {
+		t.Errorf("got %+v, want the first page counted and the failure", results[0])
+	}
+}
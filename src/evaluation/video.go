@@ -0,0 +1,45 @@
+package evaluation
+
+import (
+	"strings"
+	"time"
+
+	"gowithazure/src/config"
+)
+
+// VideoName is the name of the built-in evaluation of the video pipeline,
+// used when the profiles file does not define one of that name.
+const VideoName = "video"
+
+// StaleAfter is how long a video container must go unmodified before it is
+// counted.
+const StaleAfter = 7 * 24 * time.Hour
+
+// Video is the built-in evaluation of the video pipeline: containers that
+// have not been modified for StaleAfter, in buckets of those with the suffix
+// -in or -out.
+var Video = config.Evaluation{
+	OlderThanDays: int(StaleAfter / (24 * time.Hour)),
+	Buckets: []config.Bucket{
+		{Name: "in", Matcher: config.Matcher{Suffix: "-in"}},
+		{Name: "out", Matcher: config.Matcher{Suffix: "-out"}},
+	},
+}
+
+// Stale reports whether a container last modified at lastModified has been
+// left alone for longer than StaleAfter at now.
+func Stale(lastModified, now time.Time) bool {
+	return now.Sub(lastModified) > StaleAfter
+}
+
+// Direction returns "in" or "out" for a container named with the -in or -out
+// suffix, and "" for any other container.
+func Direction(name string) string {
+	switch {
+	case strings.HasSuffix(name, "-in"):
+		return "in"
+	case strings.HasSuffix(name, "-out"):
+		return "out"
+	}
+	return ""
+}
@@ -0,0 +1,185 @@
+// Package history records snapshots of the storage accounts in a local BoltDB
+// database, keyed by profile and run time, so that container counts, the
+// -in/-out backlog and empty containers can be followed over days and weeks.
+package history
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gowithazure/src/config"
+	"gowithazure/src/evaluation"
+	"gowithazure/src/scanner"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+)
+
+// Snapshot is the state of the storage accounts of a profile at one run.
+type Snapshot struct {
+	Time    time.Time `json:"time"`
+	Profile string    `json:"profile"`
+	// Blobs is set when every blob was counted and sized; otherwise each
+	// container was only probed to tell whether it is empty.
+	Blobs    bool              `json:"blobs"`
+	Accounts []AccountSnapshot `json:"accounts"`
+}
+
+// AccountSnapshot is the state of one storage account.
+type AccountSnapshot struct {
+	URL        string              `json:"url"`
+	Containers []ContainerSnapshot `json:"containers"`
+	Error      string              `json:"error,omitempty"`
+}
+
+// ContainerSnapshot is the state of one container. Blobs and Bytes are only
+// known when the snapshot counted blobs; Empty is always known unless the
+// container could not be listed, in which case Error says why.
+type ContainerSnapshot struct {
+	Name         string    `json:"name"`
+	LastModified time.Time `json:"lastModified"`
+	Empty        bool      `json:"empty"`
+	Blobs        int64     `json:"blobs,omitempty"`
+	Bytes        int64     `json:"bytes,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// Take scans the storage accounts and returns their snapshot at now. When
+// blobs is set every blob is counted and sized, which is slow on large
+// accounts; otherwise each container is probed for a single blob. A failed
+// account or container is recorded in the snapshot, which is returned along
+// with the scan error.
+func Take(ctx context.Context, scan *scanner.Scanner, accounts []config.Account, profile string, blobs bool) (Snapshot, error) {
+	snapshot := Snapshot{Time: time.Now().UTC(), Profile: profile, Blobs: blobs}
+
+	listing := *scan
+	listing.ListContainers = &azblob.ListContainersOptions{}
+	listing.ListBlobs = &azblob.ListBlobsFlatOptions{}
+	if !blobs {
+		maxResults := int32(1)
+		listing.ListBlobs.MaxResults = &maxResults
+	}
+
+	type key struct {
+		account   int
+		container string
+	}
+	var (
+		mu         sync.Mutex
+		containers = make(map[key]*ContainerSnapshot)
+		seen       = make(map[key]bool)
+	)
+
+	err := listing.Scan(ctx, accounts, scanner.Callbacks{
+		Container: func(_ context.Context, account *scanner.Account, item *service.ContainerItem) error {
+			state := &ContainerSnapshot{Name: *item.Name}
+			if item.Properties != nil && item.Properties.LastModified != nil {
+				state.LastModified = item.Properties.LastModified.UTC()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			containers[key{account.Index, *item.Name}] = state
+			return nil
+		},
+		Blob: func(_ context.Context, account *scanner.Account, containerName string, item *container.BlobItem) error {
+			mu.Lock()
+			defer mu.Unlock()
+			k := key{account.Index, containerName}
+			seen[k] = true
+			if !blobs {
+				return scanner.SkipContainer
+			}
+			state := containers[k]
+			state.Blobs++
+			if item.Properties != nil && item.Properties.ContentLength != nil {
+				state.Bytes += *item.Properties.ContentLength
+			}
+			return nil
+		},
+		ContainerDone: func(account *scanner.Account, containerName string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			k := key{account.Index, containerName}
+			if err != nil {
+				containers[k].Error = config.Redact(err.Error())
+				return
+			}
+			containers[k].Empty = !seen[k]
+		},
+	})
+
+	snapshot.Accounts = make([]AccountSnapshot, len(accounts))
+	for i, account := range accounts {
+		snapshot.Accounts[i] = AccountSnapshot{URL: account.String(), Error: scanner.Message(err, i)}
+	}
+	for k, state := range containers {
+		snapshot.Accounts[k.account].Containers = append(snapshot.Accounts[k.account].Containers, *state)
+	}
+	for i := range snapshot.Accounts {
+		containers := snapshot.Accounts[i].Containers
+		sort.Slice(containers, func(a, b int) bool { return containers[a].Name < containers[b].Name })
+	}
+
+	return snapshot, err
+}
+
+// Summary is the totals of one storage account at one run, the unit of a
+// history. Account is empty when the summary covers every account of the run.
+type Summary struct {
+	Time       time.Time `json:"time"`
+	Account    string    `json:"account,omitempty"`
+	Containers int       `json:"containers"`
+	Empty      int       `json:"empty"`
+	// StaleIn and StaleOut are the -in and -out containers left unmodified
+	// for longer than evaluation.StaleAfter: the backlog.
+	StaleIn            int    `json:"staleIn"`
+	StaleOut           int    `json:"staleOut"`
+	ModifiedLast30Days int    `json:"modifiedLast30Days"`
+	OlderThanTwoYears  int    `json:"olderThanTwoYears"`
+	Blobs              int64  `json:"blobs,omitempty"`
+	Bytes              int64  `json:"bytes,omitempty"`
+	Error              string `json:"error,omitempty"`
+}
+
+// Summaries returns the totals of every account of the snapshot, with ages
+// measured at the time of the snapshot.
+func (s Snapshot) Summaries() []Summary {
+	twoYearsAgo := s.Time.AddDate(-2, 0, 0)
+	thirtyDaysAgo := s.Time.AddDate(0, -1, 0)
+
+	summaries := make([]Summary, len(s.Accounts))
+	for i, account := range s.Accounts {
+		summary := Summary{Time: s.Time, Account: account.URL, Containers: len(account.Containers), Error: account.Error}
+		for _, state := range account.Containers {
+			if state.Empty {
+				summary.Empty++
+			}
+			summary.Blobs += state.Blobs
+			summary.Bytes += state.Bytes
+
+			// Containers listed without a last modified time have no age.
+			if state.LastModified.IsZero() {
+				continue
+			}
+			if evaluation.Stale(state.LastModified, s.Time) {
+				switch evaluation.Direction(state.Name) {
+				case "in":
+					summary.StaleIn++
+				case "out":
+					summary.StaleOut++
+				}
+			}
+			if state.LastModified.After(thirtyDaysAgo) {
+				summary.ModifiedLast30Days++
+			}
+			if state.LastModified.Before(twoYearsAgo) {
+				summary.OlderThanTwoYears++
+			}
+		}
+		summaries[i] = summary
+	}
+	return summaries
+}
@@ -0,0 +1,134 @@
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gowithazure/src/config"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// The database holds a bucket per profile, and in it a bucket of full
+// snapshots and one of their summaries, both keyed by run time. A history
+// only reads the small summaries.
+var (
+	snapshotsBucket = []byte("snapshots")
+	summariesBucket = []byte("summaries")
+)
+
+// Store is the history database.
+type Store struct {
+	db *bolt.DB
+}
+
+// DefaultPath is where the history database is kept when no file is given:
+// history.db in config.DataDir.
+func DefaultPath() (string, error) {
+	dir, err := config.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.db"), nil
+}
+
+// Open opens the database at path, creating it and its directory if needed.
+// Only one process can have the database open at a time.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("history database %s is in use by another run", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening history database %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Save records a snapshot and its summaries under its profile and time.
+func (s *Store) Save(snapshot Snapshot) error {
+	full, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	summaries, err := json.Marshal(snapshot.Summaries())
+	if err != nil {
+		return err
+	}
+
+	key := timeKey(snapshot.Time)
+	return s.db.Update(func(tx *bolt.Tx) error {
+		profile, err := tx.CreateBucketIfNotExists([]byte(snapshot.Profile))
+		if err != nil {
+			return err
+		}
+		if err := put(profile, snapshotsBucket, key, full); err != nil {
+			return err
+		}
+		return put(profile, summariesBucket, key, summaries)
+	})
+}
+
+// put stores value under key in the named bucket of parent.
+func put(parent *bolt.Bucket, name, key, value []byte) error {
+	bucket, err := parent.CreateBucketIfNotExists(name)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, value)
+}
+
+// Summaries returns the account summaries of every run of the profile since
+// the given time, oldest first.
+func (s *Store) Summaries(profile string, since time.Time) ([]Summary, error) {
+	var summaries []Summary
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(profile))
+		if bucket == nil {
+			return nil
+		}
+		bucket = bucket.Bucket(summariesBucket)
+		if bucket == nil {
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+		key, value := cursor.First()
+		if since.After(time.Unix(0, 0)) {
+			key, value = cursor.Seek(timeKey(since))
+		}
+		for ; key != nil; key, value = cursor.Next() {
+			var run []Summary
+			if err := json.Unmarshal(value, &run); err != nil {
+				return fmt.Errorf("reading run of %s: %w", keyTime(key).Format(time.RFC3339), err)
+			}
+			summaries = append(summaries, run...)
+		}
+		return nil
+	})
+	return summaries, err
+}
+
+// timeKey encodes a run time so keys sort in time order.
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+func keyTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key))).UTC()
+}
@@ -0,0 +1,81 @@
+package history
+
+import (
+	"fmt"
+	"time"
+)
+
+// Periods are the ways a history can group runs: every run, or the last run
+// of each day or week.
+var Periods = []string{"run", "day", "week"}
+
+// Trend turns account summaries, oldest first, into the points of a history.
+// by is one of Periods: every run is a point, or only the last run of each
+// UTC day or week (weeks start on Monday). Unless perAccount is set, the
+// accounts of a run are added up into one summary without an Account.
+func Trend(summaries []Summary, by string, perAccount bool) []Summary {
+	// Summaries of the same run share its time and are stored together.
+	var runs [][]Summary
+	for _, summary := range summaries {
+		if n := len(runs); n > 0 && runs[n-1][0].Time.Equal(summary.Time) {
+			runs[n-1] = append(runs[n-1], summary)
+			continue
+		}
+		runs = append(runs, []Summary{summary})
+	}
+
+	if by != "run" {
+		var last [][]Summary
+		for _, run := range runs {
+			if n := len(last); n > 0 && period(last[n-1][0].Time, by).Equal(period(run[0].Time, by)) {
+				last[n-1] = run
+				continue
+			}
+			last = append(last, run)
+		}
+		runs = last
+	}
+
+	var points []Summary
+	for _, run := range runs {
+		if perAccount {
+			points = append(points, run...)
+		} else {
+			points = append(points, total(run))
+		}
+	}
+	return points
+}
+
+// period returns the start of the day or week t falls in.
+func period(t time.Time, by string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if by == "week" {
+		// Go weeks start on Sunday, ISO weeks on Monday.
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day
+}
+
+// total adds up the account summaries of one run.
+func total(run []Summary) Summary {
+	sum := Summary{Time: run[0].Time}
+	failed := 0
+	for _, summary := range run {
+		sum.Containers += summary.Containers
+		sum.Empty += summary.Empty
+		sum.StaleIn += summary.StaleIn
+		sum.StaleOut += summary.StaleOut
+		sum.ModifiedLast30Days += summary.ModifiedLast30Days
+		sum.OlderThanTwoYears += summary.OlderThanTwoYears
+		sum.Blobs += summary.Blobs
+		sum.Bytes += summary.Bytes
+		if summary.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		sum.Error = fmt.Sprintf("%d of %d storage accounts incomplete", failed, len(run))
+	}
+	return sum
+}
@@ -0,0 +1,149 @@
+package inventory
+
+import (
+	"context"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"gowithazure/src/config"
+	"gowithazure/src/scanner"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+)
+
+// BlobRecord is one row of a blob inventory.
+type BlobRecord struct {
+	Account              string            `json:"account"`
+	Container            string            `json:"container"`
+	Name                 string            `json:"name"`
+	Size                 int64             `json:"size"`
+	ContentType          string            `json:"contentType,omitempty"`
+	AccessTier           string            `json:"accessTier,omitempty"`
+	AccessTierInferred   bool              `json:"accessTierInferred"`
+	AccessTierChangeTime *time.Time        `json:"accessTierChangeTime,omitempty"`
+	ArchiveStatus        string            `json:"archiveStatus,omitempty"`
+	CreationTime         *time.Time        `json:"creationTime,omitempty"`
+	LastModified         *time.Time        `json:"lastModified,omitempty"`
+	LastAccessTime       *time.Time        `json:"lastAccessTime,omitempty"`
+	BlobType             string            `json:"blobType,omitempty"`
+	ContentMD5           string            `json:"contentMD5,omitempty"`
+	ETag                 string            `json:"etag,omitempty"`
+	VersionID            string            `json:"versionId,omitempty"`
+	IsCurrentVersion     bool              `json:"isCurrentVersion"`
+	Snapshot             string            `json:"snapshot,omitempty"`
+	Deleted              bool              `json:"deleted"`
+	Tags                 map[string]string `json:"tags,omitempty"`
+}
+
+// BlobOptions selects the containers and blobs of an inventory.
+type BlobOptions struct {
+	ContainerOptions
+	// BlobPrefix limits the inventory to blobs whose name starts with it.
+	BlobPrefix string
+	// Versions includes previous versions and Snapshots includes snapshots.
+	Versions  bool
+	Snapshots bool
+}
+
+// Blobs calls fn with the records of every page of blobs in the storage
+// accounts, followed by the marker of the next page of that container ("" once
+// it is complete). fn is never called concurrently and each page is passed in
+// one call. When the scanner has Progress, fn runs as the commit of the page,
+// so a resumed inventory neither duplicates nor loses records.
+func Blobs(ctx context.Context, scan *scanner.Scanner, accounts []config.Account, options BlobOptions, fn func(records []BlobRecord, account, containerName, nextMarker string) error) error {
+	listing := *scan
+	listing.ListContainers = &azblob.ListContainersOptions{
+		Include: azblob.ListContainersInclude{Deleted: false},
+	}
+	if options.Prefix != "" {
+		listing.ListContainers.Prefix = &options.Prefix
+	}
+	listing.ListBlobs = &azblob.ListBlobsFlatOptions{
+		Include: azblob.ListBlobsInclude{
+			Tags:      true,
+			Deleted:   options.Deleted,
+			Versions:  options.Versions,
+			Snapshots: options.Snapshots,
+		},
+	}
+	if options.BlobPrefix != "" {
+		listing.ListBlobs.Prefix = &options.BlobPrefix
+	}
+
+	type key struct {
+		account   int
+		container string
+	}
+	var (
+		mu    sync.Mutex
+		pages = make(map[key][]BlobRecord)
+	)
+
+	callbacks := scanner.Callbacks{
+		Blob: func(_ context.Context, account *scanner.Account, containerName string, item *container.BlobItem) error {
+			mu.Lock()
+			defer mu.Unlock()
+			k := key{account.Index, containerName}
+			pages[k] = append(pages[k], blobRecord(account.URL, containerName, item))
+			return nil
+		},
+		BlobPage: func(_ context.Context, account *scanner.Account, containerName, nextMarker string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			k := key{account.Index, containerName}
+			records := pages[k]
+			delete(pages, k)
+			return fn(records, account.URL, containerName, nextMarker)
+		},
+		ContainerDone: func(account *scanner.Account, containerName string, _ error) {
+			// Drop the partial page of a container whose listing failed.
+			mu.Lock()
+			defer mu.Unlock()
+			delete(pages, key{account.Index, containerName})
+		},
+	}
+	return listing.Scan(ctx, accounts, callbacks)
+}
+
+// blobRecord flattens a listed blob into its record.
+func blobRecord(account, containerName string, item *container.BlobItem) BlobRecord {
+	record := BlobRecord{
+		Account:          account,
+		Container:        containerName,
+		Name:             deref(item.Name),
+		VersionID:        deref(item.VersionID),
+		IsCurrentVersion: deref(item.IsCurrentVersion),
+		Snapshot:         deref(item.Snapshot),
+		Deleted:          deref(item.Deleted),
+	}
+
+	if item.BlobTags != nil && len(item.BlobTags.BlobTagSet) > 0 {
+		record.Tags = make(map[string]string, len(item.BlobTags.BlobTagSet))
+		for _, tag := range item.BlobTags.BlobTagSet {
+			record.Tags[deref(tag.Key)] = deref(tag.Value)
+		}
+	}
+
+	if props := item.Properties; props != nil {
+		record.Size = deref(props.ContentLength)
+		record.ContentType = deref(props.ContentType)
+		record.AccessTier = string(deref(props.AccessTier))
+		record.AccessTierInferred = deref(props.AccessTierInferred)
+		record.AccessTierChangeTime = props.AccessTierChangeTime
+		record.ArchiveStatus = string(deref(props.ArchiveStatus))
+		record.CreationTime = props.CreationTime
+		record.LastModified = props.LastModified
+		record.LastAccessTime = props.LastAccessedOn
+		record.BlobType = string(deref(props.BlobType))
+		if len(props.ContentMD5) > 0 {
+			record.ContentMD5 = base64.StdEncoding.EncodeToString(props.ContentMD5)
+		}
+		if props.ETag != nil {
+			record.ETag = string(*props.ETag)
+		}
+	}
+
+	return record
+}
@@ -0,0 +1,130 @@
+// Package inventory exports the containers, and the blobs, of storage accounts
+// as records written to CSV, JSON Lines or Parquet. Records are written as the
+// listings are paged in, so an inventory never holds a full account in memory.
+package inventory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gowithazure/src/config"
+	"gowithazure/src/scanner"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+)
+
+// ContainerRecord is one row of a container inventory.
+type ContainerRecord struct {
+	Account                        string            `json:"account"`
+	Name                           string            `json:"name"`
+	LastModified                   *time.Time        `json:"lastModified,omitempty"`
+	ETag                           string            `json:"etag,omitempty"`
+	LeaseState                     string            `json:"leaseState,omitempty"`
+	LeaseStatus                    string            `json:"leaseStatus,omitempty"`
+	LeaseDuration                  string            `json:"leaseDuration,omitempty"`
+	PublicAccess                   string            `json:"publicAccess,omitempty"`
+	Metadata                       map[string]string `json:"metadata,omitempty"`
+	HasImmutabilityPolicy          bool              `json:"hasImmutabilityPolicy"`
+	HasLegalHold                   bool              `json:"hasLegalHold"`
+	ImmutableStorageWithVersioning bool              `json:"immutableStorageWithVersioning"`
+	Deleted                        bool              `json:"deleted"`
+	Version                        string            `json:"version,omitempty"`
+	DeletedTime                    *time.Time        `json:"deletedTime,omitempty"`
+	RemainingRetentionDays         int32             `json:"remainingRetentionDays,omitempty"`
+	DefaultEncryptionScope         string            `json:"defaultEncryptionScope,omitempty"`
+	PreventEncryptionScopeOverride bool              `json:"preventEncryptionScopeOverride"`
+}
+
+// ContainerOptions selects the containers of an inventory.
+type ContainerOptions struct {
+	// Prefix limits the inventory to containers whose name starts with it.
+	Prefix string
+	// Deleted includes soft-deleted containers.
+	Deleted bool
+}
+
+// Containers calls fn with the records of every page of containers in the
+// storage accounts, followed by the marker of the next page of that account
+// ("" once it is complete). Accounts are listed concurrently but fn is never
+// called concurrently, so it may write to a single Writer. When the scanner
+// has Progress, fn runs as the commit of the page.
+func Containers(ctx context.Context, scan *scanner.Scanner, accounts []config.Account, options ContainerOptions, fn func(records []ContainerRecord, account, nextMarker string) error) error {
+	listing := *scan
+	listing.ListContainers = &azblob.ListContainersOptions{
+		Include: azblob.ListContainersInclude{Metadata: true, Deleted: options.Deleted},
+	}
+	if options.Prefix != "" {
+		listing.ListContainers.Prefix = &options.Prefix
+	}
+
+	// The containers of one account are listed in order, so each account
+	// buffers its current page on its own.
+	pages := make([][]ContainerRecord, len(accounts))
+	var mu sync.Mutex
+	return listing.Scan(ctx, accounts, scanner.Callbacks{
+		Container: func(_ context.Context, account *scanner.Account, item *service.ContainerItem) error {
+			pages[account.Index] = append(pages[account.Index], containerRecord(account.URL, item))
+			return nil
+		},
+		ContainerPage: func(_ context.Context, account *scanner.Account, nextMarker string) error {
+			records := pages[account.Index]
+			pages[account.Index] = nil
+			mu.Lock()
+			defer mu.Unlock()
+			return fn(records, account.URL, nextMarker)
+		},
+	})
+}
+
+// containerRecord flattens a listed container into its record.
+func containerRecord(account string, item *service.ContainerItem) ContainerRecord {
+	record := ContainerRecord{
+		Account:  account,
+		Name:     deref(item.Name),
+		Deleted:  deref(item.Deleted),
+		Version:  deref(item.Version),
+		Metadata: metadata(item.Metadata),
+	}
+
+	if props := item.Properties; props != nil {
+		record.LastModified = props.LastModified
+		if props.ETag != nil {
+			record.ETag = string(*props.ETag)
+		}
+		record.LeaseState = string(deref(props.LeaseState))
+		record.LeaseStatus = string(deref(props.LeaseStatus))
+		record.LeaseDuration = string(deref(props.LeaseDuration))
+		record.PublicAccess = string(deref(props.PublicAccess))
+		record.HasImmutabilityPolicy = deref(props.HasImmutabilityPolicy)
+		record.HasLegalHold = deref(props.HasLegalHold)
+		record.ImmutableStorageWithVersioning = deref(props.IsImmutableStorageWithVersioningEnabled)
+		record.DeletedTime = props.DeletedTime
+		record.RemainingRetentionDays = deref(props.RemainingRetentionDays)
+		record.DefaultEncryptionScope = deref(props.DefaultEncryptionScope)
+		record.PreventEncryptionScopeOverride = deref(props.PreventEncryptionScopeOverride)
+	}
+
+	return record
+}
+
+// deref returns the value p points to, or the zero value when p is nil.
+func deref[T any](p *T) T {
+	if p == nil {
+		return *new(T)
+	}
+	return *p
+}
+
+// metadata drops the pointers from a listed metadata map.
+func metadata(m map[string]*string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(m))
+	for key, value := range m {
+		result[key] = deref(value)
+	}
+	return result
+}
@@ -0,0 +1,163 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// parquetRowGroupSize bounds the bytes buffered before a row group is written
+// out, and with it the memory used by a Parquet inventory.
+const parquetRowGroupSize = 16 * 1024 * 1024
+
+// parquetParallelism is the number of goroutines encoding a row group.
+const parquetParallelism = 4
+
+// parquetWriter writes records as a Snappy compressed Parquet file. The schema
+// is taken from the json field names of the record type, like the CSV
+// columns: strings, booleans and integers map to their Parquet types, times
+// become millisecond timestamps, and maps, slices and structs are stored as
+// JSON text. Every column is optional so that nil pointers and empty maps are
+// null.
+type parquetWriter struct {
+	w       *writer.CSVWriter
+	columns []parquetColumn
+}
+
+// parquetColumn is one column of the file and the field it is read from.
+type parquetColumn struct {
+	index []int
+	kind  string
+}
+
+// The kinds of parquetColumn, by the Parquet type they are written as.
+const (
+	columnText      = "BYTE_ARRAY"
+	columnBoolean   = "BOOLEAN"
+	columnInt32     = "INT32"
+	columnInt64     = "INT64"
+	columnTimestamp = "TIMESTAMP_MILLIS"
+)
+
+func newParquetWriter(w io.Writer, prototype any) (*parquetWriter, error) {
+	t := reflect.TypeOf(prototype)
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("parquet records must be structs, got %s", t)
+	}
+
+	p := &parquetWriter{}
+	var schema []string
+	p.addColumns(t, nil, &schema)
+	pw, err := writer.NewCSVWriterFromWriter(schema, w, parquetParallelism)
+	if err != nil {
+		return nil, err
+	}
+	pw.RowGroupSize = parquetRowGroupSize
+	p.w = pw
+	return p, nil
+}
+
+// addColumns adds a column for every exported field of t, flattening embedded
+// structs, and appends its schema metadata.
+func (p *parquetWriter) addColumns(t reflect.Type, index []int, schema *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		fieldIndex := append(append([]int(nil), index...), i)
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			p.addColumns(field.Type, fieldIndex, schema)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		column := parquetColumn{index: fieldIndex, kind: columnText}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		switch {
+		case fieldType == reflect.TypeOf(time.Time{}):
+			column.kind = columnTimestamp
+		case fieldType.Kind() == reflect.Bool:
+			column.kind = columnBoolean
+		case fieldType.Kind() == reflect.Int32:
+			column.kind = columnInt32
+		case fieldType.Kind() == reflect.Int || fieldType.Kind() == reflect.Int64:
+			column.kind = columnInt64
+		}
+		p.columns = append(p.columns, column)
+
+		var metadata string
+		switch column.kind {
+		case columnText:
+			metadata = "type=BYTE_ARRAY, convertedtype=UTF8"
+		case columnTimestamp:
+			metadata = "type=INT64, convertedtype=TIMESTAMP_MILLIS"
+		default:
+			metadata = "type=" + column.kind
+		}
+		*schema = append(*schema, fmt.Sprintf("name=%s, %s, repetitiontype=OPTIONAL", name, metadata))
+	}
+}
+
+func (p *parquetWriter) Write(record any) error {
+	value := reflect.ValueOf(record)
+	row := make([]any, len(p.columns))
+	for i, column := range p.columns {
+		row[i] = column.value(value.FieldByIndex(column.index))
+	}
+	return p.w.Write(row)
+}
+
+func (p *parquetWriter) Close() error {
+	return p.w.WriteStop()
+}
+
+// value returns the Parquet value of a field, nil for null.
+func (c parquetColumn) value(field reflect.Value) any {
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return nil
+		}
+		field = field.Elem()
+	}
+
+	switch c.kind {
+	case columnBoolean:
+		return field.Bool()
+	case columnInt32:
+		return int32(field.Int())
+	case columnInt64:
+		return field.Int()
+	case columnTimestamp:
+		t := field.Interface().(time.Time)
+		if t.IsZero() {
+			return nil
+		}
+		return t.UnixMilli()
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		return field.String()
+	case reflect.Map, reflect.Slice:
+		if field.Len() == 0 {
+			return nil
+		}
+	}
+	data, _ := json.Marshal(field.Interface())
+	return string(data)
+}
@@ -0,0 +1,134 @@
+package inventory
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// readParquet reads every column of a Parquet file with the reader of the
+// Parquet library and returns the values of each column by name, nil for
+// nulls, and the metadata of the file.
+func readParquet(t *testing.T, data []byte) (map[string][]any, *parquet.FileMetaData) {
+	t.Helper()
+	file, err := buffer.NewBufferFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err := reader.NewParquetColumnReader(file, 1)
+	if err != nil {
+		t.Fatalf("opening the file: %v", err)
+	}
+	defer pr.ReadStop()
+
+	rows := pr.GetNumRows()
+	columns := make(map[string][]any)
+	// The reader renames the schema; ExName is the name in the file.
+	for i, info := range pr.SchemaHandler.Infos[1:] {
+		values, _, _, err := pr.ReadColumnByIndex(int64(i), rows)
+		if err != nil {
+			t.Fatalf("reading column %s: %v", info.ExName, err)
+		}
+		if int64(len(values)) != rows {
+			t.Fatalf("column %s has %d values, want %d", info.ExName, len(values), rows)
+		}
+		columns[info.ExName] = values
+	}
+	return columns, pr.Footer
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	records := []BlobRecord{
+		{
+			Account:          "https://usprodvideo.blob.core.windows.net/",
+			Container:        "job42-in",
+			Name:             "raw/take1.mp4",
+			Size:             1 << 40,
+			AccessTier:       "Archive",
+			LastModified:     &modified,
+			IsCurrentVersion: true,
+			Tags:             map[string]string{"job": "42"},
+		},
+		{Account: "https://usprodvideo.blob.core.windows.net/", Container: "job42-in", Name: "raw/take2.mp4", Deleted: true},
+	}
+
+	var out bytes.Buffer
+	w, err := NewWriter(&out, "parquet", BlobRecord{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		if err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	columns, _ := readParquet(t, out.Bytes())
+	want := map[string][]any{
+		"account":          {records[0].Account, records[1].Account},
+		"name":             {"raw/take1.mp4", "raw/take2.mp4"},
+		"size":             {int64(1 << 40), int64(0)},
+		"accessTier":       {"Archive", ""},
+		"lastModified":     {modified.UnixMilli(), nil},
+		"creationTime":     {nil, nil},
+		"isCurrentVersion": {true, false},
+		"deleted":          {false, true},
+		"tags":             {`{"job":"42"}`, nil},
+	}
+	for name, values := range want {
+		if !reflect.DeepEqual(columns[name], values) {
+			t.Errorf("column %s = %#v, want %#v", name, columns[name], values)
+		}
+	}
+	if len(columns) != reflect.TypeOf(BlobRecord{}).NumField() {
+		t.Errorf("got %d columns, want one per field of BlobRecord", len(columns))
+	}
+}
+
+func TestParquetRowGroups(t *testing.T) {
+	var out bytes.Buffer
+	w, err := NewWriter(&out, "parquet", ContainerRecord{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Small row groups, to split the rows without writing megabytes.
+	w.(*parquetWriter).w.RowGroupSize = 64 * 1024
+	const rows = 20000
+	for i := range rows {
+		record := ContainerRecord{Name: fmt.Sprintf("c%d", i), ETag: fmt.Sprintf("0x%016X", uint64(i)*2654435761), RemainingRetentionDays: int32(i)}
+		if err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	columns, footer := readParquet(t, out.Bytes())
+	if len(footer.RowGroups) < 2 {
+		t.Errorf("got %d row groups, want the rows split across several", len(footer.RowGroups))
+	}
+	for _, group := range footer.RowGroups {
+		for _, chunk := range group.Columns {
+			if codec := chunk.MetaData.Codec; codec != parquet.CompressionCodec_SNAPPY {
+				t.Fatalf("column %v is %s, want it compressed with Snappy", chunk.MetaData.PathInSchema, codec)
+			}
+		}
+	}
+	names, days := columns["name"], columns["remainingRetentionDays"]
+	for _, i := range []int{0, rows / 2, rows - 1} {
+		if names[i] != fmt.Sprintf("c%d", i) || days[i] != int32(i) {
+			t.Errorf("row %d: name %v, remainingRetentionDays %v", i, names[i], days[i])
+		}
+	}
+}
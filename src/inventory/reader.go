@@ -0,0 +1,125 @@
+package inventory
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReadBlobs reads a blob inventory written by Blobs in format and calls fn
+// with every record, in order. Only csv and jsonl inventories can be read
+// back. Columns that are not fields of BlobRecord are ignored, so inventories
+// written by other versions still read.
+func ReadBlobs(r io.Reader, format string, fn func(record BlobRecord) error) error {
+	switch format {
+	case "csv":
+		return readCSV(r, fn)
+	case "jsonl":
+		decoder := json.NewDecoder(r)
+		for line := 1; ; line++ {
+			var record BlobRecord
+			err := decoder.Decode(&record)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("reading inventory record %d: %w", line, err)
+			}
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+	case "parquet":
+		return errors.New("parquet inventories cannot be read back, use csv or jsonl")
+	}
+	return fmt.Errorf("unsupported inventory format %q, expected one of %v", format, Formats)
+}
+
+// readCSV reads the rows of a CSV inventory, matching the columns to the
+// fields of BlobRecord by their json names.
+func readCSV(r io.Reader, fn func(record BlobRecord) error) error {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading inventory header: %w", err)
+	}
+
+	fields := make(map[string]int)
+	recordType := reflect.TypeOf(BlobRecord{})
+	for i := range recordType.NumField() {
+		name, _, _ := strings.Cut(recordType.Field(i).Tag.Get("json"), ",")
+		fields[name] = i
+	}
+	columns := make([]int, len(header))
+	for i, name := range header {
+		field, ok := fields[name]
+		if !ok {
+			field = -1
+		}
+		columns[i] = field
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading inventory: %w", err)
+		}
+		var record BlobRecord
+		value := reflect.ValueOf(&record).Elem()
+		for i, cell := range row {
+			if i >= len(columns) || columns[i] < 0 || cell == "" {
+				continue
+			}
+			if err := setField(value.Field(columns[i]), cell); err != nil {
+				line, _ := reader.FieldPos(i)
+				return fmt.Errorf("reading inventory line %d, column %s: %w", line, header[i], err)
+			}
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+// setField parses one CSV cell into a field of a record, the reverse of how
+// report writes it.
+func setField(field reflect.Value, cell string) error {
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(cell)
+	case bool:
+		b, err := strconv.ParseBool(cell)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case int64:
+		n, err := strconv.ParseInt(cell, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case *time.Time:
+		t, err := time.Parse(time.RFC3339, cell)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(&t))
+	default:
+		return json.Unmarshal([]byte(cell), field.Addr().Interface())
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package inventory
+
+import (
+	"fmt"
+	"io"
+
+	"gowithazure/src/report"
+)
+
+// Formats are the file formats an inventory can be written in.
+var Formats = []string{"csv", "jsonl", "parquet"}
+
+// Writer writes the records of an inventory one at a time.
+type Writer interface {
+	Write(record any) error
+	// Close finishes the inventory; it does not close the underlying writer.
+	Close() error
+}
+
+// NewWriter returns a Writer producing format on w. prototype is a record of
+// the type that will be written, such as ContainerRecord{}, used to lay out
+// the Parquet schema. Every format names its columns after the json tags of
+// the record.
+func NewWriter(w io.Writer, format string, prototype any) (Writer, error) {
+	switch format {
+	case "csv":
+		return report.NewStream(w, "csv", nil)
+	case "jsonl":
+		return report.NewStream(w, "ndjson", nil)
+	case "parquet":
+		return newParquetWriter(w, prototype)
+	}
+	return nil, fmt.Errorf("unsupported inventory format %q, expected one of %v", format, Formats)
+}
+
+// ResumeWriter returns a Writer appending format to an inventory written by an
+// earlier run. Only the formats that can be appended to, csv and jsonl, can be
+// resumed.
+func ResumeWriter(w io.Writer, format string) (Writer, error) {
+	var stream *report.Stream
+	var err error
+	switch format {
+	case "csv":
+		stream, err = report.NewStream(w, "csv", nil)
+	case "jsonl":
+		stream, err = report.NewStream(w, "ndjson", nil)
+	default:
+		return nil, fmt.Errorf("%s inventories cannot be resumed, use csv or jsonl", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	stream.Resume()
+	return stream, nil
+}
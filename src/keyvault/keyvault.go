@@ -0,0 +1,126 @@
+// Package keyvault reads secrets from Azure Key Vault over its REST API. It
+// backs the keyvault:<vault>/<secret>[/<version>] references of the profiles
+// file.
+package keyvault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// apiVersion is the Key Vault REST API version requested.
+const apiVersion = "7.4"
+
+// scope is the token scope Key Vault accepts.
+const scope = "https://vault.azure.net/.default"
+
+// Resolver resolves keyvault references. It implements config.SecretResolver.
+type Resolver struct {
+	// Credential returns the credential used to reach the vault. It is only
+	// called when a keyvault reference is resolved.
+	Credential func() (azcore.TokenCredential, error)
+	// HTTPClient sends the requests; http.DefaultClient when nil.
+	HTTPClient *http.Client
+	// Endpoint maps a vault to its base URL; VaultURL when nil. Tests point it
+	// at a local fake server.
+	Endpoint func(vault string) string
+}
+
+// VaultURL returns the base URL of a vault. A bare name such as myvault maps
+// to https://myvault.vault.azure.net; anything with a dot or port is taken as
+// the host of a vault in another cloud.
+func VaultURL(vault string) string {
+	if strings.ContainsAny(vault, ".:") {
+		return "https://" + vault
+	}
+	return "https://" + vault + ".vault.azure.net"
+}
+
+// secretBundle is the part of the Get Secret response we use.
+type secretBundle struct {
+	Value string `json:"value"`
+}
+
+// errorResponse is the body Key Vault returns on failure.
+type errorResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Resolve fetches the secret named by ref, which has the form
+// <vault>/<secret> or <vault>/<secret>/<version>.
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	parts := strings.Split(ref, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("expected <vault>/<secret>[/<version>], got %q", ref)
+	}
+	vault, name, version := parts[0], parts[1], ""
+	if len(parts) == 3 {
+		version = parts[2]
+	}
+
+	endpoint := VaultURL
+	if r.Endpoint != nil {
+		endpoint = r.Endpoint
+	}
+	secretURL := strings.TrimRight(endpoint(vault), "/") + "/secrets/" + url.PathEscape(name)
+	if version != "" {
+		secretURL += "/" + url.PathEscape(version)
+	}
+	secretURL += "?api-version=" + apiVersion
+
+	credential, err := r.Credential()
+	if err != nil {
+		return "", err
+	}
+	token, err := credential.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{scope}})
+	if err != nil {
+		return "", fmt.Errorf("getting a Key Vault token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, secretURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	req.Header.Set("Accept", "application/json")
+
+	client := r.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var failure errorResponse
+		if json.Unmarshal(body, &failure) == nil && failure.Error.Code != "" {
+			return "", fmt.Errorf("secret %s in vault %s: %s: %s", name, vault, failure.Error.Code, failure.Error.Message)
+		}
+		return "", fmt.Errorf("secret %s in vault %s: %s", name, vault, resp.Status)
+	}
+
+	var bundle secretBundle
+	if err := json.Unmarshal(body, &bundle); err != nil {
+		return "", fmt.Errorf("decoding secret %s in vault %s: %w", name, vault, err)
+	}
+	return bundle.Value, nil
+}
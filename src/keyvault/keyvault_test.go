@@ -0,0 +1,81 @@
+package keyvault
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// staticCredential hands out a fixed token for the Key Vault scope.
+type staticCredential struct{}
+
+func (staticCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	if len(options.Scopes) != 1 || options.Scopes[0] != scope {
+		return azcore.AccessToken{}, fmt.Errorf("unexpected scopes %v", options.Scopes)
+	}
+	return azcore.AccessToken{Token: "token"}, nil
+}
+
+// fakeVault serves the Get Secret API for the vault myvault: client-secret
+// exists at version v2, denied is forbidden and everything else is missing.
+func fakeVault(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.Header.Get("Authorization") != "Bearer token" || r.URL.Query().Get("api-version") != apiVersion {
+			t.Errorf("unexpected request %s %s, Authorization %q", r.Method, r.URL, r.Header.Get("Authorization"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/secrets/client-secret", "/secrets/client-secret/v2":
+			fmt.Fprint(w, `{"value":"s3cret","id":"https://myvault.vault.azure.net/secrets/client-secret/v2"}`)
+		case "/secrets/denied":
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"error":{"code":"Forbidden","message":"The user does not have secrets get permission"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"code":"SecretNotFound","message":"A secret with the name was not found"}}`)
+		}
+	}))
+}
+
+func TestResolve(t *testing.T) {
+	server := fakeVault(t)
+	defer server.Close()
+
+	resolver := &Resolver{
+		Credential: func() (azcore.TokenCredential, error) { return staticCredential{}, nil },
+		HTTPClient: server.Client(),
+		Endpoint: func(vault string) string {
+			if vault != "myvault" {
+				t.Errorf("vault %q, want myvault", vault)
+			}
+			return server.URL + "/"
+		},
+	}
+
+	tests := []struct {
+		ref, value, err string
+	}{
+		{ref: "myvault/client-secret", value: "s3cret"},
+		{ref: "myvault/client-secret/v2", value: "s3cret"},
+		{ref: "myvault/missing", err: "secret missing in vault myvault: SecretNotFound: A secret with the name was not found"},
+		{ref: "myvault/denied", err: "secret denied in vault myvault: Forbidden: The user does not have secrets get permission"},
+		{ref: "myvault", err: "expected <vault>/<secret>[/<version>]"},
+	}
+	for _, test := range tests {
+		value, err := resolver.Resolve(context.Background(), test.ref)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("Resolve(%q): %v", test.ref, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("Resolve(%q) error %v, want %q", test.ref, err, test.err)
+		case value != test.value:
+			t.Errorf("Resolve(%q) = %q, want %q", test.ref, value, test.value)
+		}
+	}
+}
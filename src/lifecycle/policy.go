@@ -0,0 +1,80 @@
+package lifecycle
+
+// Policy is an Azure storage lifecycle management policy, in the JSON form
+// taken by az storage account management-policy create --policy.
+type Policy struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// PolicyRule is one rule of a Policy.
+type PolicyRule struct {
+	Enabled    bool       `json:"enabled"`
+	Name       string     `json:"name"`
+	Type       string     `json:"type"`
+	Definition Definition `json:"definition"`
+}
+
+// Definition is the filters of a policy rule and the actions it takes on the
+// blobs that pass them.
+type Definition struct {
+	Actions struct {
+		BaseBlob BaseBlobActions `json:"baseBlob"`
+	} `json:"actions"`
+	Filters Filters `json:"filters"`
+}
+
+// BaseBlobActions are the actions a policy rule takes on current blobs, as
+// opposed to their snapshots and previous versions.
+type BaseBlobActions struct {
+	TierToCool    *Condition `json:"tierToCool,omitempty"`
+	TierToCold    *Condition `json:"tierToCold,omitempty"`
+	TierToArchive *Condition `json:"tierToArchive,omitempty"`
+	Delete        *Condition `json:"delete,omitempty"`
+}
+
+// Condition is when an action of a policy rule is due. Exactly one of its
+// fields is set.
+type Condition struct {
+	DaysAfterModificationGreaterThan   *int `json:"daysAfterModificationGreaterThan,omitempty"`
+	DaysAfterLastAccessTimeGreaterThan *int `json:"daysAfterLastAccessTimeGreaterThan,omitempty"`
+}
+
+// Filters select the blobs a policy rule applies to.
+type Filters struct {
+	BlobTypes   []string `json:"blobTypes"`
+	PrefixMatch []string `json:"prefixMatch,omitempty"`
+}
+
+// Policy returns the lifecycle management policy equivalent to the rules.
+func (r *Rules) Policy() Policy {
+	policy := Policy{Rules: make([]PolicyRule, 0, len(r.Rules))}
+	for _, rule := range r.Rules {
+		policyRule := PolicyRule{
+			Enabled: true,
+			Name:    rule.Name,
+			Type:    "Lifecycle",
+		}
+		policyRule.Definition.Filters = Filters{BlobTypes: rule.BlobTypes, PrefixMatch: rule.Prefixes}
+
+		actions := &policyRule.Definition.Actions.BaseBlob
+		for action, condition := range map[string]**Condition{
+			"cool":    &actions.TierToCool,
+			"cold":    &actions.TierToCold,
+			"archive": &actions.TierToArchive,
+			"delete":  &actions.Delete,
+		} {
+			days, ok := rule.Actions[action]
+			if !ok {
+				continue
+			}
+			*condition = &Condition{}
+			if rule.Age == "access" {
+				(*condition).DaysAfterLastAccessTimeGreaterThan = &days
+			} else {
+				(*condition).DaysAfterModificationGreaterThan = &days
+			}
+		}
+		policy.Rules = append(policy.Rules, policyRule)
+	}
+	return policy
+}
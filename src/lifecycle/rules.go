@@ -0,0 +1,185 @@
+// Package lifecycle declares lifecycle management rules for blobs, simulates
+// them offline against a blob inventory, and turns them into the Azure
+// storage lifecycle management policy that applies them on the service side
+// instead of tiering blobs from here.
+package lifecycle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Actions are the actions a rule can take, from the least to the most
+// drastic. When several actions of the rules are due for a blob, the service
+// applies the most drastic one, which is also the cheapest.
+var Actions = []string{"cool", "cold", "archive", "delete"}
+
+// Ages are what the days of a rule are counted from: the last modification
+// of a blob, or its last access when the account tracks it.
+var Ages = []string{"modified", "access"}
+
+// BlobTypes are the types of blobs a rule can apply to. Append blobs can
+// only be deleted.
+var BlobTypes = []string{"blockBlob", "appendBlob"}
+
+// maxPrefixes is the most prefixes a rule of a policy can filter on.
+const maxPrefixes = 10
+
+// Rules is a set of lifecycle rules:
+//
+//	rules:
+//	  - name: videoOutToArchive
+//	    prefixes: [video-out/, video-in/raw/]
+//	    age: modified
+//	    actions: {cool: 30, archive: 180, delete: 2555}
+type Rules struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule applies actions to the blobs under some prefixes once they reach an
+// age in days.
+type Rule struct {
+	Name string `yaml:"name"`
+	// Prefixes are matched against container/blob, as in the prefixMatch of
+	// a policy; a prefix without a slash matches container names. None
+	// matches every blob.
+	Prefixes []string `yaml:"prefixes"`
+	// BlobTypes are the types of blobs the rule applies to, blockBlob when
+	// none are given.
+	BlobTypes []string `yaml:"blobTypes"`
+	// Age is one of Ages, modified when not given.
+	Age string `yaml:"age"`
+	// Actions maps each action of the rule to the number of days after
+	// which it is due.
+	Actions map[string]int `yaml:"actions"`
+}
+
+// LoadRules reads and checks the rules file at path.
+func LoadRules(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no lifecycle rules at %s, copy lifecycle.example.yml there or pass --rules", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rules Rules
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("reading lifecycle rules %s: %w", path, err)
+	}
+	if err := rules.normalize(); err != nil {
+		return nil, fmt.Errorf("lifecycle rules %s: %w", path, err)
+	}
+	return &rules, nil
+}
+
+// normalize checks the rules and fills in their defaults, and spells their
+// actions, ages and blob types the way Actions, Ages and BlobTypes do.
+func (r *Rules) normalize() error {
+	if len(r.Rules) == 0 {
+		return errors.New("no rules")
+	}
+	var problems []string
+	names := make(map[string]bool)
+	for i := range r.Rules {
+		rule := &r.Rules[i]
+		where := fmt.Sprintf("rules[%d]", i)
+		if rule.Name == "" {
+			problems = append(problems, where+" has no name")
+		} else {
+			where = "rule " + rule.Name
+			if names[rule.Name] {
+				problems = append(problems, where+" is defined twice")
+			}
+			names[rule.Name] = true
+		}
+
+		if len(rule.Prefixes) > maxPrefixes {
+			problems = append(problems, fmt.Sprintf("%s has %d prefixes, at most %d are allowed", where, len(rule.Prefixes), maxPrefixes))
+		}
+		for _, prefix := range rule.Prefixes {
+			if prefix == "" || strings.HasPrefix(prefix, "/") {
+				problems = append(problems, fmt.Sprintf("%s has prefix %q, expected container or container/blob-prefix", where, prefix))
+			}
+		}
+
+		if rule.Age == "" {
+			rule.Age = Ages[0]
+		}
+		if age, ok := spell(Ages, rule.Age); ok {
+			rule.Age = age
+		} else {
+			problems = append(problems, fmt.Sprintf("%s has age %q, expected one of %v", where, rule.Age, Ages))
+		}
+
+		if len(rule.BlobTypes) == 0 {
+			rule.BlobTypes = []string{BlobTypes[0]}
+		}
+		for j, blobType := range rule.BlobTypes {
+			if spelled, ok := spell(BlobTypes, blobType); ok {
+				rule.BlobTypes[j] = spelled
+			} else {
+				problems = append(problems, fmt.Sprintf("%s has blob type %q, expected one of %v", where, blobType, BlobTypes))
+			}
+		}
+
+		if len(rule.Actions) == 0 {
+			problems = append(problems, where+" has no actions")
+		}
+		actions := make(map[string]int, len(rule.Actions))
+		for action, days := range rule.Actions {
+			spelled, ok := spell(Actions, action)
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s has action %q, expected one of %v", where, action, Actions))
+				continue
+			}
+			if days < 0 {
+				problems = append(problems, fmt.Sprintf("%s has a negative number of days for %s", where, spelled))
+			}
+			if spelled != "delete" && slices.Contains(rule.BlobTypes, "appendBlob") {
+				problems = append(problems, fmt.Sprintf("%s moves append blobs to %s, they can only be deleted", where, spelled))
+			}
+			actions[spelled] = days
+		}
+		rule.Actions = actions
+
+		// A more drastic action due sooner would leave the other one nothing
+		// to act on.
+		for j, action := range Actions {
+			days, ok := actions[action]
+			if !ok {
+				continue
+			}
+			for _, later := range Actions[j+1:] {
+				if laterDays, ok := actions[later]; ok && laterDays <= days {
+					problems = append(problems, fmt.Sprintf("%s: %s after %d days never applies with %s after %d", where, action, days, later, laterDays))
+				}
+			}
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// spell returns the value of values that matches value in any case.
+func spell(values []string, value string) (string, bool) {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return v, true
+		}
+	}
+	return "", false
+}
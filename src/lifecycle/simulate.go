@@ -0,0 +1,160 @@
+package lifecycle
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"gowithazure/src/inventory"
+)
+
+// tierOrder ranks the access tiers from the hottest down, for telling
+// whether moving a blob to a tier would change anything.
+var tierOrder = []string{"hot", "cool", "cold", "archive"}
+
+// Effect is how many blobs of an inventory a rule takes an action on. Each
+// blob counts once: towards the most drastic action due for it, or towards
+// the first rule that matches it with the action "none" when no action is
+// due or would change it. Blobs no rule matches have no rule.
+type Effect struct {
+	Rule   string `json:"rule"`
+	Action string `json:"action"`
+	Blobs  int64  `json:"blobs"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// Simulator works out what the rules would do to the blobs of an inventory
+// at a given time, the way the service applies a lifecycle policy, without
+// touching any blob. Records are added one at a time so inventories of any
+// size can be simulated.
+type Simulator struct {
+	rules *Rules
+	at    time.Time
+
+	// effects are indexed by rule, then by action with "none" last, and
+	// unmatched counts the blobs no rule matches.
+	effects   [][]Effect
+	unmatched Effect
+	// Skipped counts the records that are not current blobs: snapshots,
+	// previous versions and soft-deleted blobs, which base blob actions
+	// leave alone.
+	Skipped int64
+}
+
+// NewSimulator returns a Simulator of the rules as of at.
+func NewSimulator(rules *Rules, at time.Time) *Simulator {
+	s := &Simulator{rules: rules, at: at, unmatched: Effect{Action: "none"}}
+	s.effects = make([][]Effect, len(rules.Rules))
+	for i, rule := range rules.Rules {
+		for _, action := range append(slices.Clone(Actions), "none") {
+			if _, ok := rule.Actions[action]; ok || action == "none" {
+				s.effects[i] = append(s.effects[i], Effect{Rule: rule.Name, Action: action})
+			}
+		}
+	}
+	return s
+}
+
+// Add counts one record of the inventory.
+func (s *Simulator) Add(record inventory.BlobRecord) {
+	if record.Snapshot != "" || record.Deleted || (record.VersionID != "" && !record.IsCurrentVersion) {
+		s.Skipped++
+		return
+	}
+
+	matched, best, bestAction := -1, -1, -1
+	for i, rule := range s.rules.Rules {
+		if !rule.matches(record) {
+			continue
+		}
+		if matched < 0 {
+			matched = i
+		}
+		since := age(record, rule.Age)
+		if since.IsZero() {
+			continue
+		}
+		days := int(s.at.Sub(since) / (24 * time.Hour))
+		for action := len(Actions) - 1; action > bestAction; action-- {
+			threshold, ok := rule.Actions[Actions[action]]
+			if ok && days > threshold && changes(record, Actions[action]) {
+				best, bestAction = i, action
+				break
+			}
+		}
+	}
+
+	effect := &s.unmatched
+	switch {
+	case best >= 0:
+		for j := range s.effects[best] {
+			if s.effects[best][j].Action == Actions[bestAction] {
+				effect = &s.effects[best][j]
+			}
+		}
+	case matched >= 0:
+		effect = &s.effects[matched][len(s.effects[matched])-1]
+	}
+	effect.Blobs++
+	effect.Bytes += record.Size
+}
+
+// Effects returns the effect of every action of every rule, in the order of
+// the rules and Actions, followed by the blobs no rule matches.
+func (s *Simulator) Effects() []Effect {
+	var effects []Effect
+	for _, ruleEffects := range s.effects {
+		effects = append(effects, ruleEffects...)
+	}
+	return append(effects, s.unmatched)
+}
+
+// matches reports whether the rule's filters select the blob.
+func (r *Rule) matches(record inventory.BlobRecord) bool {
+	typeMatches := false
+	for _, blobType := range r.BlobTypes {
+		if strings.EqualFold(blobType, record.BlobType) {
+			typeMatches = true
+		}
+	}
+	if !typeMatches {
+		return false
+	}
+	if len(r.Prefixes) == 0 {
+		return true
+	}
+	name := record.Container + "/" + record.Name
+	for _, prefix := range r.Prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// age returns the time the days of a rule are counted from, or the zero time
+// when the inventory does not say. A blob without a last access time, because
+// the account did not track it yet, counts from its last modification.
+func age(record inventory.BlobRecord, basis string) time.Time {
+	if basis == "access" && record.LastAccessTime != nil {
+		return *record.LastAccessTime
+	}
+	if record.LastModified != nil {
+		return *record.LastModified
+	}
+	return time.Time{}
+}
+
+// changes reports whether taking action on the blob would change it: a blob
+// is only moved to a cooler tier than its own, and not while it is being
+// rehydrated.
+func changes(record inventory.BlobRecord, action string) bool {
+	if action == "delete" {
+		return true
+	}
+	if record.ArchiveStatus != "" {
+		return false
+	}
+	current := slices.Index(tierOrder, strings.ToLower(record.AccessTier))
+	return current >= 0 && current < slices.Index(tierOrder, action)
+}
@@ -0,0 +1,344 @@
+// Package recovery lists the soft-deleted containers and blobs of storage
+// accounts and restores them while their retention lasts: a container by
+// restoring its deleted version, a blob by undeleting it.
+package recovery
+
+import (
+	"context"
+	"errors"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gowithazure/src/config"
+	"gowithazure/src/scanner"
+	"gowithazure/src/storage"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+)
+
+// The statuses of a restored Item. A listed Item, or one that a dry run
+// would restore, has none.
+const (
+	Restored = "restored"
+	Skipped  = "skipped"
+	Failed   = "failed"
+)
+
+// Item is a soft-deleted container, or a soft-deleted blob of a live
+// container.
+type Item struct {
+	Account   string `json:"account"`
+	Container string `json:"container"`
+	// Blob is the name of a deleted blob, "" for a deleted container.
+	Blob string `json:"blob,omitempty"`
+	// Version identifies a deleted container among the deleted containers of
+	// the same name; restoring it needs it.
+	Version       string     `json:"version,omitempty"`
+	DeletedTime   *time.Time `json:"deletedTime,omitempty"`
+	RemainingDays int        `json:"remainingDays"`
+	Bytes         int64      `json:"bytes,omitempty"`
+	Status        string     `json:"status,omitempty"`
+	// Reason says why the item was skipped, Error why it failed.
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Options selects the deleted items.
+type Options struct {
+	// Containers are path.Match patterns of the container names to include;
+	// none includes every container. They select the deleted containers and
+	// the live containers whose deleted blobs are included.
+	Containers []string
+	// Blobs includes the deleted blobs of live containers, which takes
+	// walking every blob. Prefix limits them to those whose name starts with
+	// it, and Pattern to those whose name matches it as a path.Match pattern.
+	Blobs   bool
+	Prefix  string
+	Pattern string
+	// Within limits the items to those deleted less than that long ago; 0
+	// includes them all.
+	Within time.Duration
+	// Names, when set, selects these items only instead of the filters
+	// above: "container" for a deleted container, "container/blob" for a
+	// deleted blob. Blobs must be set to select blobs.
+	Names []string
+	// DryRun selects the items Restore would restore without restoring them.
+	DryRun bool
+}
+
+// container reports whether the deleted container name is selected.
+func (o Options) container(name string) bool {
+	if o.Names != nil {
+		return slices.Contains(o.Names, name)
+	}
+	return storage.MatchAny(o.Containers, name)
+}
+
+// walk reports whether the deleted blobs of the live container name may be
+// selected.
+func (o Options) walk(name string) bool {
+	if o.Names != nil {
+		return slices.ContainsFunc(o.Names, func(n string) bool { return strings.HasPrefix(n, name+"/") })
+	}
+	return storage.MatchAny(o.Containers, name)
+}
+
+// blob reports whether the deleted blob name of containerName is selected.
+func (o Options) blob(containerName, name string) bool {
+	if o.Names != nil {
+		return slices.Contains(o.Names, containerName+"/"+name)
+	}
+	if o.Pattern != "" {
+		ok, _ := path.Match(o.Pattern, name)
+		return ok
+	}
+	return true
+}
+
+// List walks the storage accounts and calls fn with every deleted item
+// selected by options, never concurrently. The deleted blobs of a deleted
+// container cannot be listed until the container is restored.
+func List(ctx context.Context, scan *scanner.Scanner, accounts []config.Account, options Options, fn func(Item)) error {
+	listing := listingOptions(scan, options)
+	var mu sync.Mutex
+	report := func(item Item) {
+		mu.Lock()
+		defer mu.Unlock()
+		fn(item)
+	}
+
+	callbacks := scanner.Callbacks{
+		Container: func(_ context.Context, account *scanner.Account, item *service.ContainerItem) error {
+			if item.Deleted != nil && *item.Deleted {
+				if deleted, ok := deletedContainer(account, item, options); ok {
+					report(deleted)
+				}
+				return scanner.SkipContainer
+			}
+			if !options.walk(*item.Name) {
+				return scanner.SkipContainer
+			}
+			return nil
+		},
+	}
+	if options.Blobs {
+		callbacks.Blob = func(_ context.Context, account *scanner.Account, containerName string, item *container.BlobItem) error {
+			if deleted, ok := deletedBlob(account, containerName, item, options); ok {
+				report(deleted)
+			}
+			return nil
+		}
+	}
+	return listing.Scan(ctx, accounts, callbacks)
+}
+
+// Restore walks the storage accounts and restores every deleted item
+// selected by options, calling fn with each one as List does, with its
+// status. Containers are restored first, so the deleted blobs of a restored
+// container are restored with the others. When a name was deleted more than
+// once, the latest deletion is restored and the earlier ones are skipped; a
+// deleted container whose name is taken by a live container is skipped too.
+func Restore(ctx context.Context, scan *scanner.Scanner, accounts []config.Account, options Options, fn func(Item)) error {
+	listing := listingOptions(scan, options)
+	var mu sync.Mutex
+	report := func(item Item) {
+		mu.Lock()
+		defer mu.Unlock()
+		fn(item)
+	}
+
+	// The deleted containers are collected first, to restore the latest
+	// deletion of each name.
+	type key struct {
+		account   int
+		container string
+	}
+	type candidate struct {
+		item   Item
+		client *azblob.Client
+	}
+	var (
+		candidates = make(map[key][]candidate)
+		live       = make(map[key]bool)
+	)
+	containersErr := listing.Scan(ctx, accounts, scanner.Callbacks{
+		Container: func(_ context.Context, account *scanner.Account, item *service.ContainerItem) error {
+			mu.Lock()
+			defer mu.Unlock()
+			k := key{account.Index, *item.Name}
+			if item.Deleted == nil || !*item.Deleted {
+				live[k] = true
+			} else if deleted, ok := deletedContainer(account, item, options); ok {
+				candidates[k] = append(candidates[k], candidate{deleted, account.Client})
+			}
+			return scanner.SkipContainer
+		},
+	})
+
+	keys := make([]key, 0, len(candidates))
+	for k := range candidates {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].account != keys[j].account {
+			return keys[i].account < keys[j].account
+		}
+		return keys[i].container < keys[j].container
+	})
+	var restores []candidate
+	for _, k := range keys {
+		versions := candidates[k]
+		sort.SliceStable(versions, func(i, j int) bool {
+			return deletedAfter(versions[i].item, versions[j].item)
+		})
+		for i, c := range versions {
+			switch {
+			case live[k]:
+				c.item.Status, c.item.Reason = Skipped, "a live container has this name"
+				report(c.item)
+			case i > 0:
+				c.item.Status, c.item.Reason = Skipped, "deleted again later, the latest deletion is restored"
+				report(c.item)
+			default:
+				restores = append(restores, c)
+			}
+		}
+	}
+
+	workers := scan.Workers
+	if workers <= 0 {
+		workers = scan.Concurrency
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				c := restores[i]
+				if !options.DryRun {
+					_, err := c.client.ServiceClient().RestoreContainer(ctx, c.item.Container, c.item.Version, nil)
+					setStatus(&c.item, err)
+				}
+				report(c.item)
+			}
+		}()
+	}
+	for i := range restores {
+		if ctx.Err() != nil {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if !options.Blobs || ctx.Err() != nil {
+		return errors.Join(containersErr, ctx.Err())
+	}
+
+	blobsErr := listing.Scan(ctx, accounts, scanner.Callbacks{
+		Container: func(_ context.Context, _ *scanner.Account, item *service.ContainerItem) error {
+			if (item.Deleted != nil && *item.Deleted) || !options.walk(*item.Name) {
+				return scanner.SkipContainer
+			}
+			return nil
+		},
+		Blob: func(ctx context.Context, account *scanner.Account, containerName string, item *container.BlobItem) error {
+			deleted, ok := deletedBlob(account, containerName, item, options)
+			if !ok {
+				return nil
+			}
+			if !options.DryRun {
+				_, err := account.Client.ServiceClient().NewContainerClient(containerName).NewBlobClient(deleted.Blob).Undelete(ctx, nil)
+				setStatus(&deleted, err)
+			}
+			report(deleted)
+			return nil
+		},
+	})
+	return errors.Join(containersErr, blobsErr)
+}
+
+// listingOptions returns a copy of scan that lists deleted containers and,
+// when options include them, deleted blobs.
+func listingOptions(scan *scanner.Scanner, options Options) scanner.Scanner {
+	listing := *scan
+	listing.ListContainers = &azblob.ListContainersOptions{Include: azblob.ListContainersInclude{Deleted: true}}
+	listing.ListBlobs = &azblob.ListBlobsFlatOptions{Include: azblob.ListBlobsInclude{Deleted: true}}
+	if options.Prefix != "" {
+		listing.ListBlobs.Prefix = &options.Prefix
+	}
+	return listing
+}
+
+// deletedContainer returns the Item of a deleted container, and whether it
+// is selected by options.
+func deletedContainer(account *scanner.Account, item *service.ContainerItem, options Options) (Item, bool) {
+	if !options.container(*item.Name) {
+		return Item{}, false
+	}
+	deleted := Item{Account: account.URL, Container: *item.Name}
+	if item.Version != nil {
+		deleted.Version = *item.Version
+	}
+	if props := item.Properties; props != nil {
+		deleted.DeletedTime = props.DeletedTime
+		if props.RemainingRetentionDays != nil {
+			deleted.RemainingDays = int(*props.RemainingRetentionDays)
+		}
+	}
+	return deleted, within(deleted.DeletedTime, options.Within)
+}
+
+// deletedBlob returns the Item of a blob, and whether it is a deleted blob
+// selected by options.
+func deletedBlob(account *scanner.Account, containerName string, item *container.BlobItem, options Options) (Item, bool) {
+	if item.Deleted == nil || !*item.Deleted || item.Snapshot != nil || !options.blob(containerName, *item.Name) {
+		return Item{}, false
+	}
+	deleted := Item{Account: account.URL, Container: containerName, Blob: *item.Name}
+	if props := item.Properties; props != nil {
+		deleted.DeletedTime = props.DeletedTime
+		if props.RemainingRetentionDays != nil {
+			deleted.RemainingDays = int(*props.RemainingRetentionDays)
+		}
+		if props.ContentLength != nil {
+			deleted.Bytes = *props.ContentLength
+		}
+	}
+	return deleted, within(deleted.DeletedTime, options.Within)
+}
+
+// within reports whether an item deleted at deletedTime was deleted less than
+// d ago. Items without a deletion time only pass when d is 0.
+func within(deletedTime *time.Time, d time.Duration) bool {
+	if d == 0 {
+		return true
+	}
+	return deletedTime != nil && time.Since(*deletedTime) < d
+}
+
+// deletedAfter reports whether a was deleted after b.
+func deletedAfter(a, b Item) bool {
+	if a.DeletedTime == nil || b.DeletedTime == nil {
+		return a.DeletedTime != nil
+	}
+	return a.DeletedTime.After(*b.DeletedTime)
+}
+
+// setStatus records the outcome of restoring item.
+func setStatus(item *Item, err error) {
+	if err != nil {
+		item.Status, item.Error = Failed, config.Redact(err.Error())
+		return
+	}
+	item.Status = Restored
+}
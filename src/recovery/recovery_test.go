@@ -0,0 +1,256 @@
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gowithazure/src/config"
+	"gowithazure/src/scanner"
+	"gowithazure/src/storage"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+)
+
+// fakeContainer is a live container of the fake storage account, or a
+// deleted one when version is set.
+type fakeContainer struct {
+	name    string
+	version string
+	deleted time.Time
+	// blobs are the blobs of a live container, by name, and whether they are
+	// deleted.
+	blobs map[string]bool
+}
+
+// fakeAccount is a storage account with soft delete, answering listings
+// that include deleted items, container restores and blob undeletes.
+type fakeAccount struct {
+	t *testing.T
+
+	mu         sync.Mutex
+	containers []*fakeContainer
+	// restored are the restored containers as name@version, undeleted the
+	// undeleted blobs as container/blob.
+	restored  []string
+	undeleted []string
+}
+
+func (f *fakeAccount) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	query := r.URL.Query()
+	containerName, blobName, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/devstoreaccount1/"), "/")
+	switch {
+	case r.URL.Path == "/devstoreaccount1" && query.Get("comp") == "list":
+		if !strings.Contains(query.Get("include"), "deleted") {
+			f.t.Errorf("listing containers without the deleted ones: %s", r.URL)
+		}
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Containers>`)
+		for _, c := range f.containers {
+			if c.version == "" {
+				fmt.Fprintf(w, `<Container><Name>%s</Name><Properties><Last-Modified>%s</Last-Modified><Etag>e</Etag></Properties></Container>`,
+					c.name, c.deleted.Format(http.TimeFormat))
+				continue
+			}
+			fmt.Fprintf(w, `<Container><Name>%s</Name><Deleted>true</Deleted><Version>%s</Version><Properties>`+
+				`<Last-Modified>%s</Last-Modified><Etag>e</Etag><DeletedTime>%s</DeletedTime><RemainingRetentionDays>5</RemainingRetentionDays>`+
+				`</Properties></Container>`, c.name, c.version, c.deleted.Format(http.TimeFormat), c.deleted.Format(http.TimeFormat))
+		}
+		fmt.Fprint(w, `</Containers><NextMarker/></EnumerationResults>`)
+	case r.Method == http.MethodGet && query.Get("comp") == "list":
+		c := f.live(containerName)
+		if c == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		names := make([]string, 0, len(c.blobs))
+		for name := range c.blobs {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Blobs>`)
+		for _, name := range names {
+			fmt.Fprintf(w, `<Blob><Name>%s</Name><Deleted>%t</Deleted><Properties><Last-Modified>%s</Last-Modified><Etag>0x1</Etag>`+
+				`<Content-Length>100</Content-Length><BlobType>BlockBlob</BlobType><DeletedTime>%s</DeletedTime>`+
+				`<RemainingRetentionDays>3</RemainingRetentionDays></Properties></Blob>`,
+				name, c.blobs[name], c.deleted.Format(http.TimeFormat), c.deleted.Format(http.TimeFormat))
+		}
+		fmt.Fprint(w, `</Blobs><NextMarker/></EnumerationResults>`)
+	case r.Method == http.MethodPut && query.Get("comp") == "undelete" && blobName == "":
+		name, version := r.Header.Get("x-ms-deleted-container-name"), r.Header.Get("x-ms-deleted-container-version")
+		for _, c := range f.containers {
+			if c.name == name && c.version == version {
+				c.version = ""
+				f.restored = append(f.restored, name+"@"+version)
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+		}
+		f.t.Errorf("restoring %s@%s, which is not deleted", name, version)
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodPut && query.Get("comp") == "undelete":
+		c := f.live(containerName)
+		if c == nil || !c.blobs[blobName] {
+			f.t.Errorf("undeleting %s/%s, which is not deleted", containerName, blobName)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		c.blobs[blobName] = false
+		f.undeleted = append(f.undeleted, containerName+"/"+blobName)
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// live returns the live container name, nil if there is none.
+func (f *fakeAccount) live(name string) *fakeContainer {
+	for _, c := range f.containers {
+		if c.name == name && c.version == "" {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestRestore(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	containers := func() []*fakeContainer {
+		return []*fakeContainer{
+			// job1-in was deleted twice, job2-in deleted and created again.
+			{name: "job1-in", version: "v1", deleted: now.Add(-48 * time.Hour)},
+			{name: "job1-in", version: "v2", deleted: now.Add(-time.Hour)},
+			{name: "job2-in", version: "v3", deleted: now.Add(-time.Hour)},
+			{name: "job2-in", deleted: now, blobs: map[string]bool{"a.mp4": true, "b.mp4": false}},
+			// job3-out holds a deleted blob and is only reached once restored.
+			{name: "job3-out", version: "v4", deleted: now.Add(-time.Hour), blobs: map[string]bool{"c.mp4": true}},
+		}
+	}
+
+	const (
+		earlier = Skipped + ": deleted again later, the latest deletion is restored"
+		taken   = Skipped + ": a live container has this name"
+	)
+	tests := []struct {
+		name    string
+		options Options
+		// items are the reported items as name@version and their status,
+		// with the reason of those skipped.
+		items     map[string]string
+		restored  []string
+		undeleted []string
+	}{
+		{
+			name:    "latest deletion",
+			options: Options{},
+			items: map[string]string{
+				"job1-in@v1":  earlier,
+				"job1-in@v2":  Restored,
+				"job2-in@v3":  taken,
+				"job3-out@v4": Restored,
+			},
+			restored: []string{"job1-in@v2", "job3-out@v4"},
+		},
+		{
+			name:    "blobs of restored containers",
+			options: Options{Containers: []string{"job2-*", "job3-*"}, Blobs: true},
+			items: map[string]string{
+				"job2-in@v3":      taken,
+				"job3-out@v4":     Restored,
+				"job2-in/a.mp4@":  Restored,
+				"job3-out/c.mp4@": Restored,
+			},
+			restored:  []string{"job3-out@v4"},
+			undeleted: []string{"job2-in/a.mp4", "job3-out/c.mp4"},
+		},
+		{
+			name:    "names",
+			options: Options{Names: []string{"job1-in", "job2-in/a.mp4", "job2-in/b.mp4"}, Blobs: true},
+			items: map[string]string{
+				"job1-in@v1":     earlier,
+				"job1-in@v2":     Restored,
+				"job2-in/a.mp4@": Restored,
+			},
+			restored:  []string{"job1-in@v2"},
+			undeleted: []string{"job2-in/a.mp4"},
+		},
+		{
+			name:    "dry run",
+			options: Options{Blobs: true, DryRun: true},
+			items: map[string]string{
+				"job1-in@v1":     earlier,
+				"job1-in@v2":     "",
+				"job2-in@v3":     taken,
+				"job3-out@v4":    "",
+				"job2-in/a.mp4@": "",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := &fakeAccount{t: t, containers: containers()}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+			account := config.Account{URL: server.URL + "/devstoreaccount1", AccountKey: "c2VjcmV0a2V5"}
+			scan := scanner.New(2, func(account config.Account) (*azblob.Client, error) { return storage.NewClient(account, nil) })
+
+			items := make(map[string]string)
+			err := Restore(context.Background(), scan, []config.Account{account}, test.options, func(item Item) {
+				name := item.Container
+				if item.Blob != "" {
+					name += "/" + item.Blob
+				}
+				name += "@" + item.Version
+				if _, ok := items[name]; ok {
+					t.Errorf("%s reported twice", name)
+				}
+				if item.Error != "" {
+					t.Errorf("%s: %s", name, item.Error)
+				}
+				items[name] = item.Status
+				if item.Reason != "" {
+					items[name] += ": " + item.Reason
+				}
+			})
+			if err != nil {
+				t.Fatalf("Restore: %v", err)
+			}
+
+			if len(items) != len(test.items) {
+				t.Errorf("reported %v, want %v", items, test.items)
+			}
+			for name, status := range test.items {
+				if got, ok := items[name]; !ok || got != status {
+					t.Errorf("%s: status %q (reported %t), want %q", name, got, ok, status)
+				}
+			}
+			slices.Sort(fake.restored)
+			slices.Sort(fake.undeleted)
+			if !slices.Equal(fake.restored, test.restored) {
+				t.Errorf("restored %v, want %v", fake.restored, test.restored)
+			}
+			if !slices.Equal(fake.undeleted, test.undeleted) {
+				t.Errorf("undeleted %v, want %v", fake.undeleted, test.undeleted)
+			}
+		})
+	}
+}
+
+func TestDeletedAfter(t *testing.T) {
+	earlier, later := Item{Container: "a"}, Item{Container: "a"}
+	t1, t2 := time.Now().Add(-time.Hour), time.Now()
+	earlier.DeletedTime, later.DeletedTime = &t1, &t2
+	if !deletedAfter(later, earlier) || deletedAfter(earlier, later) {
+		t.Error("deletedAfter does not order by deletion time")
+	}
+	if !deletedAfter(earlier, Item{}) || deletedAfter(Item{}, earlier) {
+		t.Error("deletedAfter does not put items without a deletion time last")
+	}
+}
@@ -0,0 +1,323 @@
+package rehydrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"gowithazure/src/config"
+	"gowithazure/src/scanner"
+	"gowithazure/src/storage"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+)
+
+// Tiers are the access tiers archived blobs can be rehydrated to.
+var Tiers = []string{string(blob.AccessTierHot), string(blob.AccessTierCool)}
+
+// Priorities are the rehydration priorities: High is faster and dearer.
+var Priorities = []string{string(blob.RehydratePriorityStandard), string(blob.RehydratePriorityHigh)}
+
+// Options selects the archived blobs to rehydrate and how.
+type Options struct {
+	// Containers are path.Match patterns of the container names to include;
+	// none includes every container.
+	Containers []string
+	// Prefix limits the blobs to those whose name starts with it, and
+	// Pattern to those whose name matches it as a path.Match pattern.
+	Prefix  string
+	Pattern string
+	// Tier is the tier the blobs come back to, at Priority.
+	Tier     string
+	Priority string
+	// CopyTo, when set, rehydrates each blob to a copy of the same name in
+	// that container of its account and leaves the original archived.
+	CopyTo string
+	// DryRun records the blobs that would be rehydrated without asking for
+	// their rehydration.
+	DryRun bool
+	// State, when set, holds the rehydrations requested before: blobs still
+	// pending in it are reported as Skipped instead of being requested again,
+	// which would start a second copy with CopyTo.
+	State *State
+}
+
+// pending reports whether options.State has the blob pending.
+func (o Options) pending(account, containerName, name string) bool {
+	return o.State != nil && o.State.IsPending(account, containerName, name)
+}
+
+// Item is a blob named in a list of blobs to rehydrate. Account is its
+// position in the accounts given to StartList.
+type Item struct {
+	Account   int
+	Container string
+	Name      string
+}
+
+// Start walks the storage accounts and requests the rehydration of every
+// archived blob selected by options that is not being rehydrated yet. fn is
+// called with the record of every blob, never concurrently: Pending once
+// requested, Failed when the request failed, Skipped when options.State has
+// it pending already.
+func Start(ctx context.Context, scan *scanner.Scanner, accounts []config.Account, options Options, fn func(Blob)) error {
+	listing := *scan
+	listing.ListContainers = &azblob.ListContainersOptions{}
+	listing.ListBlobs = &azblob.ListBlobsFlatOptions{}
+	if options.Prefix != "" {
+		listing.ListBlobs.Prefix = &options.Prefix
+	}
+
+	var mu sync.Mutex
+	return listing.Scan(ctx, accounts, scanner.Callbacks{
+		Container: func(_ context.Context, _ *scanner.Account, item *service.ContainerItem) error {
+			if !storage.MatchAny(options.Containers, *item.Name) || *item.Name == options.CopyTo {
+				return scanner.SkipContainer
+			}
+			return nil
+		},
+		Blob: func(ctx context.Context, account *scanner.Account, containerName string, item *container.BlobItem) error {
+			props := item.Properties
+			if props == nil || props.AccessTier == nil || *props.AccessTier != blob.AccessTierArchive || props.ArchiveStatus != nil {
+				return nil
+			}
+			if options.Pattern != "" {
+				if ok, _ := path.Match(options.Pattern, *item.Name); !ok {
+					return nil
+				}
+			}
+
+			record := newRecord(account.URL, containerName, *item.Name, options)
+			if props.ContentLength != nil {
+				record.Bytes = *props.ContentLength
+			}
+			if options.pending(record.Account, containerName, record.Name) {
+				record.Status = Skipped
+			} else if !options.DryRun {
+				if err := request(ctx, account.Client, &record); err != nil {
+					record.Status, record.Error = Failed, config.Redact(err.Error())
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			fn(record)
+			return nil
+		},
+	})
+}
+
+// StartList requests the rehydration of the listed blobs of the storage
+// accounts. A listed blob that is already being rehydrated is recorded as
+// Pending without a new request, and one that is not archived as Failed. fn
+// is called as for Start.
+func StartList(ctx context.Context, scan *scanner.Scanner, accounts []config.Account, items []Item, options Options, fn func(Blob)) error {
+	clients, errs := connect(scan, accounts)
+	var mu sync.Mutex
+	each(ctx, len(items), scan.Concurrency, func(i int) {
+		item := items[i]
+		account := accounts[item.Account]
+		record := newRecord(account.String(), item.Container, item.Name, options)
+		client := clients[item.Account]
+		if options.pending(record.Account, record.Container, record.Name) {
+			record.Status = Skipped
+		} else if client == nil {
+			record.Status, record.Error = Failed, "connecting: "+config.Redact(errs[item.Account].Error())
+		} else if err := requestListed(ctx, client, &record, options.DryRun); err != nil {
+			record.Status, record.Error = Failed, config.Redact(err.Error())
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		fn(record)
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return accountErrors(accounts, errs)
+}
+
+// Check asks the service how far each of the blobs has come and updates
+// them: a blob whose tier is no longer Archive is Online, one whose copy or
+// rehydration stopped is Failed. Blobs of accounts that are not given are
+// left alone. A blob that could not be checked, including every blob of an
+// account that could not be connected to, keeps its status and has the error
+// recorded; the other accounts are checked all the same and the failures are
+// returned.
+func Check(ctx context.Context, scan *scanner.Scanner, accounts []config.Account, blobs []*Blob) error {
+	byURL := make(map[string]int, len(accounts))
+	for i, account := range accounts {
+		byURL[account.String()] = i
+	}
+	clients, errs := connect(scan, accounts)
+
+	each(ctx, len(blobs), scan.Concurrency, func(i int) {
+		b := blobs[i]
+		index, ok := byURL[b.Account]
+		if !ok {
+			return
+		}
+		if clients[index] == nil {
+			b.Checked, b.Error = time.Now().UTC(), "connecting: "+config.Redact(errs[index].Error())
+			return
+		}
+		check(ctx, clients[index], b)
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return accountErrors(accounts, errs)
+}
+
+// newRecord returns the record of a blob about to be rehydrated.
+func newRecord(account, containerName, name string, options Options) Blob {
+	return Blob{
+		Account:       account,
+		Container:     containerName,
+		Name:          name,
+		CopyContainer: options.CopyTo,
+		Tier:          options.Tier,
+		Priority:      options.Priority,
+		Requested:     time.Now().UTC(),
+		Status:        Pending,
+	}
+}
+
+// request asks for the rehydration of the blob: a tier change with priority,
+// or a copy to the archived blob's new, online twin.
+func request(ctx context.Context, client *azblob.Client, b *Blob) error {
+	tier, priority := blob.AccessTier(b.Tier), blob.RehydratePriority(b.Priority)
+	source := client.ServiceClient().NewContainerClient(b.Container).NewBlobClient(b.Name)
+	if b.CopyContainer == "" {
+		_, err := source.SetTier(ctx, tier, &blob.SetTierOptions{RehydratePriority: &priority})
+		return err
+	}
+	copied := client.ServiceClient().NewContainerClient(b.CopyContainer).NewBlobClient(b.Name)
+	_, err := copied.StartCopyFromURL(ctx, source.URL(), &blob.StartCopyFromURLOptions{Tier: &tier, RehydratePriority: &priority})
+	return err
+}
+
+// requestListed checks that a listed blob is archived before asking for its
+// rehydration.
+func requestListed(ctx context.Context, client *azblob.Client, b *Blob, dryRun bool) error {
+	props, err := client.ServiceClient().NewContainerClient(b.Container).NewBlobClient(b.Name).GetProperties(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if props.ContentLength != nil {
+		b.Bytes = *props.ContentLength
+	}
+	if props.ArchiveStatus != nil && b.CopyContainer == "" {
+		b.ArchiveStatus = *props.ArchiveStatus
+		return nil
+	}
+	if props.AccessTier == nil || *props.AccessTier != string(blob.AccessTierArchive) {
+		tier := "no"
+		if props.AccessTier != nil {
+			tier = "the " + *props.AccessTier
+		}
+		return fmt.Errorf("not archived, in %s tier", tier)
+	}
+	if dryRun {
+		return nil
+	}
+	return request(ctx, client, b)
+}
+
+// check updates the status of one blob from its properties.
+func check(ctx context.Context, client *azblob.Client, b *Blob) {
+	containerName, name := b.Target()
+	props, err := client.ServiceClient().NewContainerClient(containerName).NewBlobClient(name).GetProperties(ctx, nil)
+	now := time.Now().UTC()
+	b.Checked = now
+	if err != nil {
+		var respErr *azcore.ResponseError
+		if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+			b.Status = Failed
+		}
+		b.Error = config.Redact(err.Error())
+		return
+	}
+	b.Error = ""
+
+	if b.CopyContainer != "" && props.CopyStatus != nil {
+		switch *props.CopyStatus {
+		case blob.CopyStatusTypeFailed, blob.CopyStatusTypeAborted:
+			b.Status, b.Error = Failed, "copy "+string(*props.CopyStatus)
+			if props.CopyStatusDescription != nil {
+				b.Error += ": " + *props.CopyStatusDescription
+			}
+			return
+		case blob.CopyStatusTypePending:
+			if props.ArchiveStatus != nil {
+				b.ArchiveStatus = *props.ArchiveStatus
+			}
+			return
+		}
+	}
+
+	b.ArchiveStatus = ""
+	switch {
+	case props.ArchiveStatus != nil:
+		b.ArchiveStatus = *props.ArchiveStatus
+	case props.AccessTier != nil && *props.AccessTier == string(blob.AccessTierArchive):
+		b.Status, b.Error = Failed, "still archived and no longer being rehydrated"
+	default:
+		b.Status, b.Online = Online, now
+	}
+}
+
+// connect creates the client of every account, leaving nil those that
+// failed and their failure at the same index of errs.
+func connect(scan *scanner.Scanner, accounts []config.Account) (clients []*azblob.Client, errs []error) {
+	clients = make([]*azblob.Client, len(accounts))
+	errs = make([]error, len(accounts))
+	for i, account := range accounts {
+		clients[i], errs[i] = scan.Connect(account)
+	}
+	return clients, errs
+}
+
+// accountErrors joins the failures in errs, naming their accounts, or
+// returns nil when there are none.
+func accountErrors(accounts []config.Account, errs []error) error {
+	var failed []error
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", accounts[i], err))
+		}
+	}
+	return errors.Join(failed...)
+}
+
+// each calls fn for every index below n on up to workers goroutines, and
+// stops starting new calls once ctx is done.
+func each(ctx context.Context, n, workers int, fn func(i int)) {
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := range n {
+		if ctx.Err() != nil {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
@@ -0,0 +1,163 @@
+package rehydrate
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gowithazure/src/config"
+	"gowithazure/src/scanner"
+	"gowithazure/src/storage"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+)
+
+// blobProperties are the properties the fake account reports for each blob,
+// by name; a blob that is not listed is missing.
+var blobProperties = map[string]map[string]string{
+	"online":       {"x-ms-access-tier": "Hot"},
+	"rehydrating":  {"x-ms-access-tier": "Archive", "x-ms-archive-status": "rehydrate-pending-to-hot"},
+	"stuck":        {"x-ms-access-tier": "Archive"},
+	"copy-pending": {"x-ms-access-tier": "Cool", "x-ms-copy-status": "pending", "x-ms-archive-status": "rehydrate-pending-to-cool"},
+	"copy-failed":  {"x-ms-access-tier": "Cool", "x-ms-copy-status": "failed", "x-ms-copy-status-description": "500 InternalError"},
+	"copy-done":    {"x-ms-access-tier": "Cool", "x-ms-copy-status": "success"},
+}
+
+// fakeAccount answers Get Blob Properties with blobProperties.
+func fakeAccount(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/devstoreaccount1/"), "/")
+		if r.Method != http.MethodHead {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		props, ok := blobProperties[name]
+		if !ok {
+			w.Header().Set("x-ms-error-code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for key, value := range props {
+			w.Header().Set(key, value)
+		}
+	}))
+}
+
+func TestCheck(t *testing.T) {
+	server := fakeAccount(t)
+	defer server.Close()
+	reachable := config.Account{URL: server.URL + "/devstoreaccount1", AccountKey: "c2VjcmV0a2V5"}
+	unreachable := config.Account{URL: "https://unreachable.blob.core.windows.net/"}
+	scan := scanner.New(2, func(account config.Account) (*azblob.Client, error) {
+		if account.URL == unreachable.URL {
+			return nil, errors.New("no credential for the account")
+		}
+		return storage.NewClient(account, nil)
+	})
+
+	tests := []struct {
+		account, name, copyTo string
+		status, archiveStatus string
+		err                   string
+	}{
+		{name: "online", status: Online},
+		{name: "rehydrating", status: Pending, archiveStatus: "rehydrate-pending-to-hot"},
+		{name: "stuck", status: Failed, err: "still archived and no longer being rehydrated"},
+		{name: "missing", status: Failed, err: "BlobNotFound"},
+		{name: "copy-pending", copyTo: "restored", status: Pending, archiveStatus: "rehydrate-pending-to-cool"},
+		{name: "copy-failed", copyTo: "restored", status: Failed, err: "copy failed: 500 InternalError"},
+		{name: "copy-done", copyTo: "restored", status: Online},
+		{account: unreachable.URL, name: "online", status: Pending, err: "connecting: no credential for the account"},
+	}
+	state, err := Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	requested := time.Now().UTC().Add(-time.Hour)
+	for _, test := range tests {
+		account := test.account
+		if account == "" {
+			account = reachable.String()
+		}
+		state.Add(Blob{Account: account, Container: "video", Name: test.name, CopyContainer: test.copyTo, Requested: requested, Status: Pending})
+	}
+	// A blob of an account that is not selected is left alone.
+	state.Add(Blob{Account: "https://other.blob.core.windows.net/", Container: "video", Name: "online", Status: Pending})
+
+	err = Check(context.Background(), scan, []config.Account{reachable, unreachable}, state.Pending())
+	if err == nil || !strings.Contains(err.Error(), unreachable.URL) {
+		t.Errorf("Check: %v, want the failure of %s", err, unreachable.URL)
+	}
+
+	for i, test := range tests {
+		b := state.Blobs[i]
+		if b.Status != test.status || b.ArchiveStatus != test.archiveStatus || !strings.Contains(b.Error, test.err) || (test.err == "") != (b.Error == "") {
+			t.Errorf("%s %s: status %q, archive status %q, error %q; want %q, %q, %q",
+				b.Account, b.Name, b.Status, b.ArchiveStatus, b.Error, test.status, test.archiveStatus, test.err)
+		}
+		if b.Checked.IsZero() {
+			t.Errorf("%s %s: not marked as checked", b.Account, b.Name)
+		}
+		if (b.Status == Online) != !b.Online.IsZero() {
+			t.Errorf("%s %s: status %s, online at %v", b.Account, b.Name, b.Status, b.Online)
+		}
+	}
+	if other := state.Blobs[len(tests)]; other.Status != Pending || !other.Checked.IsZero() {
+		t.Errorf("the blob of an unselected account was checked: %+v", other)
+	}
+}
+
+func TestStateTransitions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profile", "state.json")
+	state, err := Load(path)
+	if err != nil {
+		t.Fatalf("loading a missing state: %v", err)
+	}
+	if len(state.Blobs) != 0 || state.Path() != path {
+		t.Fatalf("got %d blobs at %s, want an empty state at %s", len(state.Blobs), state.Path(), path)
+	}
+
+	const account = "https://a.blob.core.windows.net/"
+	state.Add(Blob{Account: account, Container: "video", Name: "a.mp4", Status: Pending})
+	state.Add(Blob{Account: account, Container: "video", Name: "b.mp4", Status: Pending})
+	if !state.IsPending(account, "video", "a.mp4") || state.IsPending(account, "video", "c.mp4") {
+		t.Error("IsPending does not match the recorded blobs")
+	}
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A reloaded state goes on from the file: a.mp4 comes online, and the
+	// failed b.mp4 is requested again, replacing its record.
+	state, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Blobs[0].Status = Online
+	state.Add(Blob{Account: account, Container: "video", Name: "b.mp4", Status: Failed, Error: "copy aborted"})
+	if state.IsPending(account, "video", "a.mp4") || state.IsPending(account, "video", "b.mp4") || len(state.Pending()) != 0 {
+		t.Errorf("online and failed blobs are still pending: %v", state.Pending())
+	}
+	state.Add(Blob{Account: account, Container: "video", Name: "b.mp4", Status: Pending})
+	if len(state.Blobs) != 2 {
+		t.Errorf("got %d records, want a request again to replace the earlier record", len(state.Blobs))
+	}
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := state.Pending()
+	if len(pending) != 1 || pending[0].Name != "b.mp4" || pending[0].Error != "" || state.Blobs[0].Status != Online {
+		t.Errorf("reloaded %+v, want a.mp4 online and b.mp4 pending again", state.Blobs)
+	}
+}
@@ -0,0 +1,183 @@
+// Package rehydrate brings archived blobs back online: it requests their
+// rehydration, in place or to a copy, and keeps a local record of every
+// request so their progress can be followed over the hours it takes.
+package rehydrate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gowithazure/src/config"
+)
+
+// The statuses of a rehydration.
+const (
+	// Pending rehydrations were requested and the blob is not online yet.
+	Pending = "pending"
+	// Online blobs can be read again.
+	Online = "online"
+	// Failed rehydrations could not be requested, or stopped before the
+	// blob came online.
+	Failed = "failed"
+	// Skipped blobs were already pending in the state, so no new request
+	// was made. Skipped records are reported but never kept in the state.
+	Skipped = "skipped"
+)
+
+// Blob is the record of the rehydration of one archived blob.
+type Blob struct {
+	Account   string `json:"account"`
+	Container string `json:"container"`
+	Name      string `json:"name"`
+	Bytes     int64  `json:"bytes"`
+	// CopyContainer is the container of the copy the blob is rehydrated
+	// to, under the same name, or "" when it is rehydrated in place.
+	CopyContainer string    `json:"copyContainer,omitempty"`
+	Tier          string    `json:"tier"`
+	Priority      string    `json:"priority"`
+	Requested     time.Time `json:"requested"`
+	Status        string    `json:"status"`
+	// ArchiveStatus is the rehydration status last reported by the
+	// service, such as rehydrate-pending-to-hot.
+	ArchiveStatus string    `json:"archiveStatus,omitempty"`
+	Checked       time.Time `json:"checked"`
+	Online        time.Time `json:"online"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// Target is the container and name of the blob that comes online.
+func (b *Blob) Target() (string, string) {
+	if b.CopyContainer != "" {
+		return b.CopyContainer, b.Name
+	}
+	return b.Container, b.Name
+}
+
+// State is the local record of the rehydrations requested for a profile. It
+// is safe for concurrent use.
+type State struct {
+	Blobs []*Blob `json:"blobs"`
+
+	path string
+	mu   sync.Mutex
+	// index holds the records of Blobs by blobKey.
+	index map[blobKey]*Blob
+}
+
+// blobKey identifies the record of a blob in a State.
+type blobKey struct {
+	account, container, name string
+}
+
+// DefaultPath is where the state of a profile is kept when no file is
+// given: <profile>-rehydrate.json in config.DataDir.
+func DefaultPath(profile string) (string, error) {
+	dir, err := config.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, profile+"-rehydrate.json"), nil
+}
+
+// Load reads the state file at path, or returns an empty state when there is
+// none yet.
+func Load(path string) (*State, error) {
+	state := &State{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("reading rehydration state %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// indexed returns the index of the records, building it on first use. The
+// caller holds s.mu.
+func (s *State) indexed() map[blobKey]*Blob {
+	if s.index == nil {
+		s.index = make(map[blobKey]*Blob, len(s.Blobs))
+		for _, b := range s.Blobs {
+			s.index[blobKey{b.Account, b.Container, b.Name}] = b
+		}
+	}
+	return s.index
+}
+
+// Path returns the file the state is saved to.
+func (s *State) Path() string {
+	return s.path
+}
+
+// Add records a rehydration, replacing an earlier record of the same blob.
+func (s *State) Add(blob Blob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := blobKey{blob.Account, blob.Container, blob.Name}
+	index := s.indexed()
+	if earlier, ok := index[key]; ok {
+		*earlier = blob
+		return
+	}
+	s.Blobs = append(s.Blobs, &blob)
+	index[key] = &blob
+}
+
+// IsPending reports whether the rehydration of a blob was requested and is
+// neither online nor failed yet.
+func (s *State) IsPending(account, containerName, name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.indexed()[blobKey{account, containerName, name}]
+	return ok && b.Status == Pending
+}
+
+// Pending returns the rehydrations that are not online or failed yet.
+func (s *State) Pending() []*Blob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pending []*Blob
+	for _, b := range s.Blobs {
+		if b.Status == Pending {
+			pending = append(pending, b)
+		}
+	}
+	return pending
+}
+
+// Save writes the state file through a temporary file, so an interrupted save
+// leaves the previous state intact.
+func (s *State) Save() error {
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
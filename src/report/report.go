@@ -0,0 +1,237 @@
+// Package report renders the typed results of the commands in the output
+// formats selected with --output. Results are plain structs (or slices of
+// them) with json tags; the tags name the fields in every format, so a
+// result type only needs a Text function for the human readable form.
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats are the output formats understood by Render and Stream.
+var Formats = []string{"text", "table", "json", "ndjson", "csv", "yaml"}
+
+// Table is implemented by results that lay themselves out as rows instead of
+// having their fields flattened into columns.
+type Table interface {
+	Header() []string
+	Rows() [][]string
+}
+
+// Render writes result to w in format. text writes the human readable form;
+// the other formats are derived from result itself. For table, csv and ndjson
+// a slice result gives one row or line per element.
+func Render(w io.Writer, format string, result any, text func(w io.Writer)) error {
+	switch format {
+	case "text":
+		text(w)
+		return nil
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		for _, item := range elements(result) {
+			if err := encoder.Encode(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "yaml":
+		return writeYAML(w, result)
+	case "table":
+		header, rows := tabulate(result)
+		table := newTable(w, header)
+		table.AppendBulk(rows)
+		table.Render()
+		return nil
+	case "csv":
+		header, rows := tabulate(result)
+		writer := csv.NewWriter(w)
+		writer.Write(header)
+		writer.WriteAll(rows)
+		return writer.Error()
+	}
+	return fmt.Errorf("unsupported output format %q, expected one of %v", format, Formats)
+}
+
+// newTable returns a tablewriter table with the layout used by every command.
+func newTable(w io.Writer, header []string) *tablewriter.Table {
+	table := tablewriter.NewWriter(w)
+	table.SetHeader(header)
+	table.SetAutoWrapText(false)
+	table.SetAutoFormatHeaders(false)
+	return table
+}
+
+// writeYAML writes result as YAML using its json field names. Going through
+// JSON keeps the names and order consistent with the json format.
+func writeYAML(w io.Writer, result any) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	blockStyle(&node)
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// blockStyle clears the flow and quoting styles yaml.v3 keeps from the JSON
+// input; the encoder still quotes strings that would otherwise be ambiguous.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// elements returns the elements of a slice result, or the result itself.
+func elements(result any) []any {
+	value := reflect.ValueOf(result)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return []any{result}
+	}
+	items := make([]any, value.Len())
+	for i := range items {
+		items[i] = value.Index(i).Interface()
+	}
+	return items
+}
+
+// tabulate lays result out as a header and rows, using its Table methods if it
+// has them and otherwise one column per json field.
+func tabulate(result any) ([]string, [][]string) {
+	if table, ok := result.(Table); ok {
+		return table.Header(), table.Rows()
+	}
+
+	items := elements(result)
+	var header []string
+	if len(items) > 0 {
+		header = columns(items[0])
+	} else if t := reflect.TypeOf(result); t != nil {
+		// An empty slice still gets the header of its element type.
+		header = columns(reflect.Zero(t.Elem()).Interface())
+	}
+
+	rows := make([][]string, len(items))
+	for i, item := range items {
+		rows[i] = cells(item)
+	}
+	return header, rows
+}
+
+// columns returns the column names of one row of item.
+func columns(item any) []string {
+	var names []string
+	walkFields(reflect.ValueOf(item), func(name string, _ reflect.Value) {
+		names = append(names, name)
+	})
+	return names
+}
+
+// cells returns the row for item, in the order of columns.
+func cells(item any) []string {
+	var row []string
+	walkFields(reflect.ValueOf(item), func(_ string, value reflect.Value) {
+		row = append(row, cell(value))
+	})
+	return row
+}
+
+// walkFields calls fn for every exported field of a struct, named by its json
+// tag and with embedded structs flattened. A value that is not a struct is a
+// single column named "value".
+func walkFields(value reflect.Value, fn func(name string, value reflect.Value)) {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct || value.Type() == reflect.TypeOf(time.Time{}) {
+		fn("value", value)
+		return
+	}
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			walkFields(value.Field(i), fn)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fn(name, value.Field(i))
+	}
+}
+
+// cell formats one field value. Scalars are printed as is; slices, maps and
+// nested structs are written as compact JSON.
+func cell(value reflect.Value) string {
+	if !value.IsValid() {
+		return ""
+	}
+	if t, ok := value.Interface().(time.Time); ok {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		return value.String()
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, 64)
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return ""
+		}
+		return cell(value.Elem())
+	case reflect.Slice, reflect.Map:
+		if value.Len() == 0 {
+			return ""
+		}
+	}
+
+	data, err := json.Marshal(value.Interface())
+	if err != nil {
+		return fmt.Sprint(value.Interface())
+	}
+	return string(data)
+}
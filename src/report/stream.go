@@ -0,0 +1,112 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// Stream writes results one at a time, for commands that report items as they
+// are paged in rather than collecting them first. Every format except table
+// is written as it goes; a table is laid out when the stream is closed.
+type Stream struct {
+	w      io.Writer
+	format string
+	// text writes one item in the human readable form.
+	text func(w io.Writer, item any)
+
+	count   int
+	resumed bool
+	header  []string
+	csv     *csv.Writer
+	table   *tablewriter.Table
+}
+
+// NewStream returns a Stream writing to w in format. text writes one item in
+// the human readable form.
+func NewStream(w io.Writer, format string, text func(w io.Writer, item any)) (*Stream, error) {
+	if !slices.Contains(Formats, format) {
+		return nil, fmt.Errorf("unsupported output format %q, expected one of %v", format, Formats)
+	}
+	return &Stream{w: w, format: format, text: text}, nil
+}
+
+// Write writes one item. Items of a stream should all be of the same type so
+// their columns line up.
+func (s *Stream) Write(item any) error {
+	first := s.count == 0
+	s.count++
+
+	switch s.format {
+	case "text":
+		s.text(s.w, item)
+		return nil
+	case "ndjson":
+		return json.NewEncoder(s.w).Encode(item)
+	case "json":
+		// A JSON array, opened by the first item and closed by Close.
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		separator := ",\n  "
+		if first && !s.resumed {
+			separator = "[\n  "
+		}
+		_, err = fmt.Fprintf(s.w, "%s%s", separator, data)
+		return err
+	case "yaml":
+		// Each item as an entry of a single top level sequence.
+		return writeYAML(s.w, []any{item})
+	case "csv":
+		if s.csv == nil {
+			s.csv = csv.NewWriter(s.w)
+			if !s.resumed {
+				s.csv.Write(columns(item))
+			}
+		}
+		s.csv.Write(cells(item))
+		s.csv.Flush()
+		return s.csv.Error()
+	case "table":
+		if first {
+			s.header = columns(item)
+			s.table = newTable(s.w, s.header)
+		}
+		s.table.Append(cells(item))
+	}
+	return nil
+}
+
+// Resume marks the stream as continuing output written by an earlier run, so
+// the CSV header or the opening of the JSON array is not written again.
+func (s *Stream) Resume() {
+	s.resumed = true
+}
+
+// Close finishes the stream: it closes the JSON array or lays out the table.
+func (s *Stream) Close() error {
+	switch s.format {
+	case "json":
+		if s.count == 0 && !s.resumed {
+			_, err := fmt.Fprintln(s.w, "[]")
+			return err
+		}
+		_, err := fmt.Fprintln(s.w, "\n]")
+		return err
+	case "yaml":
+		if s.count == 0 {
+			_, err := fmt.Fprintln(s.w, "[]")
+			return err
+		}
+	case "table":
+		if s.table != nil {
+			s.table.Render()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package report
+
+import "fmt"
+
+// Bytes formats a size in binary units for the human readable output, such
+// as 512 B, 1.5 KiB or 12.0 TiB.
+func Bytes(n int64) string {
+	const unit = 1024
+	if n < unit && n > -unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, exp := float64(n)/unit, 0
+	for value >= unit || value <= -unit {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTPE"[exp])
+}
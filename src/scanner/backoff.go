@@ -0,0 +1,119 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gowithazure/src/utility"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+// Backoff controls how a page request that keeps being throttled (429, 503)
+// or failing transiently is retried once the SDK's own retries are used up.
+type Backoff struct {
+	// Retries is the number of times a page is retried; 0 disables backoff.
+	Retries int
+	// Delay is the wait before the first retry, doubled on each further one.
+	// A Retry-After header from the service takes precedence.
+	Delay time.Duration
+	// MaxDelay caps the wait between retries.
+	MaxDelay time.Duration
+}
+
+// DefaultBackoff is used by scanners created with New.
+var DefaultBackoff = Backoff{Retries: 5, Delay: 2 * time.Second, MaxDelay: time.Minute}
+
+// throttle is shared by every worker of a scan. When one of them is throttled
+// all of them hold off, since the limit applies to the account or
+// subscription rather than to a single container.
+type throttle struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+// wait blocks until the current pause is over or ctx is done.
+func (t *throttle) wait(ctx context.Context) error {
+	t.mu.Lock()
+	pause := time.Until(t.until)
+	t.mu.Unlock()
+	return Sleep(ctx, pause)
+}
+
+// pause holds off every worker for at least d.
+func (t *throttle) pause(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until := time.Now().Add(d); until.After(t.until) {
+		t.until = until
+	}
+}
+
+// nextPage fetches the next page of pager, backing off and retrying the same
+// page while the service throttles or fails transiently.
+func nextPage[T any](ctx context.Context, pager *runtime.Pager[T], backoff Backoff, t *throttle) (T, error) {
+	delay := backoff.Delay
+	for attempt := 0; ; attempt++ {
+		if err := t.wait(ctx); err != nil {
+			return *new(T), utility.WithKind(utility.KindCanceled, err)
+		}
+
+		page, err := pager.NextPage(ctx)
+		if err == nil || attempt >= backoff.Retries || !Retriable(err) {
+			return page, err
+		}
+
+		wait := RetryAfter(err)
+		if wait == 0 {
+			wait = min(delay, backoff.MaxDelay)
+			delay *= 2
+		}
+		t.pause(wait)
+	}
+}
+
+// Retriable reports whether a failed request is worth another try.
+func Retriable(err error) bool {
+	switch utility.KindOf(err) {
+	case utility.KindThrottled, utility.KindTransient:
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return false
+}
+
+// RetryAfter returns the wait asked for by the service in a Retry-After
+// header, or 0.
+func RetryAfter(err error) time.Duration {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) || respErr.RawResponse == nil {
+		return 0
+	}
+	value := respErr.RawResponse.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// Sleep waits for d or until ctx is done.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,125 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"gowithazure/src/config"
+)
+
+// AccountError collects the failures of one storage account: the container
+// listing, or the blob listings of individual containers.
+type AccountError struct {
+	// Index is the position of the account in the slice given to Scan.
+	Index   int
+	Account string
+	Errs    []error
+	// Incomplete is set when the container listing stopped early, so the
+	// account may have containers the scan did not see. Failed blob
+	// listings alone leave it unset.
+	Incomplete bool
+
+	mu sync.Mutex
+}
+
+func (e *AccountError) add(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Errs = append(e.Errs, err)
+}
+
+// stop records a failure that ends the container listing.
+func (e *AccountError) stop(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Errs = append(e.Errs, err)
+	e.Incomplete = true
+}
+
+// failed reports whether a failure has been recorded so far.
+func (e *AccountError) failed() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.Errs) > 0
+}
+
+func (e *AccountError) Error() string {
+	return e.Account + ": " + e.summary()
+}
+
+// summary describes the failures without naming the account.
+func (e *AccountError) summary() string {
+	message := e.Errs[0].Error()
+	if len(e.Errs) > 1 {
+		message += fmt.Sprintf(" (and %d more)", len(e.Errs)-1)
+	}
+	return message
+}
+
+// Unwrap returns the individual failures so errors.As and utility.KindOf see
+// the first of them.
+func (e *AccountError) Unwrap() []error {
+	return e.Errs
+}
+
+// Message is the redacted text of the failure for an account's result, which
+// already names the account.
+func (e *AccountError) Message() string {
+	if e == nil {
+		return ""
+	}
+	return config.Redact(e.summary())
+}
+
+// Errors is returned by Scan when one or more accounts failed.
+type Errors struct {
+	// Total is the number of accounts scanned.
+	Total    int
+	Failures []*AccountError
+}
+
+func (e *Errors) Error() string {
+	return fmt.Sprintf("%d of %d storage accounts failed, first: %v", len(e.Failures), e.Total, e.Failures[0])
+}
+
+// Unwrap returns the per-account failures.
+func (e *Errors) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, failure := range e.Failures {
+		errs[i] = failure
+	}
+	return errs
+}
+
+// For returns the failure of the account at index, or nil if it succeeded.
+func (e *Errors) For(index int) *AccountError {
+	for _, failure := range e.Failures {
+		if failure.Index == index {
+			return failure
+		}
+	}
+	return nil
+}
+
+// Message returns the redacted failure of the account at index in err, or ""
+// when err does not hold one. Commands store it in the account's result.
+func Message(err error, index int) string {
+	var scanErr *Errors
+	if errors.As(err, &scanErr) {
+		return scanErr.For(index).Message()
+	}
+	return ""
+}
+
+// Incomplete reports whether the account at index may have containers that
+// the scan ending with err did not see: its container listing failed, or the
+// scan stopped for another reason such as a canceled context.
+func Incomplete(err error, index int) bool {
+	var scanErr *Errors
+	if errors.As(err, &scanErr) {
+		failure := scanErr.For(index)
+		return failure != nil && failure.Incomplete
+	}
+	return err != nil
+}
@@ -0,0 +1,338 @@
+// Package scanner walks the containers, and optionally the blobs, of a set of
+// storage accounts. Accounts and containers are processed by a bounded pool
+// of workers, the walk stops when its context is canceled, and failures are
+// collected per account rather than aborting the whole scan.
+package scanner
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"gowithazure/src/config"
+	"gowithazure/src/utility"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+)
+
+// SkipContainer can be returned by a Container callback to skip the blobs of
+// that container, or by a Blob callback to stop walking the rest of them. It
+// is not reported as a failure.
+var SkipContainer = errors.New("skip container")
+
+// Account is the storage account being scanned, passed to every callback.
+type Account struct {
+	// Index is the position of the account in the slice given to Scan, so
+	// callers can keep per-account results in a slice of their own.
+	Index  int
+	Config config.Account
+	// URL is the account endpoint without any SAS, safe to print.
+	URL    string
+	Client *azblob.Client
+}
+
+// Callbacks are invoked as the scan progresses. Container is called for the
+// containers of one account in listing order, but different accounts are
+// scanned concurrently. Blob is called concurrently for different containers.
+// Callbacks must therefore guard any state they share.
+type Callbacks struct {
+	// Container is called for every container. Returning SkipContainer skips
+	// its blobs; any other error stops the scan of the account.
+	Container func(ctx context.Context, account *Account, item *service.ContainerItem) error
+	// Blob is called for every blob of every container when set. An error
+	// stops the walk of the container and is recorded against the account.
+	Blob func(ctx context.Context, account *Account, containerName string, item *container.BlobItem) error
+	// BlobPage is called, when set, after the blobs of each page have been
+	// passed to Blob, with the marker of the next page or "" after the last
+	// one. Listing that container again from the marker continues right after
+	// the page. An error stops the walk of the container.
+	BlobPage func(ctx context.Context, account *Account, containerName string, nextMarker string) error
+	// ContainerPage is called, when set, once every container of a page has
+	// been passed to Container and, when Blob is set, had its blobs walked
+	// without failure, with the marker of the next page or "" after the last
+	// one. An error stops the scan of the account.
+	ContainerPage func(ctx context.Context, account *Account, nextMarker string) error
+	// ContainerDone is called, when set, after the blobs of a container have
+	// been walked, with the error that ended the walk if any.
+	ContainerDone func(account *Account, containerName string, err error)
+}
+
+// Scanner holds the settings of a scan.
+type Scanner struct {
+	// Concurrency bounds the number of accounts scanned at once.
+	Concurrency int
+	// Workers bounds the number of containers whose blobs are listed at once,
+	// across all accounts. It defaults to Concurrency.
+	Workers int
+	// Backoff controls the retries of throttled page requests.
+	Backoff Backoff
+	// Connect creates the client for an account.
+	Connect func(config.Account) (*azblob.Client, error)
+	// ListContainers are the options for listing containers; nil lists all
+	// live containers with their metadata.
+	ListContainers *azblob.ListContainersOptions
+	// ListBlobs are the options for listing the blobs of a container.
+	ListBlobs *azblob.ListBlobsFlatOptions
+	// Progress, when set, makes the scan resumable: listings start where it
+	// says an earlier scan stopped, and every completed page is recorded in it.
+	Progress Progress
+}
+
+// Progress records how far a scan got so a later scan can pick up from there.
+// Markers are the continuation markers handed out by the listing APIs, and
+// accounts are identified by their URL.
+type Progress interface {
+	// Account returns the marker the container listing of an account
+	// continues from, or done when the account was scanned completely.
+	Account(account string) (marker string, done bool)
+	// Container returns the marker the blob listing of a container continues
+	// from, or done when its blobs were walked completely.
+	Container(account, name string) (marker string, done bool)
+	// ContainerPage runs commit, the ContainerPage callback, and records that
+	// the container listing of the account continues from nextMarker, as one
+	// step: a scan resumed from the record sees exactly what was committed.
+	ContainerPage(account, nextMarker string, commit func() error) error
+	// BlobPage does the same for the blob listing of a container.
+	BlobPage(account, container, nextMarker string, commit func() error) error
+}
+
+// New returns a Scanner with the given concurrency and connect function and
+// DefaultBackoff.
+func New(concurrency int, connect func(config.Account) (*azblob.Client, error)) *Scanner {
+	return &Scanner{Concurrency: concurrency, Connect: connect, Backoff: DefaultBackoff}
+}
+
+// scan is the state shared by the workers of one call to Scan.
+type scan struct {
+	*Scanner
+	cb Callbacks
+	// blobSlots is shared by every account so the total number of blob
+	// listings stays bounded.
+	blobSlots chan struct{}
+	throttle  throttle
+}
+
+// Scan walks every account, calling cb as it goes. It returns nil when every
+// account was scanned completely, or an *Errors describing the accounts that
+// failed. A failed blob listing does not stop the other containers of the
+// account. A canceled context stops the scan and is reported as KindCanceled.
+func (s *Scanner) Scan(ctx context.Context, accounts []config.Account, cb Callbacks) error {
+	concurrency := max(s.Concurrency, 1)
+	workers := s.Workers
+	if workers < 1 {
+		workers = concurrency
+	}
+
+	run := &scan{Scanner: s, cb: cb, blobSlots: make(chan struct{}, workers)}
+	accountSlots := make(chan struct{}, concurrency)
+	failures := make([]*AccountError, len(accounts))
+
+	var wg sync.WaitGroup
+	for i, account := range accounts {
+		if !acquire(ctx, accountSlots) {
+			break
+		}
+		wg.Add(1)
+		go func(i int, account config.Account) {
+			defer wg.Done()
+			defer func() { <-accountSlots }()
+			failures[i] = run.account(ctx, i, account)
+		}(i, account)
+	}
+	wg.Wait()
+
+	scanErr := &Errors{Total: len(accounts)}
+	for _, failure := range failures {
+		if failure != nil {
+			scanErr.Failures = append(scanErr.Failures, failure)
+		}
+	}
+	if len(scanErr.Failures) > 0 {
+		return scanErr
+	}
+	if err := ctx.Err(); err != nil {
+		return utility.WithKind(utility.KindCanceled, err)
+	}
+	return nil
+}
+
+// account walks one account and returns its failures, or nil.
+func (s *scan) account(ctx context.Context, index int, cfg config.Account) *AccountError {
+	cb := s.cb
+	failure := &AccountError{Index: index, Account: cfg.String()}
+
+	client, err := s.Connect(cfg)
+	if err != nil {
+		failure.stop(utility.Wrap(err, "connecting"))
+		return failure
+	}
+	account := &Account{Index: index, Config: cfg, URL: cfg.String(), Client: client}
+
+	var options azblob.ListContainersOptions
+	if s.ListContainers != nil {
+		options = *s.ListContainers
+	} else {
+		options.Include = azblob.ListContainersInclude{Metadata: true, Deleted: false}
+	}
+	if s.Progress != nil {
+		marker, done := s.Progress.Account(account.URL)
+		if done {
+			return nil
+		}
+		if marker != "" {
+			options.Marker = &marker
+		}
+	}
+
+	// Pages are only recorded once their containers are finished, so the
+	// blob walks of one page complete before the next page is listed.
+	trackPages := cb.ContainerPage != nil || s.Progress != nil
+
+	var wg sync.WaitGroup
+	pager := client.NewListContainersPager(&options)
+pages:
+	for pager.More() {
+		resp, err := nextPage(ctx, pager, s.Backoff, &s.throttle)
+		if err != nil {
+			failure.stop(utility.Wrap(err, "listing containers"))
+			break
+		}
+
+		for _, item := range resp.ContainerItems {
+			if cb.Container != nil {
+				err := cb.Container(ctx, account, item)
+				if errors.Is(err, SkipContainer) {
+					continue
+				}
+				if err != nil {
+					failure.stop(utility.Wrap(err, "container %s", *item.Name))
+					break pages
+				}
+			}
+			if cb.Blob == nil {
+				continue
+			}
+			if s.Progress != nil {
+				if _, done := s.Progress.Container(account.URL, *item.Name); done {
+					continue
+				}
+			}
+
+			if !acquire(ctx, s.blobSlots) {
+				failure.stop(utility.WithKind(utility.KindCanceled, ctx.Err()))
+				break pages
+			}
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				defer func() { <-s.blobSlots }()
+				err := s.blobs(ctx, account, name)
+				if err != nil {
+					failure.add(err)
+				}
+				if cb.ContainerDone != nil {
+					cb.ContainerDone(account, name, err)
+				}
+			}(*item.Name)
+		}
+
+		if !trackPages {
+			continue
+		}
+		wg.Wait()
+		// A failed container keeps the marker on its page, so a resumed scan
+		// lists it again.
+		if failure.failed() {
+			continue
+		}
+		var nextMarker string
+		if resp.NextMarker != nil {
+			nextMarker = *resp.NextMarker
+		}
+		commit := func() error {
+			if cb.ContainerPage == nil {
+				return nil
+			}
+			return cb.ContainerPage(ctx, account, nextMarker)
+		}
+		if s.Progress != nil {
+			err = s.Progress.ContainerPage(account.URL, nextMarker, commit)
+		} else {
+			err = commit()
+		}
+		if err != nil {
+			failure.stop(utility.Wrap(err, "listing containers"))
+			break
+		}
+	}
+	wg.Wait()
+
+	if len(failure.Errs) == 0 {
+		return nil
+	}
+	return failure
+}
+
+// blobs calls the Blob callback for every blob of one container.
+func (s *scan) blobs(ctx context.Context, account *Account, containerName string) error {
+	var options azblob.ListBlobsFlatOptions
+	if s.ListBlobs != nil {
+		options = *s.ListBlobs
+	}
+	if s.Progress != nil {
+		if marker, _ := s.Progress.Container(account.URL, containerName); marker != "" {
+			options.Marker = &marker
+		}
+	}
+
+	pager := account.Client.NewListBlobsFlatPager(containerName, &options)
+	for pager.More() {
+		page, err := nextPage(ctx, pager, s.Backoff, &s.throttle)
+		if err != nil {
+			return utility.Wrap(err, "listing blobs in container %s", containerName)
+		}
+		for _, item := range page.Segment.BlobItems {
+			err := s.cb.Blob(ctx, account, containerName, item)
+			if errors.Is(err, SkipContainer) {
+				return nil
+			}
+			if err != nil {
+				return utility.Wrap(err, "container %s, blob %s", containerName, *item.Name)
+			}
+		}
+		if s.cb.BlobPage == nil && s.Progress == nil {
+			continue
+		}
+		var nextMarker string
+		if page.NextMarker != nil {
+			nextMarker = *page.NextMarker
+		}
+		commit := func() error {
+			if s.cb.BlobPage == nil {
+				return nil
+			}
+			return s.cb.BlobPage(ctx, account, containerName, nextMarker)
+		}
+		if s.Progress != nil {
+			err = s.Progress.BlobPage(account.URL, containerName, nextMarker, commit)
+		} else {
+			err = commit()
+		}
+		if err != nil {
+			return utility.Wrap(err, "container %s", containerName)
+		}
+	}
+	return nil
+}
+
+// acquire takes a slot from slots, or returns false once ctx is done.
+func acquire(ctx context.Context, slots chan struct{}) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,286 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gowithazure/src/config"
+	"gowithazure/src/utility"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+)
+
+// MaxBatchSize is the most sub-requests the Blob Batch API accepts in one
+// batch request.
+const MaxBatchSize = 256
+
+// batchTimeout bounds each batch or set tier request, so that a stalled
+// connection cannot hold a worker forever.
+const batchTimeout = time.Minute
+
+// batchVersion is the service version of batch requests and their
+// sub-requests, and of single set tier requests. The SDK's own version
+// predates the Cold tier.
+const batchVersion = "2021-12-02"
+
+// batchClient sends Blob Batch requests, and set tier requests for single
+// blobs, to one storage account at batchVersion. The SDK version in use has
+// no batch client and an older version, so requests are built here and only
+// authorized by the SDK: see sign.
+type batchClient struct {
+	signer *azblob.Client
+	http   *http.Client
+}
+
+// newBatchClient returns a batch client for the account, authorized like
+// NewClient.
+func newBatchClient(account config.Account, credential func() (azcore.TokenCredential, error)) (*batchClient, error) {
+	signer, err := newClient(account, credential, &azblob.ClientOptions{ClientOptions: azcore.ClientOptions{
+		PerCallPolicies: []policy.Policy{rewritePolicy{}},
+		Retry:           policy.RetryOptions{MaxRetries: -1},
+		Transport:       captureTransport{},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return &batchClient{signer: signer, http: &http.Client{Timeout: batchTimeout}}, nil
+}
+
+// signing is a request to authorize: method, url and header replace those
+// of the SDK operation that carries it through the signer's pipeline, and
+// signed is the request as it left the pipeline.
+type signing struct {
+	method string
+	url    *url.URL
+	header http.Header
+	signed *http.Request
+}
+
+// signingKey is the context key of the signing carried by a request.
+type signingKey struct{}
+
+// rewritePolicy turns the request of an SDK operation into the request of
+// its signing before the authentication policies see it.
+type rewritePolicy struct{}
+
+func (rewritePolicy) Do(req *policy.Request) (*http.Response, error) {
+	if s, ok := req.Raw().Context().Value(signingKey{}).(*signing); ok {
+		raw := req.Raw()
+		raw.Method = s.method
+		raw.URL = s.url
+		raw.Host = s.url.Host
+		raw.Header = s.header.Clone()
+	}
+	return req.Next()
+}
+
+// captureTransport keeps the signed request instead of sending it.
+type captureTransport struct{}
+
+func (captureTransport) Do(req *http.Request) (*http.Response, error) {
+	s, ok := req.Context().Value(signingKey{}).(*signing)
+	if !ok {
+		return nil, errors.New("the batch signer cannot send requests")
+	}
+	s.signed = req
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+}
+
+// sign returns the request authorized as the account's client would,
+// whether with a shared key, a SAS already in rawURL or a bearer token.
+func (c *batchClient) sign(ctx context.Context, method, rawURL string, header http.Header) (*http.Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	s := &signing{method: method, url: u, header: header}
+	carrier := c.signer.ServiceClient().NewContainerClient("batch").NewBlobClient("batch")
+	if _, err := carrier.GetProperties(context.WithValue(ctx, signingKey{}, s), nil); err != nil {
+		return nil, err
+	}
+	if s.signed == nil {
+		return nil, errors.New("the batch request was not signed")
+	}
+	return s.signed, nil
+}
+
+// setTiers moves the blobs of a container to tier in one batch request. It
+// returns the outcome of every blob in order, nil for those moved, or an
+// error when the batch as a whole failed.
+func (c *batchClient) setTiers(ctx context.Context, containerName string, blobs []string, tier string) ([]error, error) {
+	boundary, err := newBoundary()
+	if err != nil {
+		return nil, err
+	}
+	containerClient := c.signer.ServiceClient().NewContainerClient(containerName)
+
+	var body bytes.Buffer
+	subRequests := make([]*http.Request, len(blobs))
+	for i, name := range blobs {
+		sub, err := c.tierRequest(ctx, containerName, name, tier)
+		if err != nil {
+			return nil, err
+		}
+		subRequests[i] = sub
+
+		fmt.Fprintf(&body, "--%s\r\nContent-Type: application/http\r\nContent-Transfer-Encoding: binary\r\nContent-ID: %d\r\n\r\n", boundary, i)
+		fmt.Fprintf(&body, "%s %s HTTP/1.1\r\n", sub.Method, sub.URL.RequestURI())
+		sub.Header.Write(&body)
+		body.WriteString("\r\n")
+	}
+	fmt.Fprintf(&body, "--%s--\r\n", boundary)
+
+	u, err := withQuery(containerClient.URL(), "restype", "container", "comp", "batch")
+	if err != nil {
+		return nil, err
+	}
+	signed, err := c.sign(ctx, http.MethodPost, u, http.Header{
+		"Content-Type":   {"multipart/mixed; boundary=" + boundary},
+		"Content-Length": {strconv.Itoa(body.Len())},
+		"x-ms-version":   {batchVersion},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req := signed.Clone(ctx)
+	req.Body = io.NopCloser(bytes.NewReader(body.Bytes()))
+	req.ContentLength = int64(body.Len())
+
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, runtime.NewResponseError(resp)
+	}
+	return readBatchResponse(resp, subRequests)
+}
+
+// setTier moves one blob to tier.
+func (c *batchClient) setTier(ctx context.Context, containerName, blobName, tier string) error {
+	signed, err := c.tierRequest(ctx, containerName, blobName, tier)
+	if err != nil {
+		return err
+	}
+	req := signed.Clone(ctx)
+	req.Body = http.NoBody
+	req.ContentLength = 0
+
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return runtime.NewResponseError(resp)
+	}
+	return nil
+}
+
+// do sends a signed request. A request that ran out of batchTimeout is
+// reported as a transient failure, worth another try, unlike ctx ending.
+func (c *batchClient) do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	resp, err := c.http.Do(req)
+	if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		return nil, utility.New(utility.KindTransient, "%s %s: no response within %s", req.Method, req.URL.Path, batchTimeout)
+	}
+	return resp, err
+}
+
+// tierRequest returns the signed request moving a blob to tier, sent alone
+// or as a sub-request of a batch.
+func (c *batchClient) tierRequest(ctx context.Context, containerName, blobName, tier string) (*http.Request, error) {
+	blobClient := c.signer.ServiceClient().NewContainerClient(containerName).NewBlobClient(blobName)
+	u, err := withQuery(blobClient.URL(), "comp", "tier")
+	if err != nil {
+		return nil, err
+	}
+	return c.sign(ctx, http.MethodPut, u, http.Header{
+		"x-ms-access-tier": {tier},
+		"x-ms-version":     {batchVersion},
+		"Content-Length":   {"0"},
+	})
+}
+
+// readBatchResponse parses the multipart response of a batch into the
+// outcome of each of its sub-requests, matched by Content-ID.
+func readBatchResponse(resp *http.Response, subRequests []*http.Request) ([]error, error) {
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return nil, fmt.Errorf("reading batch response: no multipart boundary in %q", resp.Header.Get("Content-Type"))
+	}
+
+	errs := make([]error, len(subRequests))
+	answered := make([]bool, len(subRequests))
+	parts := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading batch response: %w", err)
+		}
+		id, err := strconv.Atoi(part.Header.Get("Content-ID"))
+		if err != nil || id < 0 || id >= len(subRequests) {
+			return nil, fmt.Errorf("reading batch response: unexpected Content-ID %q", part.Header.Get("Content-ID"))
+		}
+		// The line break ending the headers of a sub-response without a
+		// body belongs to the boundary that follows, so put one back.
+		sub, err := http.ReadResponse(bufio.NewReader(io.MultiReader(part, strings.NewReader("\r\n"))), subRequests[id])
+		if err != nil {
+			return nil, fmt.Errorf("reading batch response: %w", err)
+		}
+		if sub.StatusCode >= http.StatusMultipleChoices {
+			errs[id] = runtime.NewResponseError(sub)
+		}
+		sub.Body.Close()
+		answered[id] = true
+	}
+	for i, ok := range answered {
+		if !ok {
+			errs[i] = fmt.Errorf("no response to the sub-request in the batch response")
+		}
+	}
+	return errs, nil
+}
+
+// withQuery returns rawURL with the query parameters in pairs added.
+func withQuery(rawURL string, pairs ...string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	for i := 0; i+1 < len(pairs); i += 2 {
+		query.Set(pairs[i], pairs[i+1])
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// newBoundary returns a random multipart boundary for a batch request.
+func newBoundary() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "batch_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,330 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gowithazure/src/config"
+	"gowithazure/src/scanner"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+)
+
+// subRequest is a sub-request of a batch as the fake service received it.
+type subRequest struct {
+	method, path, comp, tier, version string
+	authorized                        bool
+}
+
+// fakeBatchService is a storage account with one container of Hot block
+// blobs that answers Blob Batch and single set tier requests with the status
+// given per blob and attempt, 202 once a blob runs out of statuses.
+type fakeBatchService struct {
+	t        *testing.T
+	blobs    []string
+	statuses map[string][]int
+
+	mu       sync.Mutex
+	attempts map[string]int
+	batches  [][]subRequest
+	// singles are the set tier requests sent outside a batch.
+	singles []subRequest
+}
+
+func (f *fakeBatchService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/devstoreaccount1" && query.Get("comp") == "list":
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Containers>`+
+			`<Container><Name>media</Name><Properties><Last-Modified>Mon, 01 Jan 2024 00:00:00 GMT</Last-Modified><Etag>e</Etag></Properties></Container>`+
+			`</Containers><NextMarker/></EnumerationResults>`)
+	case r.Method == http.MethodGet && r.URL.Path == "/devstoreaccount1/media" && query.Get("comp") == "list":
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Blobs>`)
+		for _, name := range f.blobs {
+			fmt.Fprintf(w, `<Blob><Name>%s</Name><Properties><Last-Modified>Mon, 01 Jan 2024 00:00:00 GMT</Last-Modified><Etag>0x1</Etag>`+
+				`<Content-Length>100</Content-Length><BlobType>BlockBlob</BlobType><AccessTier>Hot</AccessTier></Properties></Blob>`, name)
+		}
+		fmt.Fprint(w, `</Blobs><NextMarker/></EnumerationResults>`)
+	case r.Method == http.MethodPost && r.URL.Path == "/devstoreaccount1/media" && query.Get("comp") == "batch":
+		f.batch(w, r)
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/devstoreaccount1/media/") && query.Get("comp") == "tier":
+		f.mu.Lock()
+		f.singles = append(f.singles, subRequest{
+			method:     r.Method,
+			path:       r.URL.Path,
+			comp:       query.Get("comp"),
+			tier:       r.Header.Get("x-ms-access-tier"),
+			version:    r.Header.Get("x-ms-version"),
+			authorized: strings.HasPrefix(r.Header.Get("Authorization"), "SharedKey devstoreaccount1:"),
+		})
+		status := f.status(strings.TrimPrefix(r.URL.Path, "/devstoreaccount1/media/"))
+		f.mu.Unlock()
+		writeStatus(w.Header(), status)
+		w.WriteHeader(status)
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// batch parses the sub-requests of a batch and answers each of them.
+func (f *fakeBatchService) batch(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" || r.Header.Get("x-ms-version") != batchVersion {
+		f.t.Errorf("batch request: Authorization %q, x-ms-version %q", r.Header.Get("Authorization"), r.Header.Get("x-ms-version"))
+	}
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		f.t.Errorf("batch request Content-Type %q: %v", r.Header.Get("Content-Type"), err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var batch []subRequest
+	var ids []string
+	parts := multipart.NewReader(r.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.t.Errorf("reading batch request: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if part.Header.Get("Content-Type") != "application/http" {
+			f.t.Errorf("sub-request Content-Type %q", part.Header.Get("Content-Type"))
+		}
+		// As in responses, the blank line ending the headers of a
+		// sub-request belongs to the boundary that follows.
+		sub, err := http.ReadRequest(bufio.NewReader(io.MultiReader(part, strings.NewReader("\r\n"))))
+		if err != nil {
+			f.t.Errorf("reading sub-request: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		batch = append(batch, subRequest{
+			method:     sub.Method,
+			path:       sub.URL.Path,
+			comp:       sub.URL.Query().Get("comp"),
+			tier:       sub.Header.Get("x-ms-access-tier"),
+			version:    sub.Header.Get("x-ms-version"),
+			authorized: strings.HasPrefix(sub.Header.Get("Authorization"), "SharedKey devstoreaccount1:"),
+		})
+		ids = append(ids, part.Header.Get("Content-ID"))
+	}
+
+	f.mu.Lock()
+	f.batches = append(f.batches, batch)
+	statuses := make([]int, len(batch))
+	for i, sub := range batch {
+		statuses[i] = f.status(strings.TrimPrefix(sub.path, "/devstoreaccount1/media/"))
+	}
+	f.mu.Unlock()
+
+	// Answer in reverse order: sub-responses are matched by Content-ID.
+	response := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+response.Boundary())
+	w.WriteHeader(http.StatusAccepted)
+	for i := len(batch) - 1; i >= 0; i-- {
+		part, _ := response.CreatePart(map[string][]string{
+			"Content-Type": {"application/http"},
+			"Content-ID":   {ids[i]},
+		})
+		fmt.Fprintf(part, "HTTP/1.1 %d %s\r\n", statuses[i], http.StatusText(statuses[i]))
+		header := http.Header{"Content-Length": {"0"}}
+		writeStatus(header, statuses[i])
+		header.Write(part)
+	}
+	response.Close()
+}
+
+// status returns the status of the next attempt at moving a blob. The
+// caller holds f.mu.
+func (f *fakeBatchService) status(name string) int {
+	status := http.StatusAccepted
+	if attempt := f.attempts[name]; attempt < len(f.statuses[name]) {
+		status = f.statuses[name][attempt]
+	}
+	f.attempts[name]++
+	return status
+}
+
+// writeStatus sets the headers the service sends along with a status.
+func writeStatus(header http.Header, status int) {
+	switch status {
+	case http.StatusConflict:
+		header.Set("x-ms-error-code", "BlobBeingRehydrated")
+	case http.StatusServiceUnavailable:
+		header.Set("x-ms-error-code", "ServerBusy")
+		header.Set("Retry-After", "1")
+	}
+}
+
+func TestTierBatchRetriesThrottledBlobs(t *testing.T) {
+	fake := &fakeBatchService{
+		t:     t,
+		blobs: []string{"a.mp4", "b.mp4", "c.mp4", "d.mp4"},
+		statuses: map[string][]int{
+			"b.mp4": {http.StatusConflict},
+			"c.mp4": {http.StatusServiceUnavailable},
+		},
+		attempts: make(map[string]int),
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	account := config.Account{URL: server.URL + "/devstoreaccount1", AccountKey: "c2VjcmV0a2V5"}
+	scan := scanner.New(1, func(account config.Account) (*azblob.Client, error) { return NewClient(account, nil) })
+	scan.Backoff = scanner.Backoff{Retries: 3, Delay: 10 * time.Millisecond, MaxDelay: 100 * time.Millisecond}
+
+	outcomes := make(map[string]string)
+	started := time.Now()
+	stats, err := Tier(context.Background(), scan, []config.Account{account}, TierOptions{
+		From:      "Hot",
+		To:        "Cold",
+		BatchSize: MaxBatchSize,
+	}, func(change TierChange) {
+		outcomes[change.Blob] = change.Error
+	})
+	if err != nil {
+		t.Fatalf("Tier: %v", err)
+	}
+
+	if len(fake.batches) != 2 {
+		t.Fatalf("got %d batches, want the first and one retry", len(fake.batches))
+	}
+	for i, batch := range fake.batches {
+		for _, sub := range batch {
+			if sub.method != http.MethodPut || sub.comp != "tier" || sub.tier != "Cold" || sub.version != batchVersion || !sub.authorized {
+				t.Errorf("batch %d: unexpected sub-request %+v", i, sub)
+			}
+		}
+	}
+	var paths []string
+	for _, sub := range fake.batches[0] {
+		paths = append(paths, sub.path)
+	}
+	want := []string{"/devstoreaccount1/media/a.mp4", "/devstoreaccount1/media/b.mp4", "/devstoreaccount1/media/c.mp4", "/devstoreaccount1/media/d.mp4"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("first batch blobs %v, want %v", paths, want)
+	}
+	if retried := fake.batches[1]; len(retried) != 1 || retried[0].path != "/devstoreaccount1/media/c.mp4" {
+		t.Errorf("retry batch %+v, want only c.mp4", retried)
+	}
+	if waited := time.Since(started); waited < time.Second {
+		t.Errorf("retried after %s, want at least the Retry-After of 1s", waited)
+	}
+
+	if len(outcomes) != 4 {
+		t.Fatalf("got outcomes %v, want one per blob", outcomes)
+	}
+	for _, name := range []string{"a.mp4", "c.mp4", "d.mp4"} {
+		if outcomes[name] != "" {
+			t.Errorf("%s failed: %s", name, outcomes[name])
+		}
+	}
+	if !strings.Contains(outcomes["b.mp4"], "BlobBeingRehydrated") {
+		t.Errorf("b.mp4 outcome %q, want the 409 error", outcomes["b.mp4"])
+	}
+	if stats.Requests != 2 || stats.Retried != 1 {
+		t.Errorf("stats %+v, want 2 requests and 1 retried blob", stats)
+	}
+}
+
+func TestTierOneRequestPerBlob(t *testing.T) {
+	fake := &fakeBatchService{
+		t:     t,
+		blobs: []string{"a.mp4", "b.mp4", "c.mp4"},
+		statuses: map[string][]int{
+			"b.mp4": {http.StatusConflict},
+			"c.mp4": {http.StatusServiceUnavailable},
+		},
+		attempts: make(map[string]int),
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	account := config.Account{URL: server.URL + "/devstoreaccount1", AccountKey: "c2VjcmV0a2V5"}
+	scan := scanner.New(1, func(account config.Account) (*azblob.Client, error) { return NewClient(account, nil) })
+	scan.Backoff = scanner.Backoff{Retries: 3, Delay: 10 * time.Millisecond, MaxDelay: 100 * time.Millisecond}
+
+	outcomes := make(map[string]string)
+	started := time.Now()
+	stats, err := Tier(context.Background(), scan, []config.Account{account}, TierOptions{From: "Hot", To: "Cold", BatchSize: 1}, func(change TierChange) {
+		outcomes[change.Blob] = change.Error
+	})
+	if err != nil {
+		t.Fatalf("Tier: %v", err)
+	}
+
+	if len(fake.batches) != 0 {
+		t.Errorf("got %d batches, want single requests only", len(fake.batches))
+	}
+	var paths []string
+	for _, sub := range fake.singles {
+		if sub.tier != "Cold" || sub.version != batchVersion || !sub.authorized {
+			t.Errorf("unexpected set tier request %+v, want Cold at %s", sub, batchVersion)
+		}
+		paths = append(paths, sub.path)
+	}
+	want := []string{"/devstoreaccount1/media/a.mp4", "/devstoreaccount1/media/b.mp4", "/devstoreaccount1/media/c.mp4", "/devstoreaccount1/media/c.mp4"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("requests %v, want %v", paths, want)
+	}
+	if waited := time.Since(started); waited < time.Second {
+		t.Errorf("retried after %s, want at least the Retry-After of 1s", waited)
+	}
+
+	if outcomes["a.mp4"] != "" || outcomes["c.mp4"] != "" || !strings.Contains(outcomes["b.mp4"], "BlobBeingRehydrated") {
+		t.Errorf("outcomes %v, want only b.mp4 failed with the 409 error", outcomes)
+	}
+	if stats.Requests != 4 || stats.Retried != 1 {
+		t.Errorf("stats %+v, want 4 requests and 1 retried blob", stats)
+	}
+}
+
+func TestBatchClientTimeoutIsRetriable(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := &batchClient{http: &http.Client{Timeout: 50 * time.Millisecond}}
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/devstoreaccount1/media/a.mp4?comp=tier", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.do(context.Background(), req); err == nil || !scanner.Retriable(err) {
+		t.Errorf("got %v, want a retriable timeout", err)
+	}
+}
+
+func TestReadBatchResponseReportsMissingSubResponses(t *testing.T) {
+	body := "--b\r\nContent-Type: application/http\r\nContent-ID: 1\r\n\r\nHTTP/1.1 202 Accepted\r\nContent-Length: 0\r\n\r\n--b--\r\n"
+	resp := &http.Response{
+		Header: http.Header{"Content-Type": {"multipart/mixed; boundary=b"}},
+		Body:   io.NopCloser(strings.NewReader(body)),
+	}
+	subRequests := []*http.Request{httptest.NewRequest(http.MethodPut, "/a", nil), httptest.NewRequest(http.MethodPut, "/b", nil)}
+	errs, err := readBatchResponse(resp, subRequests)
+	if err != nil {
+		t.Fatalf("readBatchResponse: %v", err)
+	}
+	if errs[0] == nil || errs[1] != nil {
+		t.Errorf("got %v, want an error for the unanswered first sub-request only", errs)
+	}
+}
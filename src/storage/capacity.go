@@ -0,0 +1,319 @@
+package storage
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gowithazure/src/config"
+	"gowithazure/src/scanner"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+)
+
+// NoTier is the tier of blobs listed without one, such as page and append
+// blobs.
+const NoTier = "None"
+
+// Size is the number and total size of the blobs in one group: a tier, a
+// blob type or a prefix.
+type Size struct {
+	Key   string `json:"key"`
+	Blobs int64  `json:"blobs"`
+	Bytes int64  `json:"bytes"`
+}
+
+// ContainerCapacity is the size of one container, in total and per tier.
+// When the container could not be listed to the end its sizes are partial
+// and Error says why.
+type ContainerCapacity struct {
+	Name   string `json:"name"`
+	Blobs  int64  `json:"blobs"`
+	Bytes  int64  `json:"bytes"`
+	ByTier []Size `json:"byTier"`
+	// IdleHot is the hot data not accessed for CapacityOptions.IdleFor.
+	IdleHot Size   `json:"idleHot"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BlobSize is one of the largest blobs of an account.
+type BlobSize struct {
+	Container string `json:"container"`
+	Name      string `json:"name"`
+	Bytes     int64  `json:"bytes"`
+	Tier      string `json:"tier"`
+}
+
+// AccountCapacity breaks down the storage used by one account. Groups are
+// ordered from the largest down; Containers and ByPrefix hold the top ones
+// only when CapacityOptions.Top is set.
+type AccountCapacity struct {
+	URL          string              `json:"url"`
+	Blobs        int64               `json:"blobs"`
+	Bytes        int64               `json:"bytes"`
+	ByTier       []Size              `json:"byTier"`
+	ByBlobType   []Size              `json:"byBlobType"`
+	ByPrefix     []Size              `json:"byPrefix"`
+	IdleHot      Size                `json:"idleHot"`
+	Containers   []ContainerCapacity `json:"containers"`
+	LargestBlobs []BlobSize          `json:"largestBlobs,omitempty"`
+	Error        string              `json:"error,omitempty"`
+}
+
+// CapacityOptions shapes a capacity report.
+type CapacityOptions struct {
+	// Top limits the containers and prefixes reported per account to the
+	// largest ones; 0 reports all of them.
+	Top int
+	// Largest is the number of largest blobs reported per account.
+	Largest int
+	// PrefixDepth is the number of "/" separated segments of a blob name,
+	// after the container name, that make up its prefix.
+	PrefixDepth int
+	// IdleFor is how long a hot blob must go without being accessed, or
+	// modified when the account doesn't track access, to count as idle.
+	IdleFor time.Duration
+	// Versions and Snapshots include previous versions and snapshots, which
+	// are billed like any other blob.
+	Versions  bool
+	Snapshots bool
+}
+
+// Capacity sums the ContentLength of every blob of the storage accounts per
+// container, access tier, blob type and prefix. Results are in the order of
+// accounts; a failed account or container keeps whatever was summed before
+// the failure.
+func Capacity(ctx context.Context, scan *scanner.Scanner, accounts []config.Account, options CapacityOptions) ([]AccountCapacity, error) {
+	listing := *scan
+	listing.ListContainers = &azblob.ListContainersOptions{}
+	listing.ListBlobs = &azblob.ListBlobsFlatOptions{
+		Include: azblob.ListBlobsInclude{Versions: options.Versions, Snapshots: options.Snapshots},
+	}
+
+	idleSince := time.Now().Add(-options.IdleFor)
+
+	// tally holds the groups of one account as they are summed.
+	type tally struct {
+		total      Size
+		idleHot    Size
+		byTier     map[string]*Size
+		byBlobType map[string]*Size
+		byPrefix   map[string]*Size
+		containers map[string]*containerTally
+		largest    largestBlobs
+	}
+	tallies := make([]*tally, len(accounts))
+	for i := range tallies {
+		tallies[i] = &tally{
+			idleHot:    Size{Key: string(blob.AccessTierHot)},
+			byTier:     make(map[string]*Size),
+			byBlobType: make(map[string]*Size),
+			byPrefix:   make(map[string]*Size),
+			containers: make(map[string]*containerTally),
+		}
+	}
+
+	var mu sync.Mutex
+	err := listing.Scan(ctx, accounts, scanner.Callbacks{
+		Blob: func(_ context.Context, account *scanner.Account, containerName string, item *container.BlobItem) error {
+			var bytes int64
+			var lastUsed time.Time
+			tier, blobType := NoTier, ""
+			if props := item.Properties; props != nil {
+				lastUsed = lastAccess(props)
+				if props.ContentLength != nil {
+					bytes = *props.ContentLength
+				}
+				if props.AccessTier != nil {
+					tier = string(*props.AccessTier)
+				}
+				if props.BlobType != nil {
+					blobType = string(*props.BlobType)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			t := tallies[account.Index]
+			t.total.add(bytes)
+			group(t.byTier, tier).add(bytes)
+			group(t.byBlobType, blobType).add(bytes)
+			group(t.byPrefix, containerName+"/"+prefix(*item.Name, options.PrefixDepth)).add(bytes)
+
+			c := t.containers[containerName]
+			if c == nil {
+				c = &containerTally{idleHot: Size{Key: string(blob.AccessTierHot)}, byTier: make(map[string]*Size)}
+				t.containers[containerName] = c
+			}
+			c.total.add(bytes)
+			group(c.byTier, tier).add(bytes)
+			if tier == string(blob.AccessTierHot) && lastUsed.Before(idleSince) {
+				t.idleHot.add(bytes)
+				c.idleHot.add(bytes)
+			}
+
+			if options.Largest > 0 {
+				t.largest.offer(BlobSize{Container: containerName, Name: *item.Name, Bytes: bytes, Tier: tier}, options.Largest)
+			}
+			return nil
+		},
+		ContainerDone: func(account *scanner.Account, containerName string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			c := tallies[account.Index].containers[containerName]
+			if c == nil {
+				c = &containerTally{idleHot: Size{Key: string(blob.AccessTierHot)}, byTier: make(map[string]*Size)}
+				tallies[account.Index].containers[containerName] = c
+			}
+			if err != nil {
+				c.err = config.Redact(err.Error())
+			}
+		},
+	})
+
+	results := make([]AccountCapacity, len(accounts))
+	for i, account := range accounts {
+		t := tallies[i]
+		result := AccountCapacity{
+			URL:        account.String(),
+			Blobs:      t.total.Blobs,
+			Bytes:      t.total.Bytes,
+			ByTier:     sizes(t.byTier, 0),
+			ByBlobType: sizes(t.byBlobType, 0),
+			ByPrefix:   sizes(t.byPrefix, options.Top),
+			IdleHot:    t.idleHot,
+			Error:      scanner.Message(err, i),
+		}
+		for name, c := range t.containers {
+			result.Containers = append(result.Containers, ContainerCapacity{
+				Name:    name,
+				Blobs:   c.total.Blobs,
+				Bytes:   c.total.Bytes,
+				ByTier:  sizes(c.byTier, 0),
+				IdleHot: c.idleHot,
+				Error:   c.err,
+			})
+		}
+		sort.Slice(result.Containers, func(a, b int) bool {
+			ca, cb := result.Containers[a], result.Containers[b]
+			if ca.Bytes != cb.Bytes {
+				return ca.Bytes > cb.Bytes
+			}
+			return ca.Name < cb.Name
+		})
+		if options.Top > 0 && len(result.Containers) > options.Top {
+			result.Containers = result.Containers[:options.Top]
+		}
+		result.LargestBlobs = t.largest.sorted()
+		results[i] = result
+	}
+
+	return results, err
+}
+
+// containerTally holds the groups of one container as they are summed.
+type containerTally struct {
+	total   Size
+	idleHot Size
+	byTier  map[string]*Size
+	err     string
+}
+
+// lastAccess returns when a blob was last read or written: its last access
+// time when the account tracks it, and otherwise its last modified time.
+func lastAccess(props *container.BlobProperties) time.Time {
+	if props.LastAccessedOn != nil {
+		return *props.LastAccessedOn
+	}
+	if props.LastModified != nil {
+		return *props.LastModified
+	}
+	return time.Time{}
+}
+
+func (s *Size) add(bytes int64) {
+	s.Blobs++
+	s.Bytes += bytes
+}
+
+// group returns the group of key, adding it to groups when it is new.
+func group(groups map[string]*Size, key string) *Size {
+	size := groups[key]
+	if size == nil {
+		size = &Size{Key: key}
+		groups[key] = size
+	}
+	return size
+}
+
+// sizes returns the groups from the largest down, only the first top of them
+// when top is not 0.
+func sizes(groups map[string]*Size, top int) []Size {
+	result := make([]Size, 0, len(groups))
+	for _, size := range groups {
+		result = append(result, *size)
+	}
+	sort.Slice(result, func(a, b int) bool {
+		if result[a].Bytes != result[b].Bytes {
+			return result[a].Bytes > result[b].Bytes
+		}
+		return result[a].Key < result[b].Key
+	})
+	if top > 0 && len(result) > top {
+		result = result[:top]
+	}
+	return result
+}
+
+// prefix returns the first depth "/" separated segments of a blob name, with
+// their trailing "/"; a blob with fewer segments has the empty prefix.
+func prefix(name string, depth int) string {
+	end := 0
+	for range depth {
+		i := strings.IndexByte(name[end:], '/')
+		if i < 0 {
+			break
+		}
+		end += i + 1
+	}
+	return name[:end]
+}
+
+// largestBlobs keeps the largest blobs offered to it in a min-heap, so the
+// smallest of them is the one replaced.
+type largestBlobs []BlobSize
+
+func (h largestBlobs) Len() int           { return len(h) }
+func (h largestBlobs) Less(i, j int) bool { return h[i].Bytes < h[j].Bytes }
+func (h largestBlobs) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *largestBlobs) Push(x any)        { *h = append(*h, x.(BlobSize)) }
+func (h *largestBlobs) Pop() any {
+	old := *h
+	blob := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return blob
+}
+
+// offer keeps blob if it is among the n largest seen so far.
+func (h *largestBlobs) offer(blob BlobSize, n int) {
+	if h.Len() < n {
+		heap.Push(h, blob)
+		return
+	}
+	if blob.Bytes > (*h)[0].Bytes {
+		(*h)[0] = blob
+		heap.Fix(h, 0)
+	}
+}
+
+// sorted returns the blobs from the largest down.
+func (h largestBlobs) sorted() []BlobSize {
+	blobs := append([]BlobSize(nil), h...)
+	sort.Slice(blobs, func(a, b int) bool { return blobs[a].Bytes > blobs[b].Bytes })
+	return blobs
+}
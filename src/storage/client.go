@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"net/url"
+
+	"gowithazure/src/config"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+)
+
+// NewClient creates a blob service client for the storage account. Accounts
+// that carry an account key, SAS or connection string authenticate with it;
+// the others use credential, which may be nil when every account has its own.
+// See auth.NewCredential for building credential from the profile.
+func NewClient(account config.Account, credential func() (azcore.TokenCredential, error)) (*azblob.Client, error) {
+	return newClient(account, credential, nil)
+}
+
+// newClient is NewClient with options for the client's pipeline.
+func newClient(account config.Account, credential func() (azcore.TokenCredential, error), options *azblob.ClientOptions) (*azblob.Client, error) {
+	account, err := account.Resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case account.AccountKey != "":
+		sharedKey, err := azblob.NewSharedKeyCredential(account.AccountName, account.AccountKey)
+		if err != nil {
+			return nil, err
+		}
+		return azblob.NewClientWithSharedKeyCredential(account.URL, sharedKey, options)
+
+	case account.SAS != "":
+		// An account SAS works for every command; a container SAS only for
+		// commands that stay within that container.
+		return azblob.NewClientWithNoCredential(account.URL+"?"+account.SAS, options)
+
+	default:
+		tokenCredential, err := credential()
+		if err != nil {
+			return nil, err
+		}
+		return azblob.NewClient(account.URL, tokenCredential, options)
+	}
+}
+
+// Endpoint returns the URL of the account the client talks to with any SAS
+// removed, so it is safe to print.
+func Endpoint(client *azblob.Client) string {
+	u, err := url.Parse(client.URL())
+	if err != nil {
+		return client.URL()
+	}
+	u.RawQuery = ""
+	return u.String()
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"gowithazure/src/checkpoint"
+	"gowithazure/src/config"
+	"gowithazure/src/scanner"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+)
+
+// AccountCount holds the container and blob totals for a single storage account.
+type AccountCount struct {
+	URL          string           `json:"url"`
+	Containers   int              `json:"containers"`
+	Blobs        int              `json:"blobs"`
+	PerContainer []ContainerCount `json:"perContainer,omitempty"`
+	Error        string           `json:"error,omitempty"`
+}
+
+// ContainerCount holds the blob total for a single container. When the
+// container could not be listed to the end, Blobs is the partial count and
+// Error says why.
+type ContainerCount struct {
+	Name  string `json:"name"`
+	Blobs int    `json:"blobs"`
+	Error string `json:"error,omitempty"`
+}
+
+// countState is what Count has committed: the counts of every page that was
+// completed. It is what a checkpoint saves.
+type countState struct {
+	Accounts   []AccountCount               `json:"accounts"`
+	Containers []map[string]*ContainerCount `json:"containers,omitempty"`
+}
+
+// Count counts the containers of every storage account and, when blobs is
+// set, the blobs in each of their containers. Results are in the order of
+// accounts; a failed account or container keeps whatever was counted before
+// the failure. When progress is set the scan resumes from it and records its
+// counts in it.
+func Count(ctx context.Context, scan *scanner.Scanner, accounts []config.Account, blobs bool, progress *checkpoint.Checkpoint) ([]AccountCount, error) {
+	state := countState{
+		Accounts:   make([]AccountCount, len(accounts)),
+		Containers: make([]map[string]*ContainerCount, len(accounts)),
+	}
+	for i, account := range accounts {
+		state.Accounts[i].URL = account.String()
+		state.Containers[i] = make(map[string]*ContainerCount)
+	}
+
+	listing := *scan
+	if progress != nil {
+		if err := progress.Track(&state); err != nil {
+			return nil, err
+		}
+		listing.Progress = progress
+	}
+
+	// Counts are pending until their page is committed. The containers of an
+	// account are counted and committed by the goroutine of that account.
+	type key struct {
+		account   int
+		container string
+	}
+	var (
+		mu                sync.Mutex
+		pendingContainers = make([]int, len(accounts))
+		pendingBlobs      = make(map[key]int)
+		failed            = make(map[key]string)
+	)
+
+	callbacks := scanner.Callbacks{
+		Container: func(_ context.Context, account *scanner.Account, _ *service.ContainerItem) error {
+			pendingContainers[account.Index]++
+			return nil
+		},
+		ContainerPage: func(_ context.Context, account *scanner.Account, _ string) error {
+			state.Accounts[account.Index].Containers += pendingContainers[account.Index]
+			pendingContainers[account.Index] = 0
+			return nil
+		},
+	}
+	if blobs {
+		callbacks.Blob = func(_ context.Context, account *scanner.Account, containerName string, _ *container.BlobItem) error {
+			mu.Lock()
+			defer mu.Unlock()
+			pendingBlobs[key{account.Index, containerName}]++
+			return nil
+		}
+		callbacks.BlobPage = func(_ context.Context, account *scanner.Account, containerName string, _ string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			k := key{account.Index, containerName}
+			count := state.Containers[account.Index][containerName]
+			if count == nil {
+				count = &ContainerCount{Name: containerName}
+				state.Containers[account.Index][containerName] = count
+			}
+			count.Blobs += pendingBlobs[k]
+			state.Accounts[account.Index].Blobs += pendingBlobs[k]
+			delete(pendingBlobs, k)
+			return nil
+		}
+		callbacks.ContainerDone = func(account *scanner.Account, containerName string, err error) {
+			if err == nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			failed[key{account.Index, containerName}] = config.Redact(err.Error())
+		}
+	}
+
+	err := listing.Scan(ctx, accounts, callbacks)
+
+	// The results add what was counted on pages that did not complete to a
+	// copy of the state, which may still be saved to resume from.
+	results := make([]AccountCount, len(accounts))
+	perContainer := make([]map[string]ContainerCount, len(accounts))
+	for i := range results {
+		results[i] = state.Accounts[i]
+		results[i].Containers += pendingContainers[i]
+		results[i].Error = scanner.Message(err, i)
+		perContainer[i] = make(map[string]ContainerCount, len(state.Containers[i]))
+		for name, count := range state.Containers[i] {
+			perContainer[i][name] = *count
+		}
+	}
+	for k, blobs := range pendingBlobs {
+		results[k.account].Blobs += blobs
+		count := perContainer[k.account][k.container]
+		count.Name, count.Blobs = k.container, count.Blobs+blobs
+		perContainer[k.account][k.container] = count
+	}
+	for k, message := range failed {
+		count := perContainer[k.account][k.container]
+		count.Name, count.Error = k.container, message
+		perContainer[k.account][k.container] = count
+	}
+	for i := range results {
+		for _, count := range perContainer[i] {
+			results[i].PerContainer = append(results[i].PerContainer, count)
+		}
+		sort.Slice(results[i].PerContainer, func(a, b int) bool {
+			return results[i].PerContainer[a].Name < results[i].PerContainer[b].Name
+		})
+	}
+
+	return results, err
+}
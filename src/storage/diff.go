@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"sort"
+
+	"gowithazure/src/utility"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+)
+
+// DiffResult lists the containers and blobs that exist in a primary storage
+// account but not in its replica.
+type DiffResult struct {
+	Primary           string   `json:"primary"`
+	Secondary         string   `json:"secondary"`
+	PrimaryContainers int      `json:"primaryContainers"`
+	PrimaryBlobs      int      `json:"primaryBlobs"`
+	MissingContainers []string `json:"missingContainers"`
+	MissingBlobs      []string `json:"missingBlobs"`
+}
+
+// inventory holds the container names and "container/blob" paths of an account.
+type inventory struct {
+	containers map[string]bool
+	blobs      map[string]bool
+}
+
+// Diff compares the containers and blobs of the primary account against the
+// secondary and reports anything that has not been replicated.
+func Diff(ctx context.Context, primary, secondary *azblob.Client) (DiffResult, error) {
+	result := DiffResult{Primary: Endpoint(primary), Secondary: Endpoint(secondary)}
+
+	first, err := loadInventory(ctx, primary)
+	if err != nil {
+		return result, utility.Wrap(err, "reading %s", result.Primary)
+	}
+	second, err := loadInventory(ctx, secondary)
+	if err != nil {
+		return result, utility.Wrap(err, "reading %s", result.Secondary)
+	}
+
+	result.PrimaryContainers = len(first.containers)
+	result.PrimaryBlobs = len(first.blobs)
+
+	// Compare containers between the two accounts
+	for containerName := range first.containers {
+		if !second.containers[containerName] {
+			result.MissingContainers = append(result.MissingContainers, containerName)
+		}
+	}
+
+	// Compare blobs between the two accounts
+	for blobName := range first.blobs {
+		if !second.blobs[blobName] {
+			result.MissingBlobs = append(result.MissingBlobs, blobName)
+		}
+	}
+
+	sort.Strings(result.MissingContainers)
+	sort.Strings(result.MissingBlobs)
+
+	return result, nil
+}
+
+// loadInventory lists every container and blob in the storage account.
+func loadInventory(ctx context.Context, client *azblob.Client) (inventory, error) {
+	inv := inventory{containers: make(map[string]bool), blobs: make(map[string]bool)}
+
+	// Get a list of containers
+	containerPager := client.NewListContainersPager(nil)
+	for containerPager.More() {
+		page, err := containerPager.NextPage(ctx)
+		if err != nil {
+			return inv, utility.Wrap(err, "listing containers")
+		}
+
+		// Loop through the blobs in each container
+		for _, container := range page.ContainerItems {
+			inv.containers[*container.Name] = true
+
+			blobPager := client.NewListBlobsFlatPager(*container.Name, nil)
+			for blobPager.More() {
+				page, err := blobPager.NextPage(ctx)
+				if err != nil {
+					return inv, utility.Wrap(err, "listing blobs in container %s", *container.Name)
+				}
+
+				for _, blob := range page.Segment.BlobItems {
+					inv.blobs[*container.Name+"/"+*blob.Name] = true
+				}
+			}
+		}
+	}
+
+	return inv, nil
+}
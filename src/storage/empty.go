@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	"gowithazure/src/config"
+	"gowithazure/src/scanner"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+)
+
+// EmptyCount holds the total and empty container counts for a storage account.
+type EmptyCount struct {
+	URL             string `json:"url"`
+	TotalContainers int    `json:"totalContainers"`
+	EmptyContainers int    `json:"emptyContainers"`
+	Error           string `json:"error,omitempty"`
+}
+
+// CountEmpty counts the containers of every storage account that hold no
+// blobs. Each container is probed with a single-result listing to minimise
+// data retrieval; containers that could not be probed are not counted as empty.
+func CountEmpty(ctx context.Context, scan *scanner.Scanner, accounts []config.Account) ([]EmptyCount, error) {
+	results := make([]EmptyCount, len(accounts))
+	for i, account := range accounts {
+		results[i].URL = account.String()
+	}
+
+	// A container is empty when its probe succeeded without seeing a blob.
+	probe := *scan
+	maxResults := int32(1)
+	probe.ListBlobs = &azblob.ListBlobsFlatOptions{
+		Include:    azblob.ListBlobsInclude{Deleted: false},
+		MaxResults: &maxResults,
+	}
+
+	var mu sync.Mutex
+	nonEmpty := make(map[int]map[string]bool)
+	err := probe.Scan(ctx, accounts, scanner.Callbacks{
+		Container: func(_ context.Context, account *scanner.Account, _ *service.ContainerItem) error {
+			mu.Lock()
+			defer mu.Unlock()
+			results[account.Index].TotalContainers++
+			return nil
+		},
+		Blob: func(_ context.Context, account *scanner.Account, containerName string, _ *container.BlobItem) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if nonEmpty[account.Index] == nil {
+				nonEmpty[account.Index] = make(map[string]bool)
+			}
+			nonEmpty[account.Index][containerName] = true
+			return scanner.SkipContainer
+		},
+		ContainerDone: func(account *scanner.Account, containerName string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil && !nonEmpty[account.Index][containerName] {
+				results[account.Index].EmptyContainers++
+			}
+		},
+	})
+
+	for i := range results {
+		results[i].Error = scanner.Message(err, i)
+	}
+
+	return results, err
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gowithazure/src/config"
+	"gowithazure/src/scanner"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+)
+
+// ContainerInfo is the subset of container properties reported by ListContainers.
+type ContainerInfo struct {
+	Name         string    `json:"name"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// ListContainers calls fn for each container in the storage account, one page
+// at a time, so the full list is never held in memory.
+func ListContainers(ctx context.Context, scan *scanner.Scanner, account config.Account, fn func(ContainerInfo)) error {
+	return scan.Scan(ctx, []config.Account{account}, scanner.Callbacks{
+		Container: func(_ context.Context, _ *scanner.Account, item *service.ContainerItem) error {
+			fn(containerInfo(item))
+			return nil
+		},
+	})
+}
+
+// containerInfo extracts the ContainerInfo of a listed container.
+func containerInfo(item *service.ContainerItem) ContainerInfo {
+	info := ContainerInfo{Name: *item.Name}
+	if item.Properties != nil && item.Properties.LastModified != nil {
+		info.LastModified = *item.Properties.LastModified
+	}
+	return info
+}
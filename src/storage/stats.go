@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gowithazure/src/config"
+	"gowithazure/src/scanner"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+)
+
+// ContainerStats summarises the containers in a storage account by name
+// length and last modified time.
+type ContainerStats struct {
+	URL                string      `json:"url"`
+	TotalContainers    int         `json:"totalContainers"`
+	NameLengthCounts   map[int]int `json:"nameLengthCounts"`
+	OlderThanTwoYears  int         `json:"olderThanTwoYears"`
+	ModifiedLast30Days int         `json:"modifiedLast30Days"`
+	Error              string      `json:"error,omitempty"`
+}
+
+// Stats gathers ContainerStats for every storage account, in the order of
+// accounts.
+func Stats(ctx context.Context, scan *scanner.Scanner, accounts []config.Account) ([]ContainerStats, error) {
+	results := make([]ContainerStats, len(accounts))
+	for i, account := range accounts {
+		results[i] = ContainerStats{URL: account.String(), NameLengthCounts: make(map[int]int)}
+	}
+
+	twoYearsAgo := time.Now().AddDate(-2, 0, 0)
+	thirtyDaysAgo := time.Now().AddDate(0, -1, 0)
+
+	// Container callbacks of one account run in sequence, and each account
+	// only touches its own result.
+	err := scan.Scan(ctx, accounts, scanner.Callbacks{
+		Container: func(_ context.Context, account *scanner.Account, item *service.ContainerItem) error {
+			stats := &results[account.Index]
+			stats.TotalContainers++
+			stats.NameLengthCounts[len(*item.Name)]++
+
+			lastModified := containerInfo(item).LastModified
+			if lastModified.Before(twoYearsAgo) {
+				stats.OlderThanTwoYears++
+			}
+
+			if lastModified.After(thirtyDaysAgo) {
+				stats.ModifiedLast30Days++
+			}
+			return nil
+		},
+	})
+
+	for i := range results {
+		results[i].Error = scanner.Message(err, i)
+	}
+
+	return results, err
+}
@@ -0,0 +1,349 @@
+package storage
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"gowithazure/src/config"
+	"gowithazure/src/scanner"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+)
+
+// AccessTiers are the access tiers a blob can be moved between, from the
+// hottest down. The SDK predates the Cold tier, so it is named here, and
+// tiers are set at batchVersion rather than through the SDK.
+var AccessTiers = []string{
+	string(blob.AccessTierHot),
+	string(blob.AccessTierCool),
+	"Cold",
+	string(blob.AccessTierArchive),
+}
+
+// AgeBases are what the age of a blob is measured from: its last
+// modification, or its last access when the account tracks it.
+var AgeBases = []string{"modified", "access"}
+
+// TierChange records the outcome of changing the access tier of one blob.
+// In a dry run the change is only reported, never made.
+type TierChange struct {
+	Account   string `json:"account"`
+	Container string `json:"container"`
+	Blob      string `json:"blob"`
+	Bytes     int64  `json:"bytes"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	DryRun    bool   `json:"dryRun,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// TierOptions selects the blobs whose access tier Tier changes.
+type TierOptions struct {
+	// From is the tier the blobs are in and To the tier they are moved to.
+	From string
+	To   string
+	// Containers are path.Match patterns of the container names to include;
+	// none includes every container.
+	Containers []string
+	// Prefix limits the blobs to those whose name starts with it, and
+	// Pattern to those whose name matches it as a path.Match pattern.
+	Prefix  string
+	Pattern string
+	// OlderThan only moves blobs not modified, or not accessed when AgeBy is
+	// "access", for at least that long.
+	OlderThan time.Duration
+	AgeBy     string
+	// MinSize only moves blobs of at least that many bytes.
+	MinSize int64
+	// DryRun reports the blobs that would be moved without moving them.
+	DryRun bool
+	// BatchSize, when above 1, moves the blobs of a container in Blob Batch
+	// requests of up to that many blobs, at most MaxBatchSize, and otherwise
+	// one request per blob. Credential authorizes the requests like it does
+	// for NewClient.
+	BatchSize  int
+	Credential func() (azcore.TokenCredential, error)
+}
+
+// TierStats count the requests Tier made to change tiers: one per blob, or
+// one per batch, and the blobs retried after being throttled or failing
+// transiently.
+type TierStats struct {
+	Requests int64 `json:"requests"`
+	Retried  int64 `json:"retried"`
+}
+
+// Tier walks the containers of the storage accounts selected by options and
+// moves the block blobs that match from options.From to options.To. fn is
+// called with the outcome of every attempted change, never concurrently. A
+// failed change is reported to fn and does not stop the scan. Changes are made
+// as the blobs are listed, and batches are sent at the latest at the end of
+// each page, so a scan resumed from its Progress only revisits the blobs of
+// unfinished pages, which are no longer in options.From.
+func Tier(ctx context.Context, scan *scanner.Scanner, accounts []config.Account, options TierOptions, fn func(TierChange)) (TierStats, error) {
+	listing := *scan
+	listing.ListContainers = &azblob.ListContainersOptions{}
+	listing.ListBlobs = &azblob.ListBlobsFlatOptions{}
+	if options.Prefix != "" {
+		listing.ListBlobs.Prefix = &options.Prefix
+	}
+
+	cutoff := time.Now().Add(-options.OlderThan)
+
+	var (
+		mu    sync.Mutex
+		stats TierStats
+	)
+	report := func(changes ...TierChange) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, change := range changes {
+			fn(change)
+		}
+	}
+
+	batches := &tierBatches{
+		options:  options,
+		backoff:  scan.Backoff,
+		accounts: accounts,
+		clients:  make([]*batchClient, len(accounts)),
+		pending:  make(map[tierBatchKey][]TierChange),
+		stats:    &stats,
+		report:   report,
+	}
+	batching := options.BatchSize > 1 && !options.DryRun
+
+	callbacks := scanner.Callbacks{
+		Container: func(_ context.Context, _ *scanner.Account, item *service.ContainerItem) error {
+			if !MatchAny(options.Containers, *item.Name) {
+				return scanner.SkipContainer
+			}
+			return nil
+		},
+		Blob: func(ctx context.Context, account *scanner.Account, containerName string, item *container.BlobItem) error {
+			props := item.Properties
+			// Only block blobs have an access tier, and a blob being
+			// rehydrated has to finish first.
+			if props == nil || props.AccessTier == nil || !strings.EqualFold(string(*props.AccessTier), options.From) ||
+				props.BlobType == nil || *props.BlobType != blob.BlobTypeBlockBlob || props.ArchiveStatus != nil {
+				return nil
+			}
+			if options.Pattern != "" {
+				if ok, _ := path.Match(options.Pattern, *item.Name); !ok {
+					return nil
+				}
+			}
+			var bytes int64
+			if props.ContentLength != nil {
+				bytes = *props.ContentLength
+			}
+			if bytes < options.MinSize {
+				return nil
+			}
+			if options.OlderThan > 0 {
+				used := lastAccess(props)
+				if options.AgeBy != "access" && props.LastModified != nil {
+					used = *props.LastModified
+				}
+				if used.After(cutoff) {
+					return nil
+				}
+			}
+
+			change := TierChange{
+				Account:   account.URL,
+				Container: containerName,
+				Blob:      *item.Name,
+				Bytes:     bytes,
+				From:      string(*props.AccessTier),
+				To:        options.To,
+				DryRun:    options.DryRun,
+			}
+			switch {
+			case batching:
+				batches.add(ctx, account, containerName, change)
+				return nil
+			case !options.DryRun:
+				batches.send(ctx, account, containerName, []TierChange{change})
+				return nil
+			}
+			report(change)
+			return nil
+		},
+	}
+	if batching {
+		callbacks.BlobPage = func(ctx context.Context, account *scanner.Account, containerName, _ string) error {
+			batches.flush(ctx, account, containerName)
+			return nil
+		}
+		callbacks.ContainerDone = func(account *scanner.Account, containerName string, _ error) {
+			batches.flush(ctx, account, containerName)
+		}
+	}
+
+	err := listing.Scan(ctx, accounts, callbacks)
+	return stats, err
+}
+
+// tierBatchKey identifies the container a batch belongs to.
+type tierBatchKey struct {
+	account   int
+	container string
+}
+
+// tierBatches gathers the changes of each container into batches and sends
+// them, or sends each change alone when BatchSize is 1 or less. Changes are only
+// added by the walk of their container, so the batches of one container are
+// sent one after the other.
+type tierBatches struct {
+	options  TierOptions
+	backoff  scanner.Backoff
+	accounts []config.Account
+	report   func(...TierChange)
+
+	mu      sync.Mutex
+	clients []*batchClient
+	pending map[tierBatchKey][]TierChange
+	stats   *TierStats
+}
+
+// add queues a change and sends the batch of its container once it is full.
+func (b *tierBatches) add(ctx context.Context, account *scanner.Account, containerName string, change TierChange) {
+	key := tierBatchKey{account.Index, containerName}
+	b.mu.Lock()
+	b.pending[key] = append(b.pending[key], change)
+	full := len(b.pending[key]) >= min(b.options.BatchSize, MaxBatchSize)
+	b.mu.Unlock()
+	if full {
+		b.flush(ctx, account, containerName)
+	}
+}
+
+// flush sends the queued changes of a container, if any.
+func (b *tierBatches) flush(ctx context.Context, account *scanner.Account, containerName string) {
+	key := tierBatchKey{account.Index, containerName}
+	b.mu.Lock()
+	changes := b.pending[key]
+	delete(b.pending, key)
+	b.mu.Unlock()
+	if len(changes) == 0 {
+		return
+	}
+	b.send(ctx, account, containerName, changes)
+}
+
+// send moves the blobs of changes, all of one container, in one batch
+// request, or in a request of its own for a single change when BatchSize is
+// 1 or less, and reports them. Blobs throttled or failing transiently are
+// sent again with scan's backoff.
+func (b *tierBatches) send(ctx context.Context, account *scanner.Account, containerName string, changes []TierChange) {
+	client, err := b.client(account.Index)
+	if err != nil {
+		b.fail(changes, err)
+		return
+	}
+
+	// Send the request, then again with the blobs that were throttled or
+	// failed transiently until none are left or the retries are used up.
+	delay := b.backoff.Delay
+	retry := changes
+	for attempt := 0; ; attempt++ {
+		var errs []error
+		var err error
+		if b.options.BatchSize > 1 {
+			blobs := make([]string, len(retry))
+			for i, change := range retry {
+				blobs[i] = change.Blob
+			}
+			errs, err = client.setTiers(ctx, containerName, blobs, b.options.To)
+		} else {
+			errs = []error{client.setTier(ctx, containerName, retry[0].Blob, b.options.To)}
+		}
+		b.count(1, 0)
+		if err != nil {
+			errs = make([]error, len(retry))
+			for i := range errs {
+				errs[i] = err
+			}
+		}
+
+		var again []TierChange
+		var wait time.Duration
+		for i, err := range errs {
+			if err != nil && attempt < b.backoff.Retries && scanner.Retriable(err) {
+				again = append(again, retry[i])
+				wait = max(wait, scanner.RetryAfter(err))
+				continue
+			}
+			if err != nil {
+				retry[i].Error = config.Redact(err.Error())
+			}
+			b.report(retry[i])
+		}
+		if len(again) == 0 {
+			return
+		}
+
+		if wait == 0 {
+			wait = min(delay, b.backoff.MaxDelay)
+			delay *= 2
+		}
+		if err := scanner.Sleep(ctx, wait); err != nil {
+			b.fail(again, err)
+			return
+		}
+		b.count(0, int64(len(again)))
+		retry = again
+	}
+}
+
+// client returns the batch client of an account, creating it on first use.
+func (b *tierBatches) client(index int) (*batchClient, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.clients[index] == nil {
+		client, err := newBatchClient(b.accounts[index], b.options.Credential)
+		if err != nil {
+			return nil, err
+		}
+		b.clients[index] = client
+	}
+	return b.clients[index], nil
+}
+
+// fail reports every change as failed with err.
+func (b *tierBatches) fail(changes []TierChange, err error) {
+	for i := range changes {
+		changes[i].Error = config.Redact(err.Error())
+	}
+	b.report(changes...)
+}
+
+// count adds to the request statistics.
+func (b *tierBatches) count(requests, retried int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stats.Requests += requests
+	b.stats.Retried += retried
+}
+
+// MatchAny reports whether name matches one of patterns, or patterns is
+// empty.
+func MatchAny(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
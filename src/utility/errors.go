@@ -0,0 +1,199 @@
+// Package utility holds the error model shared by every command. Errors from
+// the Azure SDK are classified into a Kind, commands wrap them with context,
+// and the top-level reporter turns the Kind into a process exit code.
+package utility
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// Kind is the category of a failure.
+type Kind int
+
+const (
+	// KindUnknown is anything not otherwise classified.
+	KindUnknown Kind = iota
+	// KindUsage is a bad flag or argument.
+	KindUsage
+	// KindConfig is a missing or invalid profiles file.
+	KindConfig
+	// KindAuth is a failure to obtain or use a credential.
+	KindAuth
+	// KindPermissionDenied is an authenticated request that was not allowed.
+	KindPermissionDenied
+	// KindNotFound is a storage account, container or blob that doesn't exist.
+	KindNotFound
+	// KindThrottled is a request rejected because of rate limits.
+	KindThrottled
+	// KindTransient is a network failure or server error worth retrying.
+	KindTransient
+	// KindCanceled is a run interrupted by Ctrl-C or a deadline.
+	KindCanceled
+)
+
+// exitCodes maps each Kind to the exit code of the process.
+var exitCodes = map[Kind]int{
+	KindUnknown:          1,
+	KindUsage:            2,
+	KindConfig:           3,
+	KindAuth:             4,
+	KindPermissionDenied: 5,
+	KindNotFound:         6,
+	KindThrottled:        7,
+	KindTransient:        8,
+	KindCanceled:         130,
+}
+
+var kindNames = map[Kind]string{
+	KindUnknown:          "error",
+	KindUsage:            "usage error",
+	KindConfig:           "config error",
+	KindAuth:             "authentication failed",
+	KindPermissionDenied: "permission denied",
+	KindNotFound:         "not found",
+	KindThrottled:        "throttled",
+	KindTransient:        "transient network error",
+	KindCanceled:         "canceled",
+}
+
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// ExitCode returns the process exit code for k.
+func (k Kind) ExitCode() int {
+	return exitCodes[k]
+}
+
+// Error is an error with a Kind and optional context.
+type Error struct {
+	Kind Kind
+	// Message describes what was being done, e.g. "listing containers in x".
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Message == "":
+		return e.Err.Error()
+	case e.Err == nil:
+		return e.Message
+	default:
+		return e.Message + ": " + e.Err.Error()
+	}
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New returns an error of the given kind.
+func New(kind Kind, format string, args ...any) error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+// Wrap adds context to err and records its Kind, classifying it if it has
+// none yet. It returns nil when err is nil.
+func Wrap(err error, format string, args ...any) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: KindOf(err), Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+// WithKind marks err as kind, overriding any classification. It returns nil
+// when err is nil.
+func WithKind(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// KindOf returns the Kind of err: the Kind of the outermost *Error in its
+// chain, or else a classification of the underlying SDK or network error.
+func KindOf(err error) Kind {
+	if err == nil {
+		return KindUnknown
+	}
+
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed.Kind
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return KindCanceled
+	}
+
+	var authFailed *azidentity.AuthenticationFailedError
+	if errors.As(err, &authFailed) {
+		return KindAuth
+	}
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		return classifyResponse(respErr)
+	}
+
+	// azidentity's credentialUnavailableError is unexported, and the bearer
+	// token policy wraps credential failures; both mark themselves as not
+	// worth retrying.
+	var nonRetriable interface{ NonRetriable() }
+	if errors.As(err, &nonRetriable) {
+		return KindAuth
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return KindTransient
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return KindTransient
+	}
+
+	return KindUnknown
+}
+
+// classifyResponse maps an HTTP failure from the storage service to a Kind.
+func classifyResponse(respErr *azcore.ResponseError) Kind {
+	switch respErr.ErrorCode {
+	case "AuthenticationFailed", "InvalidAuthenticationInfo", "NoAuthenticationInformation":
+		return KindAuth
+	case "AuthorizationFailure", "AuthorizationPermissionMismatch", "AuthorizationSourceIPMismatch",
+		"AuthorizationProtocolMismatch", "AuthorizationResourceTypeMismatch", "AuthorizationServiceMismatch":
+		return KindPermissionDenied
+	case "ServerBusy", "OperationTimedOut":
+		return KindThrottled
+	}
+
+	switch code := respErr.StatusCode; {
+	case code == http.StatusUnauthorized:
+		return KindAuth
+	case code == http.StatusForbidden:
+		return KindPermissionDenied
+	case code == http.StatusNotFound:
+		return KindNotFound
+	case code == http.StatusTooManyRequests:
+		return KindThrottled
+	case code == http.StatusRequestTimeout || code >= 500:
+		return KindTransient
+	}
+	return KindUnknown
+}
+
+// ExitCode returns the process exit code for err, 0 when err is nil.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	return KindOf(err).ExitCode()
+}
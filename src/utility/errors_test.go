@@ -0,0 +1,90 @@
+package utility
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// nonRetriable is an error marking itself as not worth retrying, like the
+// credential failures of azidentity.
+type nonRetriable struct{}
+
+func (nonRetriable) Error() string { return "no credential available" }
+func (nonRetriable) NonRetriable() {}
+
+func TestKindOf(t *testing.T) {
+	response := func(status int, code string) error {
+		return fmt.Errorf("listing containers: %w", &azcore.ResponseError{StatusCode: status, ErrorCode: code})
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		kind Kind
+		exit int
+	}{
+		{"nil", nil, KindUnknown, 0},
+		{"plain", errors.New("boom"), KindUnknown, 1},
+		{"AuthenticationFailed", response(http.StatusForbidden, "AuthenticationFailed"), KindAuth, 4},
+		{"InvalidAuthenticationInfo", response(http.StatusBadRequest, "InvalidAuthenticationInfo"), KindAuth, 4},
+		{"AuthorizationPermissionMismatch", response(http.StatusForbidden, "AuthorizationPermissionMismatch"), KindPermissionDenied, 5},
+		{"AuthorizationSourceIPMismatch", response(http.StatusForbidden, "AuthorizationSourceIPMismatch"), KindPermissionDenied, 5},
+		{"ServerBusy", response(http.StatusServiceUnavailable, "ServerBusy"), KindThrottled, 7},
+		{"OperationTimedOut", response(http.StatusInternalServerError, "OperationTimedOut"), KindThrottled, 7},
+		{"401", response(http.StatusUnauthorized, ""), KindAuth, 4},
+		{"403", response(http.StatusForbidden, ""), KindPermissionDenied, 5},
+		{"404", response(http.StatusNotFound, "ContainerNotFound"), KindNotFound, 6},
+		{"429", response(http.StatusTooManyRequests, ""), KindThrottled, 7},
+		{"408", response(http.StatusRequestTimeout, ""), KindTransient, 8},
+		{"502", response(http.StatusBadGateway, ""), KindTransient, 8},
+		{"409", response(http.StatusConflict, "ContainerBeingDeleted"), KindUnknown, 1},
+		{"credential", &azidentity.AuthenticationFailedError{}, KindAuth, 4},
+		{"unavailable credential", fmt.Errorf("getting a token: %w", nonRetriable{}), KindAuth, 4},
+		{"network", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, KindTransient, 8},
+		{"dns", &net.DNSError{Err: "no such host", Name: "x.blob.core.windows.net"}, KindTransient, 8},
+		{"canceled", fmt.Errorf("scan: %w", context.Canceled), KindCanceled, 130},
+		{"deadline", context.DeadlineExceeded, KindCanceled, 130},
+		{"new", New(KindUsage, "bad flag %s", "--x"), KindUsage, 2},
+		{"wrapped", Wrap(response(http.StatusNotFound, ""), "container %s", "c"), KindNotFound, 6},
+		{"rewrapped", fmt.Errorf("outer: %w", Wrap(New(KindConfig, "no profiles"), "loading")), KindConfig, 3},
+		{"with kind", WithKind(KindConfig, response(http.StatusForbidden, "")), KindConfig, 3},
+	}
+	for _, test := range tests {
+		if kind := KindOf(test.err); kind != test.kind {
+			t.Errorf("%s: KindOf = %s, want %s", test.name, kind, test.kind)
+		}
+		if exit := ExitCode(test.err); exit != test.exit {
+			t.Errorf("%s: ExitCode = %d, want %d", test.name, exit, test.exit)
+		}
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	cause := errors.New("connection reset")
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{Wrap(cause, "listing containers in %s", "a"), "listing containers in a: connection reset"},
+		{New(KindUsage, "expected %d arguments", 2), "expected 2 arguments"},
+		{WithKind(KindTransient, cause), "connection reset"},
+	}
+	for _, test := range tests {
+		if got := test.err.Error(); got != test.want {
+			t.Errorf("Error() = %q, want %q", got, test.want)
+		}
+	}
+	if Wrap(nil, "x") != nil || WithKind(KindAuth, nil) != nil {
+		t.Error("wrapping nil returned an error")
+	}
+	if !errors.Is(Wrap(cause, "x"), cause) {
+		t.Error("Wrap hides its cause from errors.Is")
+	}
+}
@@ -0,0 +1,37 @@
+package utility
+
+import (
+	"fmt"
+	"io"
+)
+
+// Report writes err to w in the form every command shares, passing the
+// message through redact first, and returns the exit code for it.
+func Report(w io.Writer, err error, redact func(string) string) int {
+	if err == nil {
+		return 0
+	}
+
+	kind := KindOf(err)
+	message := redact(err.Error())
+	if kind == KindUnknown {
+		fmt.Fprintf(w, "Error: %s\n", message)
+	} else {
+		fmt.Fprintf(w, "Error (%s): %s\n", kind, message)
+	}
+	if hint := hints[kind]; hint != "" {
+		fmt.Fprintf(w, "Hint: %s\n", hint)
+	}
+
+	return kind.ExitCode()
+}
+
+// hints suggest the usual fix for each kind of failure.
+var hints = map[Kind]string{
+	KindUsage:            "run with --help for usage",
+	KindConfig:           "run 'gowithazure config validate' to list every problem in the profiles file",
+	KindAuth:             "check the credentials section of the profile, or run 'az login'",
+	KindPermissionDenied: "the identity needs a data plane role such as Storage Blob Data Reader on the account",
+	KindThrottled:        "lower --concurrency and try again",
+	KindTransient:        "check network access to the account and try again",
+}
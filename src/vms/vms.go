@@ -1,11 +1,12 @@
-package main
+// Package vms lists the virtual machines across Azure subscriptions.
+package vms
 
 import (
 	"bufio"
 	"context"
 	"encoding/csv"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -13,7 +14,7 @@ import (
 	"strings"
 	"time"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/subscription/armsubscription"
@@ -47,26 +48,15 @@ type Subscription struct {
 	Name string
 }
 
-func main() {
-	// Create a context for the API calls with a timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
-
-	// Authenticate to Azure
-	fmt.Println("Authenticating to Azure...")
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
-	if err != nil {
-		log.Fatalf("Failed to obtain Azure credential: %v", err)
-	}
-
+// ListSubscriptions returns every subscription visible to the credential.
+func ListSubscriptions(ctx context.Context, cred azcore.TokenCredential) ([]Subscription, error) {
 	// Create a client for subscription operations
 	subClient, err := armsubscription.NewSubscriptionsClient(cred, nil)
 	if err != nil {
-		log.Fatalf("Failed to create subscription client: %v", err)
+		return nil, fmt.Errorf("failed to create subscription client: %w", err)
 	}
 
 	// Get all subscriptions
-	fmt.Println("Fetching all subscriptions...")
 	pager := subClient.NewListPager(nil)
 
 	// Store all subscriptions
@@ -76,7 +66,7 @@ func main() {
 	for pager.More() {
 		page, err := pager.NextPage(ctx)
 		if err != nil {
-			log.Fatalf("Failed to get subscriptions: %v", err)
+			return nil, fmt.Errorf("failed to get subscriptions: %w", err)
 		}
 
 		for _, sub := range page.Value {
@@ -87,32 +77,23 @@ func main() {
 		}
 	}
 
-	// Display subscriptions and let user select
-	selectedSubscriptions := selectSubscriptions(allSubscriptions)
-
-	if len(selectedSubscriptions) == 0 {
-		fmt.Println("No subscriptions selected. Exiting.")
-		return
-	}
+	return allSubscriptions, nil
+}
 
+// ListVMs collects the virtual machines in the selected subscriptions. When
+// detailed is set the network interfaces are resolved to their private and
+// public IP addresses, which takes longer. Progress is written to log.
+func ListVMs(ctx context.Context, cred azcore.TokenCredential, subscriptions []Subscription, detailed bool, log io.Writer) []VM {
 	var allVMs []VM
 
-	// Ask if user wants to collect detailed network information
-	fmt.Println("\nCollect detailed network information? This may take longer. (y/n):")
-	reader := bufio.NewReader(os.Stdin)
-	collectNetworkInfo, _ := reader.ReadString('\n')
-	collectNetworkInfo = strings.TrimSpace(collectNetworkInfo)
-	collectNetworkInfo = strings.ToLower(collectNetworkInfo)
-	getDetailedNetworkInfo := collectNetworkInfo == "y" || collectNetworkInfo == "yes"
-
 	// Process selected subscriptions
-	for _, sub := range selectedSubscriptions {
-		fmt.Printf("Processing subscription: %s (%s)\n", sub.Name, sub.ID)
+	for _, sub := range subscriptions {
+		fmt.Fprintf(log, "Processing subscription: %s (%s)\n", sub.Name, sub.ID)
 
 		// Create a client for VM operations in this subscription
 		vmClient, err := armcompute.NewVirtualMachinesClient(sub.ID, cred, nil)
 		if err != nil {
-			log.Printf("Failed to create VM client for subscription %s: %v", sub.ID, err)
+			fmt.Fprintf(log, "Failed to create VM client for subscription %s: %v\n", sub.ID, err)
 			continue
 		}
 
@@ -120,127 +101,26 @@ func main() {
 		vmPager := vmClient.NewListAllPager(nil)
 
 		for vmPager.More() {
-			fmt.Println("Fetching next page of VMs...")
+			fmt.Fprintln(log, "Fetching next page of VMs...")
 			vmPage, err := vmPager.NextPage(ctx)
 			if err != nil {
-				log.Printf("Failed to get VMs for subscription %s: %v", sub.ID, err)
+				fmt.Fprintf(log, "Failed to get VMs for subscription %s: %v\n", sub.ID, err)
 				break
 			}
 
-			fmt.Printf("Found %d VMs in this page\n", len(vmPage.Value))
+			fmt.Fprintf(log, "Found %d VMs in this page\n", len(vmPage.Value))
 			for i, virtualMachine := range vmPage.Value {
-				fmt.Printf("Processing VM %d/%d: %s\n", i+1, len(vmPage.Value), *virtualMachine.Name)
-
-				vm := VM{
-					Name:             *virtualMachine.Name,
-					ResourceGroup:    extractResourceGroup(*virtualMachine.ID),
-					Location:         *virtualMachine.Location,
-					SubscriptionID:   sub.ID,
-					SubscriptionName: sub.Name,
-					Tags:             make(map[string]string),
-				}
-
-				// Get VM size
-				if virtualMachine.Properties != nil && virtualMachine.Properties.HardwareProfile != nil && virtualMachine.Properties.HardwareProfile.VMSize != nil {
-					vm.VMSize = string(*virtualMachine.Properties.HardwareProfile.VMSize)
-				}
-
-				// Get OS type
-				if virtualMachine.Properties != nil && virtualMachine.Properties.StorageProfile != nil && virtualMachine.Properties.StorageProfile.OSDisk != nil && virtualMachine.Properties.StorageProfile.OSDisk.OSType != nil {
-					vm.OSType = string(*virtualMachine.Properties.StorageProfile.OSDisk.OSType)
-				}
-
-				// Get OS details
-				if virtualMachine.Properties != nil && virtualMachine.Properties.StorageProfile != nil &&
-					virtualMachine.Properties.StorageProfile.ImageReference != nil {
-					imgRef := virtualMachine.Properties.StorageProfile.ImageReference
-
-					if imgRef.Offer != nil {
-						vm.OSName = *imgRef.Offer
-					}
-
-					if imgRef.SKU != nil {
-						vm.OSVersion = *imgRef.SKU
-					}
-
-					// Combine publisher and offer for a more complete OS name
-					if imgRef.Publisher != nil {
-						vm.OSName = *imgRef.Publisher + ":" + vm.OSName
-					}
-				}
-
-				// Get availability set if available
-				if virtualMachine.Properties != nil && virtualMachine.Properties.AvailabilitySet != nil &&
-					virtualMachine.Properties.AvailabilitySet.ID != nil {
-					vm.AvailabilitySet = *virtualMachine.Properties.AvailabilitySet.ID
-				}
+				fmt.Fprintf(log, "Processing VM %d/%d: %s\n", i+1, len(vmPage.Value), *virtualMachine.Name)
 
-				// Get data disks
-				if virtualMachine.Properties != nil && virtualMachine.Properties.StorageProfile != nil &&
-					virtualMachine.Properties.StorageProfile.DataDisks != nil {
-					for _, disk := range virtualMachine.Properties.StorageProfile.DataDisks {
-						if disk.Name != nil {
-							vm.DataDisks = append(vm.DataDisks, *disk.Name)
-						}
-					}
-				}
-
-				// Get boot diagnostics status
-				if virtualMachine.Properties != nil && virtualMachine.Properties.DiagnosticsProfile != nil &&
-					virtualMachine.Properties.DiagnosticsProfile.BootDiagnostics != nil {
-					if virtualMachine.Properties.DiagnosticsProfile.BootDiagnostics.Enabled != nil {
-						if *virtualMachine.Properties.DiagnosticsProfile.BootDiagnostics.Enabled {
-							vm.BootDiagnostics = "Enabled"
-						} else {
-							vm.BootDiagnostics = "Disabled"
-						}
-					}
-				}
-
-				// Get tags
-				if virtualMachine.Tags != nil {
-					for k, v := range virtualMachine.Tags {
-						if v != nil {
-							vm.Tags[k] = *v
-						} else {
-							vm.Tags[k] = ""
-						}
-					}
-				}
-
-				// Get admin username
-				if virtualMachine.Properties != nil && virtualMachine.Properties.OSProfile != nil && virtualMachine.Properties.OSProfile.AdminUsername != nil {
-					vm.AdminUsername = *virtualMachine.Properties.OSProfile.AdminUsername
-				}
-
-				// Get VM ID
-				if virtualMachine.ID != nil {
-					// We don't store VMId anymore
-				}
-
-				// Get power state
-				vmInstanceViewCtx, vmInstanceViewCancel := context.WithTimeout(ctx, 10*time.Second)
-				defer vmInstanceViewCancel()
-
-				vmInstanceView, err := vmClient.InstanceView(vmInstanceViewCtx, vm.ResourceGroup, vm.Name, nil)
-				if err != nil {
-					fmt.Printf("Warning: Failed to get instance view for VM %s: %v\n", vm.Name, err)
-				} else if vmInstanceView.Statuses != nil {
-					for _, status := range vmInstanceView.Statuses {
-						if status.Code != nil && strings.HasPrefix(*status.Code, "PowerState") {
-							// We don't store PowerState anymore
-							break
-						}
-					}
-				}
+				vm := newVM(sub, virtualMachine)
 
 				// Only get network info if user opted for it
-				if getDetailedNetworkInfo {
-					// Get network interfaces and IP addresses with a timeout
-					fmt.Printf("Getting network info for VM: %s\n", vm.Name)
+				if detailed {
+					// Get network interfaces and IP addresses
+					fmt.Fprintf(log, "Getting network info for VM: %s\n", vm.Name)
 					err = getVMNetworkInfo(ctx, cred, &vm, virtualMachine)
 					if err != nil {
-						log.Printf("Warning: Failed to get network info for VM %s: %v", vm.Name, err)
+						fmt.Fprintf(log, "Warning: Failed to get network info for VM %s: %v\n", vm.Name, err)
 					}
 				} else {
 					// Just collect the network interface IDs without detailed info
@@ -256,49 +136,119 @@ func main() {
 
 				// Extract just the name from network interfaces
 				for i, nic := range vm.NetworkInterfaces {
-					parts := strings.Split(nic, "/")
-					if len(parts) > 0 {
-						vm.NetworkInterfaces[i] = parts[len(parts)-1]
-					}
+					vm.NetworkInterfaces[i] = extractResourceName(nic)
 				}
 
 				// Extract just the name from availability set
 				if vm.AvailabilitySet != "" {
-					parts := strings.Split(vm.AvailabilitySet, "/")
-					if len(parts) > 0 {
-						vm.AvailabilitySet = parts[len(parts)-1]
-					}
+					vm.AvailabilitySet = extractResourceName(vm.AvailabilitySet)
 				}
 
 				allVMs = append(allVMs, vm)
-				fmt.Printf("Completed processing VM: %s\n", vm.Name)
+				fmt.Fprintf(log, "Completed processing VM: %s\n", vm.Name)
 			}
 		}
 	}
 
-	fmt.Printf("Processing complete. Found %d VMs total.\n", len(allVMs))
-
 	// Sort VMs by name in descending order
 	sort.Slice(allVMs, func(i, j int) bool {
 		return allVMs[i].Name > allVMs[j].Name
 	})
 
-	// Print the results with improved formatting
-	printVMTable(allVMs)
-
-	// Export to CSV
-	exportToCSV(allVMs)
+	return allVMs
 }
 
-// printVMTable prints the VM list in a clean, formatted table
-func printVMTable(vms []VM) {
-	// Sort VMs by name in descending order
-	sort.Slice(vms, func(i, j int) bool {
-		return vms[i].Name > vms[j].Name
-	})
+// newVM copies the properties we report on out of the SDK model.
+func newVM(sub Subscription, virtualMachine *armcompute.VirtualMachine) VM {
+	vm := VM{
+		Name:             *virtualMachine.Name,
+		ResourceGroup:    extractResourceGroup(*virtualMachine.ID),
+		Location:         *virtualMachine.Location,
+		SubscriptionID:   sub.ID,
+		SubscriptionName: sub.Name,
+		Tags:             make(map[string]string),
+	}
+
+	// Get VM size
+	if virtualMachine.Properties != nil && virtualMachine.Properties.HardwareProfile != nil && virtualMachine.Properties.HardwareProfile.VMSize != nil {
+		vm.VMSize = string(*virtualMachine.Properties.HardwareProfile.VMSize)
+	}
+
+	// Get OS type
+	if virtualMachine.Properties != nil && virtualMachine.Properties.StorageProfile != nil && virtualMachine.Properties.StorageProfile.OSDisk != nil && virtualMachine.Properties.StorageProfile.OSDisk.OSType != nil {
+		vm.OSType = string(*virtualMachine.Properties.StorageProfile.OSDisk.OSType)
+	}
+
+	// Get OS details
+	if virtualMachine.Properties != nil && virtualMachine.Properties.StorageProfile != nil &&
+		virtualMachine.Properties.StorageProfile.ImageReference != nil {
+		imgRef := virtualMachine.Properties.StorageProfile.ImageReference
 
+		if imgRef.Offer != nil {
+			vm.OSName = *imgRef.Offer
+		}
+
+		if imgRef.SKU != nil {
+			vm.OSVersion = *imgRef.SKU
+		}
+
+		// Combine publisher and offer for a more complete OS name
+		if imgRef.Publisher != nil {
+			vm.OSName = *imgRef.Publisher + ":" + vm.OSName
+		}
+	}
+
+	// Get availability set if available
+	if virtualMachine.Properties != nil && virtualMachine.Properties.AvailabilitySet != nil &&
+		virtualMachine.Properties.AvailabilitySet.ID != nil {
+		vm.AvailabilitySet = *virtualMachine.Properties.AvailabilitySet.ID
+	}
+
+	// Get data disks
+	if virtualMachine.Properties != nil && virtualMachine.Properties.StorageProfile != nil &&
+		virtualMachine.Properties.StorageProfile.DataDisks != nil {
+		for _, disk := range virtualMachine.Properties.StorageProfile.DataDisks {
+			if disk.Name != nil {
+				vm.DataDisks = append(vm.DataDisks, *disk.Name)
+			}
+		}
+	}
+
+	// Get boot diagnostics status
+	if virtualMachine.Properties != nil && virtualMachine.Properties.DiagnosticsProfile != nil &&
+		virtualMachine.Properties.DiagnosticsProfile.BootDiagnostics != nil {
+		if virtualMachine.Properties.DiagnosticsProfile.BootDiagnostics.Enabled != nil {
+			if *virtualMachine.Properties.DiagnosticsProfile.BootDiagnostics.Enabled {
+				vm.BootDiagnostics = "Enabled"
+			} else {
+				vm.BootDiagnostics = "Disabled"
+			}
+		}
+	}
+
+	// Get tags
+	if virtualMachine.Tags != nil {
+		for k, v := range virtualMachine.Tags {
+			if v != nil {
+				vm.Tags[k] = *v
+			} else {
+				vm.Tags[k] = ""
+			}
+		}
+	}
+
+	// Get admin username
+	if virtualMachine.Properties != nil && virtualMachine.Properties.OSProfile != nil && virtualMachine.Properties.OSProfile.AdminUsername != nil {
+		vm.AdminUsername = *virtualMachine.Properties.OSProfile.AdminUsername
+	}
+
+	return vm
+}
+
+// PrintVMTable prints the VM list in a clean, formatted table
+func PrintVMTable(w io.Writer, vms []VM) {
 	// Create a new table
-	table := tablewriter.NewWriter(os.Stdout)
+	table := tablewriter.NewWriter(w)
 	table.SetHeader([]string{
 		"Name", "Resource Group", "Location", "Subscription", "VM Size", "OS Type",
 		"OS Name", "OS Version", "Admin Username", "Network Interfaces", "Availability Set",
@@ -325,14 +275,14 @@ func printVMTable(vms []VM) {
 	}
 
 	// Print the table
-	fmt.Println("\nSummary of all virtual machines (sorted by name in descending order):")
+	fmt.Fprintln(w, "\nSummary of all virtual machines (sorted by name in descending order):")
 	table.Render()
 }
 
-// selectSubscriptions displays all subscriptions and lets the user select which ones to process
-func selectSubscriptions(subscriptions []Subscription) []Subscription {
+// SelectSubscriptions displays all subscriptions on out and lets the user select which ones to process
+func SelectSubscriptions(subscriptions []Subscription, in *bufio.Reader, out io.Writer) []Subscription {
 	// Create a new table
-	table := tablewriter.NewWriter(os.Stdout)
+	table := tablewriter.NewWriter(out)
 	table.SetHeader([]string{"#", "Subscription Name", "Subscription ID"})
 
 	// Add subscription data to the table
@@ -345,17 +295,16 @@ func selectSubscriptions(subscriptions []Subscription) []Subscription {
 	}
 
 	// Print the table
-	fmt.Println("\nAvailable Subscriptions:")
+	fmt.Fprintln(out, "\nAvailable Subscriptions:")
 	table.Render()
 
-	fmt.Println("\nSelect subscriptions to process:")
-	fmt.Println("  - Enter comma-separated numbers (e.g., \"1,3,5\") for specific subscriptions")
-	fmt.Println("  - Enter \"a\" for all subscriptions")
-	fmt.Println("  - Enter \"q\" to quit")
-	fmt.Print("\nYour selection: ")
+	fmt.Fprintln(out, "\nSelect subscriptions to process:")
+	fmt.Fprintln(out, "  - Enter comma-separated numbers (e.g., \"1,3,5\") for specific subscriptions")
+	fmt.Fprintln(out, "  - Enter \"a\" for all subscriptions")
+	fmt.Fprintln(out, "  - Enter \"q\" to quit")
+	fmt.Fprint(out, "\nYour selection: ")
 
-	reader := bufio.NewReader(os.Stdin)
-	input, _ := reader.ReadString('\n')
+	input, _ := in.ReadString('\n')
 	input = strings.TrimSpace(input)
 
 	// Check for quit
@@ -376,7 +325,7 @@ func selectSubscriptions(subscriptions []Subscription) []Subscription {
 		sel = strings.TrimSpace(sel)
 		idx, err := strconv.Atoi(sel)
 		if err != nil {
-			fmt.Printf("Invalid selection: %s (skipping)\n", sel)
+			fmt.Fprintf(out, "Invalid selection: %s (skipping)\n", sel)
 			continue
 		}
 
@@ -386,7 +335,7 @@ func selectSubscriptions(subscriptions []Subscription) []Subscription {
 		if idx >= 0 && idx < len(subscriptions) {
 			selected = append(selected, subscriptions[idx])
 		} else {
-			fmt.Printf("Selection out of range: %s (skipping)\n", sel)
+			fmt.Fprintf(out, "Selection out of range: %s (skipping)\n", sel)
 		}
 	}
 
@@ -406,7 +355,7 @@ func extractResourceGroup(vmID string) string {
 }
 
 // getVMNetworkInfo retrieves network interfaces and IP addresses for a VM
-func getVMNetworkInfo(ctx context.Context, cred *azidentity.DefaultAzureCredential, vm *VM, vmResource *armcompute.VirtualMachine) error {
+func getVMNetworkInfo(ctx context.Context, cred azcore.TokenCredential, vm *VM, vmResource *armcompute.VirtualMachine) error {
 	// Skip if no network interfaces
 	if vmResource.Properties == nil || vmResource.Properties.NetworkProfile == nil || vmResource.Properties.NetworkProfile.NetworkInterfaces == nil {
 		return nil
@@ -497,14 +446,9 @@ func extractResourceName(resourceID string) string {
 	return parts[len(parts)-1]
 }
 
-// exportToCSV exports VM data to a CSV file
-func exportToCSV(vms []VM) {
-	fmt.Println("\nExporting VM data to CSV...")
-
-	if len(vms) == 0 {
-		fmt.Println("No VMs to export.")
-		return
-	}
+// ExportCSV exports VM data to a timestamped CSV file in the current
+// directory and returns its absolute path.
+func ExportCSV(vms []VM, log io.Writer) (string, error) {
 
 	// Create a timestamp for the filename
 	timestamp := time.Now().Format("20060102-150405")
@@ -513,8 +457,7 @@ func exportToCSV(vms []VM) {
 	// Create the CSV file
 	file, err := os.Create(filename)
 	if err != nil {
-		fmt.Printf("Error creating CSV file: %v\n", err)
-		return
+		return "", fmt.Errorf("error creating CSV file: %w", err)
 	}
 	defer file.Close()
 
@@ -531,8 +474,7 @@ func exportToCSV(vms []VM) {
 	}
 
 	if err := writer.Write(header); err != nil {
-		fmt.Printf("Error writing CSV header: %v\n", err)
-		return
+		return "", fmt.Errorf("error writing CSV header: %w", err)
 	}
 
 	// Track successful writes
@@ -540,8 +482,6 @@ func exportToCSV(vms []VM) {
 
 	// Write VM data
 	for _, vm := range vms {
-		fmt.Printf("Writing VM to CSV: %s\n", vm.Name)
-
 		// Convert slices to comma-separated strings
 		privateIPs := strings.Join(vm.PrivateIPs, ", ")
 		publicIPs := strings.Join(vm.PublicIPs, ", ")
@@ -578,7 +518,7 @@ func exportToCSV(vms []VM) {
 
 		// Write the record
 		if err := writer.Write(record); err != nil {
-			fmt.Printf("Error writing VM %s to CSV: %v\n", vm.Name, err)
+			fmt.Fprintf(log, "Error writing VM %s to CSV: %v\n", vm.Name, err)
 			continue
 		}
 
@@ -588,7 +528,7 @@ func exportToCSV(vms []VM) {
 	// Flush the writer to ensure all data is written
 	writer.Flush()
 	if err := writer.Error(); err != nil {
-		fmt.Printf("Error flushing CSV writer: %v\n", err)
+		return "", fmt.Errorf("error flushing CSV writer: %w", err)
 	}
 
 	// Get absolute path for better user feedback
@@ -597,55 +537,7 @@ func exportToCSV(vms []VM) {
 		absPath = filename // Fallback to relative path
 	}
 
-	fmt.Printf("\nSuccessfully exported %d/%d VMs to CSV file: %s\n", successCount, len(vms), absPath)
-}
-
-// printSubscriptionTable prints the subscription list in a clean, formatted table
-func printSubscriptionTable(subs []Subscription) {
-	if len(subs) == 0 {
-		fmt.Println("\nNo subscriptions found.")
-		return
-	}
-
-	// Create a new table
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"#", "Name", "ID"})
-
-	// Add subscription data to the table
-	for i, sub := range subs {
-		table.Append([]string{
-			fmt.Sprintf("%d", i+1),
-			sub.Name,
-			sub.ID,
-		})
-	}
-
-	// Print the table
-	fmt.Println("\nAvailable subscriptions:")
-	table.Render()
-}
-
-// printSubscriptions prints the list of subscriptions
-func printSubscriptions(subscriptions []Subscription) {
-	if len(subscriptions) == 0 {
-		fmt.Println("\nNo subscriptions found.")
-		return
-	}
+	fmt.Fprintf(log, "\nSuccessfully exported %d/%d VMs to CSV file: %s\n", successCount, len(vms), absPath)
 
-	// Create a new table
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"#", "Subscription Name", "Subscription ID"})
-
-	// Add subscription data to the table
-	for i, sub := range subscriptions {
-		table.Append([]string{
-			fmt.Sprintf("%d", i+1),
-			sub.Name,
-			sub.ID,
-		})
-	}
-
-	// Print the table
-	fmt.Println("\nAvailable subscriptions:")
-	table.Render()
+	return absPath, nil
 }